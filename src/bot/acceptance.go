@@ -0,0 +1,271 @@
+package db
+
+import (
+	"database/sql"
+	"strconv"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/jmoiron/sqlx"
+)
+
+// acceptString describes the guild's AcceptRule for !settings
+func (settings GuildSettingsEntryStruct) acceptString() string {
+	timeout := cooldownString(settings.AcceptTimeout)
+	switch settings.AcceptRule {
+	case AcceptRequired:
+		return "Defenders have " + timeout + " to accept a challenge before voting opens, if they decline or don't answer it's called off."
+	case AcceptForfeit:
+		return "Defenders have " + timeout + " to accept a challenge before voting opens, if they decline or don't answer they forfeit."
+	}
+	return "Voting opens as soon as a challenge is posted, defenders don't have to accept."
+}
+
+// acceptBy is when a challenge started at now stops waiting for the defender, 0 if the guild
+// doesn't make them accept
+func (settings GuildSettingsEntryStruct) acceptBy(now time.Time) int64 {
+	if settings.AcceptRule == AcceptOff {
+		return 0
+	}
+	return now.Add(time.Duration(settings.AcceptTimeout) * time.Second).Unix()
+}
+
+// announcementButtons are the buttons a new challenge's announcement is posted with: the
+// defender's Accept and Decline if the guild makes them accept, otherwise the voting buttons
+func announcementButtons(settings GuildSettingsEntryStruct, challengerName string, defenderName string) []discordgo.MessageComponent {
+	if settings.AcceptRule == AcceptOff {
+		return voteButtons(challengerName, defenderName)
+	}
+	return acceptButtons()
+}
+
+// acceptButtons are the defender's buttons under a challenge waiting for them
+func acceptButtons() []discordgo.MessageComponent {
+	return []discordgo.MessageComponent{
+		discordgo.ActionsRow{Components: []discordgo.MessageComponent{
+			discordgo.Button{Label: "Accept", Style: discordgo.SuccessButton, CustomID: acceptButtonID},
+			discordgo.Button{Label: "Decline", Style: discordgo.DangerButton, CustomID: declineButtonID},
+		}},
+	}
+}
+
+// notAccepted is true for a challenge that is waiting for its defender, or that they declined or
+// didn't answer in time, so it never had any voting
+func notAccepted(challengeEntry ChallengeTableEntryStruct) bool {
+	return challengeEntry.Status == ChallengePending || challengeEntry.Acceptance == Declined || challengeEntry.Acceptance == Unanswered
+}
+
+// forfeited is true for a challenge the challenger won because the defender declined or didn't answer
+func forfeited(challengeEntry ChallengeTableEntryStruct) bool {
+	return (challengeEntry.Acceptance == Declined || challengeEntry.Acceptance == Unanswered) && challengeEntry.Outcome == 1
+}
+
+// acceptanceLine says who a challenge is waiting for, or how the defender's answer (or lack of
+// one) settled it
+func acceptanceLine(challengeEntry ChallengeTableEntryStruct) string {
+	defender := "<@" + challengeEntry.DefenderID + ">"
+	challenger := "<@" + challengeEntry.ChallengerID + ">"
+	switch {
+	case challengeEntry.Status == ChallengePending:
+		return defender + " has until <t:" + strconv.FormatInt(challengeEntry.AcceptBy, 10) + ":R> to accept or decline, voting opens once they accept."
+	case forfeited(challengeEntry) && challengeEntry.Acceptance == Declined:
+		return defender + " declined, so " + challenger + " wins by forfeit."
+	case forfeited(challengeEntry):
+		return defender + " didn't answer in time, so " + challenger + " wins by forfeit."
+	case challengeEntry.Acceptance == Declined:
+		return defender + " declined " + challenger + "'s challenge."
+	}
+	return defender + " didn't answer " + challenger + "'s challenge in time, so it's off."
+}
+
+// acceptanceTitle heads the tally of a challenge notAccepted is true for
+func acceptanceTitle(challengeEntry ChallengeTableEntryStruct) string {
+	switch {
+	case challengeEntry.Status == ChallengePending:
+		return "Waiting for " + challengeEntry.DefenderName
+	case forfeited(challengeEntry):
+		return "Forfeit"
+	case challengeEntry.Acceptance == Declined:
+		return "Declined"
+	}
+	return "No answer"
+}
+
+// answered is a pending challenge after the defender's answer at now. Accepting opens voting, with
+// any time limit counted from then. Declining or not answering calls it off, or if forfeit is set
+// gives the challenger the win
+func answered(challengeEntry ChallengeTableEntryStruct, acceptance int, forfeit bool, now int64) ChallengeTableEntryStruct {
+	challengeEntry.Acceptance = acceptance
+	if acceptance == Accepted {
+		challengeEntry.Status = ChallengeOpen
+		if challengeEntry.Deadline > 0 {
+			challengeEntry.Deadline += now - challengeEntry.CreatedAt
+		}
+		return challengeEntry
+	}
+	challengeEntry.Status = ChallengeClosed
+	challengeEntry.ClosedAt = now
+	challengeEntry.Outcome = OutcomeCancelled
+	if forfeit {
+		challengeEntry.Outcome = 1
+	}
+	return challengeEntry
+}
+
+// answerChallengeRow saves answered's changes to a challenge that is still pending, it affects
+// no rows if it was answered (or cancelled) already
+func answerChallengeRow(db dbtx, row ChallengeTableEntryStruct) (int64, error) {
+	query := "UPDATE challengeTable SET Status = ?, Outcome = ?, Deadline = ?, ClosedAt = ?, Acceptance = ? WHERE GuildID = ? AND MessageID = ? AND Status = ?"
+	stmt, err := db.Prepare(db.Rebind(query))
+	if err != nil {
+		oops(err, "prepare answerChallengeRow")
+		return 0, err
+	}
+	defer stmt.Close()
+	res, err := stmt.Exec(row.Status, row.Outcome, row.Deadline, row.ClosedAt, row.Acceptance, row.GuildID, row.MessageID, ChallengePending)
+	if err != nil {
+		oops(err, "execute answerChallengeRow")
+		return 0, err
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		oops(err, "RowsAffected")
+		return 0, err
+	}
+	rowsAffected(rows, "answering challenge")
+	return rows, nil
+}
+
+// answerChallenge records the defender's answer to a pending challenge and pushes the score if
+// it's a forfeit. Only one answer gets the answered row back, anything after it (or on a
+// challenge that wasn't pending) fails with ErrAnswered
+func answerChallenge(db *sqlx.DB, GuildID string, MessageID string, acceptance int, forfeit bool, now int64, achievements []Achievement) (ChallengeTableEntryStruct, error) {
+	tx, err := db.Beginx()
+	if err != nil {
+		oops(err, "Beginx")
+		return ChallengeTableEntryStruct{}, err
+	}
+	defer tx.Rollback()
+	challengeRow, err := selectChallengeRow(tx, GuildID, MessageID)
+	if err != nil {
+		return challengeRow, err
+	}
+	if challengeRow.Status != ChallengePending {
+		return challengeRow, ErrAnswered
+	}
+	challengeRow = answered(challengeRow, acceptance, forfeit, now)
+	rows, err := answerChallengeRow(tx, challengeRow)
+	if err != nil {
+		return challengeRow, err
+	}
+	if rows == 0 {
+		return challengeRow, ErrAnswered
+	}
+	//a forfeit is scored in the same step, so it can't be recorded without counting
+	if forfeited(challengeRow) {
+		err = pushScore(tx, challengeRow, achievements)
+		if err != nil {
+			return challengeRow, err
+		}
+	}
+	return challengeRow, tx.Commit()
+}
+
+// selectUnansweredChallenges finds the pending challenges in every guild whose AcceptBy is at or before now
+func selectUnansweredChallenges(db dbtx, now int64) ([]ChallengeTableEntryStruct, error) {
+	challengeRows := []ChallengeTableEntryStruct{}
+	err := db.Select(&challengeRows, db.Rebind("SELECT "+challengeColumns+" FROM challengeTable WHERE Status = ? AND AcceptBy <= ? ORDER BY AcceptBy"), ChallengePending, now)
+	return challengeRows, err
+}
+
+// acceptButtonClicked records the defender's Accept or Decline on a challenge waiting for them,
+// anyone else clicking gets told only the defender can answer
+func (b *Bot) acceptButtonClicked(s session, i *discordgo.Interaction, accept bool) {
+	if i.Member == nil || i.Message == nil {
+		return
+	}
+	challengeEntry, err := b.Store.SelectChallengeRow(i.GuildID, i.Message.ID)
+	if err == sql.ErrNoRows {
+		respondEphemeral(s, i, "Sorry, I couldn't find that challenge.")
+		return
+	}
+	if err != nil {
+		oops(err, "SelectChallengeRow")
+		respondEphemeral(s, i, "Sorry, your answer couldn't be saved.")
+		return
+	}
+	if i.Member.User.ID != challengeEntry.DefenderID {
+		respondEphemeral(s, i, "Only <@"+challengeEntry.DefenderID+"> can accept or decline this challenge.")
+		return
+	}
+	acceptance := Declined
+	if accept {
+		acceptance = Accepted
+	}
+	forfeit := b.guildSettings(i.GuildID).AcceptRule == AcceptForfeit
+	challengeEntry, err = b.Store.AnswerChallenge(i.GuildID, i.Message.ID, acceptance, forfeit, time.Now().Unix())
+	if err == ErrAnswered {
+		respondEphemeral(s, i, "This challenge isn't waiting for an answer any more.")
+		return
+	}
+	if err != nil {
+		oops(err, "AnswerChallenge")
+		respondEphemeral(s, i, "Sorry, your answer couldn't be saved.")
+		return
+	}
+	if accept {
+		respondEphemeral(s, i, "You accepted the challenge, voting is open!")
+	} else {
+		respondEphemeral(s, i, "You declined the challenge.")
+	}
+	b.challengeAnswered(s, challengeEntry)
+}
+
+// expireUnansweredChallenges gives up on every pending challenge whose defender didn't answer by
+// now, calling it off or scoring it as a forfeit as the guild decides
+func (b *Bot) expireUnansweredChallenges(s session, now time.Time) {
+	unanswered, err := b.Store.SelectUnansweredChallenges(now.Unix())
+	if err != nil {
+		oops(err, "SelectUnansweredChallenges")
+		return
+	}
+	for _, challengeEntry := range unanswered {
+		forfeit := b.guildSettings(challengeEntry.GuildID).AcceptRule == AcceptForfeit
+		challengeEntry, err = b.Store.AnswerChallenge(challengeEntry.GuildID, challengeEntry.MessageID, Unanswered, forfeit, now.Unix())
+		if err == ErrAnswered || err == sql.ErrNoRows {
+			continue
+		}
+		if err != nil {
+			oops(err, "AnswerChallenge")
+			continue
+		}
+		b.challengeAnswered(s, challengeEntry)
+	}
+}
+
+// challengeAnswered follows up the defender's answer, or the lack of one. Accepting adds the
+// voting reactions and buttons to the announcement. Otherwise the announcement says so and the
+// challenge is called off, or its result posted if it's a forfeit, which AnswerChallenge scored
+func (b *Bot) challengeAnswered(s session, challengeEntry ChallengeTableEntryStruct) {
+	if challengeEntry.Acceptance == Accepted {
+		err := addVoteReactions(s, challengeEntry.ChannelID, challengeEntry.MessageID)
+		if err != nil {
+			oops(err, "MessageReactionAdd")
+		}
+		b.editTally(s, challengeEntry.GuildID, challengeEntry.MessageID)
+		_, err = s.ChannelMessageSend(challengeEntry.ChannelID, "<@"+challengeEntry.DefenderID+"> accepted <@"+challengeEntry.ChallengerID+">'s challenge, voting is open!")
+		if err != nil {
+			oops(err, "ChannelMessageSend")
+		}
+		return
+	}
+	b.editTally(s, challengeEntry.GuildID, challengeEntry.MessageID)
+	if !forfeited(challengeEntry) {
+		_, err := s.ChannelMessageSend(challengeEntry.ChannelID, acceptanceLine(challengeEntry))
+		if err != nil {
+			oops(err, "ChannelMessageSend")
+		}
+		return
+	}
+	b.sendResult(s, challengeEntry.ChannelID, challengeEntry, "")
+}
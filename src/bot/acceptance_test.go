@@ -0,0 +1,247 @@
+package db
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func acceptClick(userID string, messageID string, customID string) *discordgo.Interaction {
+	return &discordgo.Interaction{
+		Type:      discordgo.InteractionMessageComponent,
+		GuildID:   testGuildID,
+		ChannelID: testChannelID,
+		Member:    &discordgo.Member{User: &discordgo.User{ID: userID}},
+		Message:   &discordgo.Message{ID: messageID},
+		Data:      discordgo.MessageComponentInteractionData{CustomID: customID, ComponentType: discordgo.ButtonComponent},
+	}
+}
+
+func pendingChallenge(messageID string, createdAt int64, deadline int64, acceptBy int64) ChallengeTableEntryStruct {
+	row := initChallengeTableEntry(testGuildID, testChannelID, messageID, "1", "Gabe", "2", "Miia")
+	row.Status = ChallengePending
+	row.CreatedAt = createdAt
+	row.Deadline = deadline
+	row.AcceptBy = acceptBy
+	return row
+}
+
+func TestStoreAnswerChallenge(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store) {
+		store.InsertChallengeRow(pendingChallenge("0", 100, 400, 200))
+		store.InsertChallengeRow(pendingChallenge("1", 100, 0, 300))
+		store.InsertChallengeRow(pendingChallenge("2", 100, 0, 250))
+
+		activity, _ := store.SelectChallengeActivity(testGuildID, "1", "2", testChannelID)
+		if activity.ChallengerOpen != 3 || activity.DefenderOpen != 3 {
+			t.Errorf("got %+v, wanted challenges waiting to be accepted counted as open", activity)
+		}
+		_, _, err := store.RecordVote(testGuildID, "0", "10", ChallengerVote, twoStopVotes)
+		if err != ErrVotingClosed {
+			t.Errorf("got %v, wanted no voting before the defender accepts", err)
+		}
+		unanswered, err := store.SelectUnansweredChallenges(250)
+		if err != nil {
+			t.Fatalf("got %s, wanted nil", err)
+		}
+		if len(unanswered) != 2 || unanswered[0].MessageID != "0" || unanswered[1].MessageID != "2" {
+			t.Errorf("got %+v, wanted challenges 0 and 2 in AcceptBy order", unanswered)
+		}
+
+		accepted, err := store.AnswerChallenge(testGuildID, "0", Accepted, true, 150)
+		if err != nil || accepted.Status != ChallengeOpen || accepted.Acceptance != Accepted {
+			t.Errorf("got %+v and %v, wanted challenge 0 open", accepted, err)
+		}
+		if accepted.Deadline != 450 {
+			t.Errorf("got %d, wanted the time limit to start when the challenge was accepted", accepted.Deadline)
+		}
+		_, err = store.AnswerChallenge(testGuildID, "0", Declined, true, 160)
+		if err != ErrAnswered {
+			t.Errorf("got %v, wanted %v", err, ErrAnswered)
+		}
+		_, _, err = store.RecordVote(testGuildID, "0", "10", ChallengerVote, twoStopVotes)
+		if err != nil {
+			t.Errorf("got %v, wanted voting open once accepted", err)
+		}
+
+		//a forfeit that can't be scored isn't recorded either
+		_, err = store.AnswerChallenge(testGuildID, "1", Declined, true, 160)
+		pending, _ := store.SelectChallengeRow(testGuildID, "1")
+		if err == nil || pending.Status != ChallengePending {
+			t.Errorf("got %+v and %v, wanted challenge 1 still waiting without scoreboard rows", pending, err)
+		}
+		store.InsertScoreboardRow(initScoreBoardRow(testGuildID, "1", "Gabe"))
+		store.InsertScoreboardRow(initScoreBoardRow(testGuildID, "2", "Miia"))
+		declined, _ := store.AnswerChallenge(testGuildID, "1", Declined, true, 160)
+		if declined.Status != ChallengeClosed || declined.Outcome != 1 || declined.ClosedAt != 160 || !forfeited(declined) {
+			t.Errorf("got %+v, wanted challenge 1 forfeited", declined)
+		}
+		challenger, _ := store.SelectScoreboardRow(testGuildID, "1")
+		if challenger.SuccessfulChallenges != 1 {
+			t.Errorf("got %+v, wanted the forfeit scored for the challenger", challenger)
+		}
+		timedOut, _ := store.AnswerChallenge(testGuildID, "2", Unanswered, false, 250)
+		if timedOut.Status != ChallengeClosed || timedOut.Outcome != OutcomeCancelled || timedOut.Acceptance != Unanswered {
+			t.Errorf("got %+v, wanted challenge 2 called off", timedOut)
+		}
+		saved, _ := store.SelectChallengeRow(testGuildID, "2")
+		if saved != timedOut {
+			t.Errorf("got %+v, wanted %+v", saved, timedOut)
+		}
+		unanswered, _ = store.SelectUnansweredChallenges(1000)
+		if len(unanswered) != 0 {
+			t.Errorf("got %+v, wanted nothing left waiting", unanswered)
+		}
+	})
+}
+
+func TestAcceptChallenge(t *testing.T) {
+	b := newTestBot()
+	b.Store.UpsertGuildSettings(GuildSettingsEntryStruct{testGuildID, CloseAfterStopVotes, 2, CountParticipantVotes, CloseByAnyone, "", 0, 0, 0, 0, AcceptRequired, 600})
+	s := &fakeSession{permissions: discordgo.PermissionEmbedLinks}
+	statement := &discordgo.Message{ID: "5", GuildID: testGuildID, Content: testResponse, Author: &discordgo.User{ID: "2", Username: "Miia"}}
+	b.messageCreate(s, &discordgo.Message{ID: "50", GuildID: testGuildID, ChannelID: testChannelID, Content: "!challenge", Type: discordgo.MessageTypeReply, Author: &discordgo.User{ID: "1", Username: "Gabe"}, ReferencedMessage: statement})
+	if len(s.complex) != 1 || len(s.reactions) != 0 {
+		t.Fatalf("got %d announcements and reactions %q, wanted an announcement without reactions", len(s.complex), s.reactions)
+	}
+	button := s.complex[0].Components[0].(discordgo.ActionsRow).Components[0].(discordgo.Button)
+	if button.CustomID != acceptButtonID {
+		t.Errorf("got %q, wanted the defender's buttons", button.CustomID)
+	}
+	if len(s.edits) != 1 || s.edits[0].Embeds[1].Title != "Waiting for Miia" || !strings.HasPrefix(s.edits[0].Embeds[1].Description, "<@2> has until <t:") {
+		t.Fatalf("got %+v, wanted the announcement to say who it's waiting for", s.edits)
+	}
+	announcementID := s.edits[0].ID
+	challengeRow, _ := b.Store.SelectChallengeRow(testGuildID, announcementID)
+	if challengeRow.Status != ChallengePending || challengeRow.AcceptBy < time.Now().Unix()+590 {
+		t.Errorf("got %+v, wanted the challenge waiting 10 minutes for Miia", challengeRow)
+	}
+
+	b.interactionCreate(s, acceptClick("1", announcementID, acceptButtonID))
+	if reply := s.responses[len(s.responses)-1].Data.Content; reply != "Only <@2> can accept or decline this challenge." {
+		t.Errorf("got %q", reply)
+	}
+	b.interactionCreate(s, acceptClick("2", announcementID, acceptButtonID))
+	if reply := s.responses[len(s.responses)-1].Data.Content; reply != "You accepted the challenge, voting is open!" {
+		t.Errorf("got %q", reply)
+	}
+	if len(s.reactions) != 4 {
+		t.Errorf("got %q, wanted the voting reactions added once accepted", s.reactions)
+	}
+	if len(s.sent) != 1 || s.sent[0] != "<@2> accepted <@1>'s challenge, voting is open!" {
+		t.Errorf("got %q", s.sent)
+	}
+	last := s.edits[len(s.edits)-1]
+	voteButton := last.Components[0].(discordgo.ActionsRow).Components[0].(discordgo.Button)
+	if last.Embeds[1].Title != "Current tally" || voteButton.CustomID != voteButtonPrefix+voteButtonNames[ChallengerVote] {
+		t.Errorf("got %q and %q, wanted voting open", last.Embeds[1].Title, voteButton.CustomID)
+	}
+	b.interactionCreate(s, acceptClick("2", announcementID, declineButtonID))
+	if reply := s.responses[len(s.responses)-1].Data.Content; reply != "This challenge isn't waiting for an answer any more." {
+		t.Errorf("got %q", reply)
+	}
+	b.addVote(testGuildID, announcementID, "10", voteChallenger)
+	challengeRow, _ = b.Store.SelectChallengeRow(testGuildID, announcementID)
+	if challengeRow.ChallengerVotes != 1 {
+		t.Errorf("got %d, wanted %d", challengeRow.ChallengerVotes, 1)
+	}
+}
+
+func TestDeclineChallenge(t *testing.T) {
+	b := newTestBot()
+	b.Store.UpsertGuildSettings(GuildSettingsEntryStruct{testGuildID, CloseAfterStopVotes, 2, CountParticipantVotes, CloseByAnyone, "", 0, 0, 0, 0, AcceptForfeit, 600})
+	b.startChallenge(testGuildID, testChannelID, "0", "1", "Gabe", "2", "Miia", testResponse, "5", 0, 2000)
+	b.startChallenge(testGuildID, testChannelID, "1", "1", "Gabe", "2", "Miia", testResponse, "6", 0, 2000)
+	s := &fakeSession{permissions: discordgo.PermissionEmbedLinks}
+	b.interactionCreate(s, acceptClick("2", "0", declineButtonID))
+	if reply := s.responses[0].Data.Content; reply != "You declined the challenge." {
+		t.Errorf("got %q", reply)
+	}
+	if len(s.complex) != 1 || s.complex[0].Embeds[0].Title != "Gabe has won the challenge!" || s.complex[0].Embeds[0].Description != "<@2> declined, so <@1> wins by forfeit." {
+		t.Fatalf("got %+v, wanted Gabe to win by forfeit", s.complex)
+	}
+	if s.edits[0].Embeds[0].Title != "Forfeit" {
+		t.Errorf("got %q, wanted %q", s.edits[0].Embeds[0].Title, "Forfeit")
+	}
+	button := s.edits[0].Components[0].(discordgo.ActionsRow).Components[1].(discordgo.Button)
+	if button.CustomID != declineButtonID || !button.Disabled {
+		t.Errorf("the defender's buttons should be disabled once they answered")
+	}
+	challenger, _ := b.Store.SelectScoreboardRow(testGuildID, "1")
+	defender, _ := b.Store.SelectScoreboardRow(testGuildID, "2")
+	if challenger.SuccessfulChallenges != 1 || defender.FailedDefenses != 1 {
+		t.Errorf("got %+v and %+v, wanted the forfeit scored", challenger, defender)
+	}
+
+	//without forfeits a decline just calls it off
+	b.Store.UpsertGuildSettings(GuildSettingsEntryStruct{testGuildID, CloseAfterStopVotes, 2, CountParticipantVotes, CloseByAnyone, "", 0, 0, 0, 0, AcceptRequired, 600})
+	b.interactionCreate(s, acceptClick("2", "1", declineButtonID))
+	if len(s.sent) != 1 || s.sent[0] != "<@2> declined <@1>'s challenge." {
+		t.Errorf("got %q", s.sent)
+	}
+	challenger, _ = b.Store.SelectScoreboardRow(testGuildID, "1")
+	if challenger.TotalChallenges != 1 {
+		t.Errorf("got %d, wanted a called off challenge not to count", challenger.TotalChallenges)
+	}
+	rows, _ := b.Store.SelectHeadToHead(testGuildID, "1", "2")
+	if len(rows) != 1 || rows[0].MessageID != "0" {
+		t.Errorf("got %+v, wanted only the forfeit in the head to head", rows)
+	}
+	embed, _, _ := b.historyPage(testGuildID, "1", defaultHistoryLength, 0)
+	if embed.Fields[0].Name != "Not accepted against Miia" && embed.Fields[1].Name != "Not accepted against Miia" {
+		t.Errorf("got %q and %q, wanted the declined challenge in the history", embed.Fields[0].Name, embed.Fields[1].Name)
+	}
+}
+
+func TestExpireUnansweredChallenges(t *testing.T) {
+	b := newTestBot()
+	b.Store.UpsertGuildSettings(GuildSettingsEntryStruct{testGuildID, CloseAfterStopVotes, 2, CountParticipantVotes, CloseByAnyone, "", 0, 0, 0, 0, AcceptRequired, 600})
+	b.startChallenge(testGuildID, testChannelID, "0", "1", "Gabe", "2", "Miia", testResponse, "5", 0, 999)
+	b.startChallenge(testGuildID, testChannelID, "1", "1", "Gabe", "2", "Miia", testResponse, "6", 0, 2000)
+	s := &fakeSession{}
+	b.expireUnansweredChallenges(s, time.Unix(1000, 0))
+	if len(s.sent) != 1 || s.sent[0] != "<@2> didn't answer <@1>'s challenge in time, so it's off." {
+		t.Errorf("got %q", s.sent)
+	}
+	if len(s.edits) != 1 || !strings.HasSuffix(*s.edits[0].Content, "\n\n📊 No answer\n<@2> didn't answer <@1>'s challenge in time, so it's off.") {
+		t.Errorf("got %+v, wanted the announcement to say it's off", s.edits)
+	}
+	b.expireUnansweredChallenges(s, time.Unix(1000, 0))
+	if len(s.sent) != 1 {
+		t.Errorf("a challenge should only be given up on once")
+	}
+	challengeRow, _ := b.Store.SelectChallengeRow(testGuildID, "1")
+	if challengeRow.Status != ChallengePending {
+		t.Errorf("challenge 1 isn't due until 2000")
+	}
+}
+
+func TestSettingsAccept(t *testing.T) {
+	b := newTestBot()
+	s := &fakeSession{permissions: discordgo.PermissionManageServer}
+	send := func(content string) string {
+		b.messageCreate(s, &discordgo.Message{GuildID: testGuildID, ChannelID: testChannelID, Author: &discordgo.User{ID: "1"}, Content: content})
+		return s.sent[len(s.sent)-1]
+	}
+	tests := []struct {
+		command  string
+		expected string
+	}{
+		{"!settings accept forfeit", "Defenders have 1h0m0s to accept a challenge before voting opens, if they decline or don't answer they forfeit."},
+		{"!settings accept on 30m", "Defenders have 30m0s to accept a challenge before voting opens, if they decline or don't answer it's called off."},
+		{"!settings accept on 10s", "Sorry, the time to accept looks like 30m, 2h or 1d, up to 7 days."},
+		{"!settings accept maybe", "Sorry, accepting challenges can be off, on or forfeit."},
+		{"!settings accept off", "Voting opens as soon as a challenge is posted, defenders don't have to accept."},
+	}
+	for _, test := range tests {
+		if reply := send(test.command); reply != test.expected {
+			t.Errorf("%q got %q, wanted %q", test.command, reply, test.expected)
+		}
+	}
+	settings := b.guildSettings(testGuildID)
+	if settings.AcceptRule != AcceptOff || settings.AcceptTimeout != 1800 {
+		t.Errorf("got %+v, wanted accepting off with the 30m timeout kept", settings)
+	}
+}
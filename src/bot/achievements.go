@@ -0,0 +1,234 @@
+package db
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+// AchievementStat is what an achievement's Goal counts
+type AchievementStat string
+
+const (
+	StatWins          AchievementStat = "wins"
+	StatDefenses      AchievementStat = "defenses"
+	StatChallenges    AchievementStat = "challenges"
+	StatWinStreak     AchievementStat = "winstreak"
+	StatDefenseStreak AchievementStat = "defensestreak"
+	//rating points a beaten opponent was ahead by before the challenge
+	StatUpset AchievementStat = "upset"
+)
+
+// Achievement is unlocked the first time a user's Stat reaches Goal as one of their challenges closes
+type Achievement struct {
+	ID string `json:"id"`
+	//saved with everyone who unlocked it, so it shouldn't change once in use
+	Name        string          `json:"name"`
+	Description string          `json:"description"`
+	Stat        AchievementStat `json:"stat"`
+	Goal        int             `json:"goal"`
+}
+
+// DefaultAchievements are the achievements used when no -achievements file is given
+func DefaultAchievements() []Achievement {
+	return []Achievement{
+		{"first-win", "First blood", "Win a challenge", StatWins, 1},
+		{"on-fire", "On fire", "Win 5 challenges in a row", StatWinStreak, 5},
+		{"fortress", "Fortress", "Win 10 challenges as the defender", StatDefenses, 10},
+		{"giant-slayer", "Giant slayer", "Beat someone rated at least 100 higher than you", StatUpset, 100},
+	}
+}
+
+// LoadAchievements reads the achievements to use from a JSON file holding a list of objects
+// with the id, name, description, stat and goal of each one
+func LoadAchievements(filename string) ([]Achievement, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	achievements := []Achievement{}
+	err = json.Unmarshal(data, &achievements)
+	if err != nil {
+		return nil, err
+	}
+	seen := map[string]bool{}
+	for _, achievement := range achievements {
+		if achievement.ID == "" || achievement.Name == "" {
+			return nil, fmt.Errorf("every achievement needs an id and a name")
+		}
+		if seen[achievement.ID] {
+			return nil, fmt.Errorf("achievement %q is listed twice", achievement.ID)
+		}
+		seen[achievement.ID] = true
+		if !achievement.Stat.valid() {
+			return nil, fmt.Errorf("achievement %q has unknown stat %q", achievement.ID, achievement.Stat)
+		}
+		if achievement.Goal < 1 {
+			return nil, fmt.Errorf("achievement %q needs a goal of at least 1", achievement.ID)
+		}
+	}
+	return achievements, nil
+}
+
+func (stat AchievementStat) valid() bool {
+	switch stat {
+	case StatWins, StatDefenses, StatChallenges, StatWinStreak, StatDefenseStreak, StatUpset:
+		return true
+	}
+	return false
+}
+
+// reached is true when row, just after a challenge closed, meets the achievement's goal. upset
+// is how far the beaten opponent's rating was ahead, 0 if the user didn't win
+func (a Achievement) reached(row ScoreboardTableEntryStruct, upset int) bool {
+	switch a.Stat {
+	case StatWins:
+		return row.TotalChallengeWins >= a.Goal
+	case StatDefenses:
+		return row.SuccessfulDefenses >= a.Goal
+	case StatChallenges:
+		return row.TotalChallenges >= a.Goal
+	case StatWinStreak:
+		return row.CurrentWinStreak >= a.Goal
+	case StatDefenseStreak:
+		return row.CurrentDefenseStreak >= a.Goal
+	case StatUpset:
+		return upset >= a.Goal
+	}
+	return false
+}
+
+// AchievementEntryStruct is an achievement a user has unlocked
+type AchievementEntryStruct struct {
+	GuildID     string `db:"GuildID"`
+	UserID      string `db:"UserID"`
+	Achievement string `db:"Achievement"`
+	//the Achievement's ID
+	MessageID  string `db:"MessageID"`
+	UnlockedAt int64  `db:"UnlockedAt"`
+}
+
+// insertAchievementRow saves an unlocked achievement, it's false if the user already had it
+func insertAchievementRow(db dbtx, row AchievementEntryStruct) (bool, error) {
+	query := "INSERT INTO achievements (GuildID, UserID, Achievement, MessageID, UnlockedAt) VALUES (?, ?, ?, ?, ?) ON CONFLICT DO NOTHING"
+	stmt, err := db.Prepare(db.Rebind(query))
+	if err != nil {
+		oops(err, "prepare insertAchievementRow")
+		return false, err
+	}
+	defer stmt.Close()
+	res, err := stmt.Exec(row.GuildID, row.UserID, row.Achievement, row.MessageID, row.UnlockedAt)
+	if err != nil {
+		oops(err, "execute insertAchievementRow")
+		return false, err
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		oops(err, "RowsAffected")
+		return false, err
+	}
+	rowsAffected(rows, "inserting achievement row")
+	return rows == 1, nil
+}
+
+// selectAchievements returns the achievements a user has unlocked, oldest first
+func selectAchievements(db dbtx, GuildID string, UserID string) ([]AchievementEntryStruct, error) {
+	achievements := []AchievementEntryStruct{}
+	err := db.Select(&achievements, db.Rebind("SELECT GuildID, UserID, Achievement, MessageID, UnlockedAt FROM achievements WHERE GuildID = ? AND UserID = ? ORDER BY UnlockedAt, Achievement"), GuildID, UserID)
+	return achievements, err
+}
+
+// unlockedAchievement is an achievement a closed challenge unlocked for one of its participants
+type unlockedAchievement struct {
+	UserID      string
+	Achievement Achievement
+}
+
+func (u unlockedAchievement) String() string {
+	return "<@" + u.UserID + "> unlocked **" + u.Achievement.Name + "**: " + u.Achievement.Description
+}
+
+// reachedAchievements is every achievement a challenge that was just scored meets for its
+// participants, from their scoreboard rows after it and their ratings before it in history.
+// Saving them skips the ones a user already had
+func reachedAchievements(achievements []Achievement, challengeEntry ChallengeTableEntryStruct, rows []ScoreboardTableEntryStruct, history []RatingHistoryEntryStruct, now int64) []AchievementEntryStruct {
+	ratingBefore := map[string]int{}
+	for _, row := range history {
+		ratingBefore[row.UserID] = row.RatingBefore
+	}
+	reached := []AchievementEntryStruct{}
+	for _, row := range rows {
+		upset := 0
+		if winnerID(challengeEntry) == row.UserID {
+			opponentID := challengeEntry.ChallengerID
+			if row.UserID == challengeEntry.ChallengerID {
+				opponentID = challengeEntry.DefenderID
+			}
+			upset = ratingBefore[opponentID] - ratingBefore[row.UserID]
+		}
+		for _, achievement := range achievements {
+			if achievement.reached(row, upset) {
+				reached = append(reached, AchievementEntryStruct{challengeEntry.GuildID, row.UserID, achievement.ID, challengeEntry.MessageID, now})
+			}
+		}
+	}
+	return reached
+}
+
+// selectChallengeAchievements returns the achievements a challenge unlocked when it was scored
+func selectChallengeAchievements(db dbtx, GuildID string, MessageID string) ([]AchievementEntryStruct, error) {
+	achievements := []AchievementEntryStruct{}
+	err := db.Select(&achievements, db.Rebind("SELECT GuildID, UserID, Achievement, MessageID, UnlockedAt FROM achievements WHERE GuildID = ? AND MessageID = ?"), GuildID, MessageID)
+	return achievements, err
+}
+
+// challengeAchievements is what a closed challenge unlocked when its score was pushed, the
+// challenger's first, in the order they're configured
+func (b *Bot) challengeAchievements(challengeEntry ChallengeTableEntryStruct) []unlockedAchievement {
+	unlocked := []unlockedAchievement{}
+	rows, err := b.Store.SelectChallengeAchievements(challengeEntry.GuildID, challengeEntry.MessageID)
+	if err != nil {
+		oops(err, "SelectChallengeAchievements")
+		return unlocked
+	}
+	for _, userID := range []string{challengeEntry.ChallengerID, challengeEntry.DefenderID} {
+		for _, achievement := range b.Config.Achievements {
+			for _, row := range rows {
+				if row.UserID == userID && row.Achievement == achievement.ID {
+					unlocked = append(unlocked, unlockedAchievement{userID, achievement})
+				}
+			}
+		}
+	}
+	return unlocked
+}
+
+// achievementNames lists the names of the achievements a user has unlocked, ones no longer
+// configured are shown by ID
+func (b *Bot) achievementNames(guildID string, userID string) ([]string, error) {
+	rows, err := b.Store.SelectAchievements(guildID, userID)
+	if err != nil {
+		return nil, err
+	}
+	names := []string{}
+	for _, row := range rows {
+		name := row.Achievement
+		for _, achievement := range b.Config.Achievements {
+			if achievement.ID == row.Achievement {
+				name = achievement.Name
+			}
+		}
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+// achievementsText is the lines announcing unlocked achievements under a result
+func achievementsText(unlocked []unlockedAchievement) string {
+	lines := []string{}
+	for _, u := range unlocked {
+		lines = append(lines, "🏆 "+u.String())
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,138 @@
+package db
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestUpdateStreaks(t *testing.T) {
+	challenger := initScoreBoardRow(testGuildID, "1", "Gabe")
+	defender := initScoreBoardRow(testGuildID, "2", "Miia")
+	for _, outcome := range []int{2, 2, 2} {
+		applyOutcome(&challenger, &defender, outcome)
+	}
+	if defender.CurrentWinStreak != 3 || defender.CurrentDefenseStreak != 3 || defender.BestDefenseStreak != 3 {
+		t.Errorf("got %+v, wanted three wins in a row as defender", defender)
+	}
+	applyOutcome(&defender, &challenger, 1)
+	if defender.CurrentWinStreak != 4 || defender.CurrentDefenseStreak != 3 {
+		t.Errorf("got %+v, wanted a win as challenger to leave the defense streak alone", defender)
+	}
+	applyOutcome(&challenger, &defender, 0)
+	if defender.CurrentWinStreak != 0 || defender.CurrentDefenseStreak != 0 || defender.BestWinStreak != 4 || defender.BestDefenseStreak != 3 {
+		t.Errorf("got %+v, wanted a tie to start the streaks over and keep the best ones", defender)
+	}
+	if challenger.CurrentWinStreak != 0 || challenger.BestWinStreak != 0 {
+		t.Errorf("got %+v, wanted no wins", challenger)
+	}
+}
+
+func TestStoreAchievements(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store) {
+		added, err := store.UnlockAchievement(AchievementEntryStruct{testGuildID, "1", "fortress", "5", 200})
+		if err != nil || !added {
+			t.Fatalf("got %t and %v, wanted the achievement added", added, err)
+		}
+		store.UnlockAchievement(AchievementEntryStruct{testGuildID, "1", "first-win", "3", 100})
+		store.UnlockAchievement(AchievementEntryStruct{"901", "1", "on-fire", "4", 100})
+		added, _ = store.UnlockAchievement(AchievementEntryStruct{testGuildID, "1", "fortress", "6", 300})
+		if added {
+			t.Errorf("an achievement should only be unlocked once")
+		}
+		rows, err := store.SelectAchievements(testGuildID, "1")
+		if err != nil || len(rows) != 2 || rows[0].Achievement != "first-win" || rows[1].MessageID != "5" {
+			t.Errorf("got %+v and %v, wanted first-win then fortress", rows, err)
+		}
+	})
+}
+
+// TestStoreAchievementsUnlockedOnClose checks closing a challenge saves what it unlocked in the
+// same step, so a later close can't change what's announced for it
+func TestStoreAchievementsUnlockedOnClose(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store) {
+		store.SetAchievements(DefaultAchievements())
+		store.InsertScoreboardRow(initScoreBoardRow(testGuildID, "1", "Gabe"))
+		defender := initScoreBoardRow(testGuildID, "2", "Miia")
+		defender.Rating = 1150
+		store.InsertScoreboardRow(defender)
+		for _, messageID := range []string{"0", "1"} {
+			store.InsertChallengeRow(initChallengeTableEntry(testGuildID, testChannelID, messageID, "1", "Gabe", "2", "Miia"))
+		}
+		store.RecordVote(testGuildID, "0", "10", ChallengerVote, twoStopVotes)
+		store.RecordVote(testGuildID, "1", "10", DefenderVote, twoStopVotes)
+		store.CloseChallenge(testGuildID, "0")
+		store.CloseChallenge(testGuildID, "1")
+
+		rows, err := store.SelectChallengeAchievements(testGuildID, "0")
+		if err != nil || len(rows) != 2 {
+			t.Fatalf("got %+v and %v, wanted Gabe's first win and upset", rows, err)
+		}
+		for _, row := range rows {
+			if row.UserID != "1" || (row.Achievement != "first-win" && row.Achievement != "giant-slayer") {
+				t.Errorf("got %+v, wanted one of Gabe's achievements", row)
+			}
+		}
+		rows, _ = store.SelectChallengeAchievements(testGuildID, "1")
+		if len(rows) != 1 || rows[0].UserID != "2" || rows[0].Achievement != "first-win" {
+			t.Errorf("got %+v, wanted only Miia's first win", rows)
+		}
+	})
+}
+
+func TestAwardAchievements(t *testing.T) {
+	b := newTestBot()
+	now := time.Unix(1000, 0)
+	s := &fakeSession{}
+	b.startChallenge(testGuildID, testChannelID, "0", "1", "Gabe", "2", "Miia", testResponse, "5", 999, 0)
+	defender, _ := b.Store.SelectScoreboardRow(testGuildID, "2")
+	defender.Rating = 1150
+	b.Store.UpdateScoreboard(defender)
+	b.addVote(testGuildID, "0", "10", voteChallenger)
+	b.closeExpiredChallenges(s, now)
+	if len(s.sent) != 1 || !strings.HasSuffix(s.sent[0], "\n\n🏆 <@1> unlocked **First blood**: Win a challenge\n🏆 <@1> unlocked **Giant slayer**: Beat someone rated at least 100 higher than you") {
+		t.Errorf("got %q, wanted Gabe's first win and upset announced", s.sent)
+	}
+	//a second win unlocks nothing new
+	b.startChallenge(testGuildID, testChannelID, "1", "1", "Gabe", "2", "Miia", testResponse, "6", 999, 0)
+	b.addVote(testGuildID, "1", "10", voteChallenger)
+	b.closeExpiredChallenges(s, now)
+	if len(s.sent) != 2 || strings.Contains(s.sent[1], "🏆") {
+		t.Errorf("got %q, wanted no achievements the second time", s.sent)
+	}
+	challenger, _ := b.Store.SelectScoreboardRow(testGuildID, "1")
+	if challenger.CurrentWinStreak != 2 || challenger.BestWinStreak != 2 {
+		t.Errorf("got %+v, wanted a win streak of 2", challenger)
+	}
+	output, _ := b.checkScore(testGuildID, "<@1>")
+	if !strings.HasSuffix(output, "\nAchievements: First blood, Giant slayer") {
+		t.Errorf("got %q, wanted Gabe's achievements listed", output)
+	}
+}
+
+func TestLoadAchievements(t *testing.T) {
+	dir := t.TempDir()
+	write := func(content string) string {
+		filename := filepath.Join(dir, "achievements.json")
+		ioutil.WriteFile(filename, []byte(content), 0644)
+		return filename
+	}
+	achievements, err := LoadAchievements(write(`[{"id": "veteran", "name": "Veteran", "description": "Finish 50 challenges", "stat": "challenges", "goal": 50}]`))
+	if err != nil || len(achievements) != 1 || achievements[0].Stat != StatChallenges || achievements[0].Goal != 50 {
+		t.Errorf("got %+v and %v, wanted the veteran achievement", achievements, err)
+	}
+	for _, content := range []string{
+		`[{"id": "veteran", "name": "Veteran", "stat": "votes", "goal": 50}]`,
+		`[{"id": "veteran", "name": "Veteran", "stat": "wins", "goal": 0}]`,
+		`[{"name": "Veteran", "stat": "wins", "goal": 1}]`,
+		`[{"id": "a", "name": "A", "stat": "wins", "goal": 1}, {"id": "a", "name": "B", "stat": "wins", "goal": 2}]`,
+		`{}`,
+	} {
+		_, err = LoadAchievements(write(content))
+		if err == nil {
+			t.Errorf("%s should have been rejected", content)
+		}
+	}
+}
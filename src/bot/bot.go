@@ -0,0 +1,94 @@
+package db
+
+import (
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Config holds the settings the bot was started with
+type Config struct {
+	//number of ✋ reactions needed to close voting on a challenge, for guilds that haven't picked their own close rule
+	StopVotesNeeded int
+	//how long voting stays open when !challenge isn't given a duration, 0 for no time limit
+	DefaultChallengeDuration time.Duration
+	//how often the scheduler looks for challenges past their deadline
+	SchedulerInterval time.Duration
+	//take a user's old reaction off the announcement when they switch sides, needs Manage Messages
+	RemoveSwitchedReactions bool
+	//least time between edits to a challenge's live tally, 0 edits after every vote
+	TallyInterval time.Duration
+	//what can be unlocked as challenges close, none turns achievements off
+	Achievements []Achievement
+	//least time between challenges by the same challenger, against the same defender and in the
+	//same channel, and how many open challenges a user can be in, for guilds that haven't set their own.
+	//all off by default, 0 is no limit
+	ChallengerCooldown time.Duration
+	DefenderCooldown   time.Duration
+	ChannelCooldown    time.Duration
+	MaxOpenChallenges  int
+	//how long a defender has to accept a challenge, for guilds that make them accept but haven't set their own
+	AcceptTimeout time.Duration
+}
+
+// DefaultConfig is used for anything not set on the command line
+func DefaultConfig() Config {
+	return Config{
+		StopVotesNeeded:          2,
+		DefaultChallengeDuration: 0,
+		SchedulerInterval:        15 * time.Second,
+		RemoveSwitchedReactions:  true,
+		TallyInterval:            3 * time.Second,
+		Achievements:             DefaultAchievements(),
+		AcceptTimeout:            time.Hour,
+	}
+}
+
+// session is the part of *discordgo.Session used by the handlers, tests swap it for a fake
+type session interface {
+	ChannelMessageSend(channelID string, content string) (*discordgo.Message, error)
+	ChannelMessageSendComplex(channelID string, data *discordgo.MessageSend) (*discordgo.Message, error)
+	MessageReactionAdd(channelID, messageID, emojiID string) error
+	MessageReactionRemove(channelID, messageID, emojiID, userID string) error
+	InteractionRespond(interaction *discordgo.Interaction, resp *discordgo.InteractionResponse) error
+	InteractionResponse(appID string, interaction *discordgo.Interaction) (*discordgo.Message, error)
+	UserChannelPermissions(userID, channelID string) (int64, error)
+	ChannelMessageEditComplex(m *discordgo.MessageEdit) (*discordgo.Message, error)
+	ChannelMessage(channelID, messageID string) (*discordgo.Message, error)
+	GuildMember(guildID, userID string) (*discordgo.Member, error)
+}
+
+// Bot owns everything the event handlers share: the Discord session,
+// one long-lived database handle and the config
+type Bot struct {
+	Session *discordgo.Session
+	Store   Store
+	Config  Config
+	//the bot's user ID, which is also its application ID, set by RegisterCommands
+	botID string
+
+	//challenges with a tally edit waiting to run, see updateTally
+	tallyMu        sync.Mutex
+	pendingTallies map[challengeKey]bool
+}
+
+// NewBot creates a Bot, register its handlers with AddHandlers before opening the session
+func NewBot(s *discordgo.Session, store Store, config Config) *Bot {
+	store.SetAchievements(config.Achievements)
+	return &Bot{
+		Session: s,
+		Store:   store,
+		Config:  config,
+
+		pendingTallies: map[challengeKey]bool{},
+	}
+}
+
+// AddHandlers registers the bot's event handlers on its session
+func (b *Bot) AddHandlers() {
+	b.Session.AddHandler(b.MessageCreate)
+	b.Session.AddHandler(b.MessageReactionCreate)
+	b.Session.AddHandler(b.MessageReactionDelete)
+	b.Session.AddHandler(b.InteractionCreate)
+}
@@ -0,0 +1,123 @@
+package db
+
+import (
+	"database/sql"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// voteButtonNames are the custom IDs of the voting buttons, after voteButtonPrefix
+var voteButtonNames = map[Vote]string{
+	ChallengerVote: "challenger",
+	DefenderVote:   "defender",
+	AbstainVote:    "abstain",
+	StopVote:       "stop",
+}
+
+// voteButtons are the buttons under a challenge's announcement, one for each reaction
+func voteButtons(challengerName string, defenderName string) []discordgo.MessageComponent {
+	return []discordgo.MessageComponent{
+		discordgo.ActionsRow{Components: []discordgo.MessageComponent{
+			voteButton(ChallengerVote, voteChallenger, challengerName, discordgo.PrimaryButton),
+			voteButton(DefenderVote, voteDefender, defenderName, discordgo.SecondaryButton),
+			voteButton(AbstainVote, voteAbstain, "Abstain", discordgo.SecondaryButton),
+			voteButton(StopVote, voteStop, "Close Voting", discordgo.DangerButton),
+		}},
+	}
+}
+
+func voteButton(vote Vote, emoji string, label string, style discordgo.ButtonStyle) discordgo.Button {
+	return discordgo.Button{
+		Label:    label,
+		Style:    style,
+		CustomID: voteButtonPrefix + voteButtonNames[vote],
+		Emoji:    discordgo.ComponentEmoji{Name: emoji},
+	}
+}
+
+// parseVoteButtonID is the vote a button's custom ID stands for
+func parseVoteButtonID(customID string) (Vote, bool) {
+	if !strings.HasPrefix(customID, voteButtonPrefix) {
+		return 0, false
+	}
+	name := strings.TrimPrefix(customID, voteButtonPrefix)
+	for vote, voteName := range voteButtonNames {
+		if name == voteName {
+			return vote, true
+		}
+	}
+	return 0, false
+}
+
+// voteButtonClicked records a vote from a button on a challenge's announcement, the voter gets a
+// confirmation only they can see and the channel gets the result if it closed the challenge.
+// Clicking a different side switches the user's vote
+func (b *Bot) voteButtonClicked(s session, i *discordgo.Interaction, vote Vote) {
+	if i.Member == nil || i.Message == nil {
+		return
+	}
+	if vote == StopVote {
+		err := b.checkCloser(s, i.GuildID, i.Message.ID, i.Member.User.ID, i.Member)
+		if err == ErrNotCloser {
+			respondEphemeral(s, i, "Sorry, only "+b.guildSettings(i.GuildID).closersString()+" can close voting on this server.")
+			return
+		}
+		if err == sql.ErrNoRows {
+			respondEphemeral(s, i, "Sorry, I couldn't find that challenge.")
+			return
+		}
+		if err != nil {
+			oops(err, "checkCloser")
+			respondEphemeral(s, i, "Sorry, your vote couldn't be saved.")
+			return
+		}
+	}
+	challengeEntry, replaced, counted, closed, err := b.recordVote(i.GuildID, i.Message.ID, i.Member.User.ID, vote, true)
+	switch err {
+	case nil:
+	case ErrAlreadyVoted, ErrAlreadyAbstained:
+		respondEphemeral(s, i, "You've already "+votePhrase(challengeEntry, counted)+".")
+		return
+	case ErrParticipantVote:
+		respondEphemeral(s, i, "Sorry, on this server the challenger and defender can't vote for a side in their own challenge.")
+		return
+	case ErrVotingClosed:
+		if challengeEntry.Outcome == OutcomeCancelled {
+			respondEphemeral(s, i, "This challenge was cancelled.")
+			return
+		}
+		respondEphemeral(s, i, "Voting on this challenge has closed.")
+		return
+	case sql.ErrNoRows:
+		respondEphemeral(s, i, "Sorry, I couldn't find that challenge.")
+		return
+	default:
+		oops(err, "recordVote")
+		respondEphemeral(s, i, "Sorry, your vote couldn't be saved.")
+		return
+	}
+	if replaced != NoVote {
+		respondEphemeral(s, i, "You changed your vote, you've now "+votePhrase(challengeEntry, counted)+".")
+		b.removeSwitchedReaction(s, i.ChannelID, i.Message.ID, i.Member.User.ID, replaced)
+	} else {
+		respondEphemeral(s, i, "You "+votePhrase(challengeEntry, counted)+".")
+	}
+	b.updateTally(s, i.GuildID, i.Message.ID)
+	if closed {
+		b.sendResult(s, i.ChannelID, challengeEntry, "")
+	}
+}
+
+// votePhrase is what a vote did, for the confirmations after "You" or "You've"
+func votePhrase(challengeEntry ChallengeTableEntryStruct, vote Vote) string {
+	switch vote {
+	case ChallengerVote:
+		return "voted for <@" + challengeEntry.ChallengerID + ">"
+	case DefenderVote:
+		return "voted for <@" + challengeEntry.DefenderID + ">"
+	case AbstainVote:
+		return "abstained"
+	}
+	return "voted to close voting"
+}
@@ -0,0 +1,74 @@
+package db
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// buttonClick is a click on one of challenge "0"'s voting buttons
+func buttonClick(userID string, vote Vote) *discordgo.Interaction {
+	return &discordgo.Interaction{
+		Type:      discordgo.InteractionMessageComponent,
+		GuildID:   testGuildID,
+		ChannelID: testChannelID,
+		Member:    &discordgo.Member{User: &discordgo.User{ID: userID}},
+		Message:   &discordgo.Message{ID: "0"},
+		Data:      discordgo.MessageComponentInteractionData{CustomID: voteButtonPrefix + voteButtonNames[vote], ComponentType: discordgo.ButtonComponent},
+	}
+}
+
+func TestParseVoteButtonID(t *testing.T) {
+	for vote := range voteButtonNames {
+		actual, ok := parseVoteButtonID(voteButtonPrefix + voteButtonNames[vote])
+		if !ok || actual != vote {
+			t.Errorf("got %d, wanted %d", actual, vote)
+		}
+	}
+	for _, customID := range []string{"vote:", "vote:blue", "leaderboard:wins:0"} {
+		if _, ok := parseVoteButtonID(customID); ok {
+			t.Errorf("%q shouldn't be a vote", customID)
+		}
+	}
+}
+
+func TestVoteButtons(t *testing.T) {
+	b := newTestChallenge(t)
+	s := &fakeSession{}
+	b.interactionCreate(s, buttonClick("10", ChallengerVote))
+	b.interactionCreate(s, buttonClick("10", DefenderVote))
+	b.interactionCreate(s, buttonClick("10", DefenderVote))
+	b.interactionCreate(s, buttonClick("10", StopVote))
+	b.interactionCreate(s, buttonClick("11", StopVote))
+	expected := []string{
+		"You voted for <@1>.",
+		"You changed your vote, you've now voted for <@2>.",
+		"You've already voted for <@2>.",
+		"You voted to close voting.",
+		"You voted to close voting.",
+	}
+	if len(s.responses) != len(expected) {
+		t.Fatalf("got %d responses, wanted %d", len(s.responses), len(expected))
+	}
+	for i, response := range s.responses {
+		if response.Data.Content != expected[i] {
+			t.Errorf("got %q, wanted %q", response.Data.Content, expected[i])
+		}
+		if response.Data.Flags != uint64(discordgo.MessageFlagsEphemeral) {
+			t.Errorf("confirmations should only be shown to the voter")
+		}
+	}
+	votes, _ := b.Store.SelectVotes(testGuildID, "0")
+	if votes != (VotesStruct{0, 1, 0, 2}) {
+		t.Errorf("got %v, wanted %v", votes, VotesStruct{0, 1, 0, 2})
+	}
+	if len(s.sent) != 1 || !strings.Contains(s.sent[0], "<@2> has won the challenge!") {
+		t.Errorf("got %q, wanted the defender to win", s.sent)
+	}
+
+	b.interactionCreate(s, buttonClick("12", AbstainVote))
+	if s.responses[len(s.responses)-1].Data.Content != "Voting on this challenge has closed." {
+		t.Errorf("got %q, wanted voting to be closed", s.responses[len(s.responses)-1].Data.Content)
+	}
+}
@@ -0,0 +1,58 @@
+package db
+
+import (
+	"database/sql"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func cancelUsage() string {
+	return "Usage: reply " + commandCancel + " to a challenge's announcement, or " + commandCancel + " <challenge id>"
+}
+
+// cancelTarget is the challenge a !cancel is for: the announcement it replies to, or the ID after it
+func cancelTarget(m *discordgo.Message, parameters []string) (string, bool) {
+	if len(parameters) == 2 {
+		return parseChallengeID(parameters[1]), true
+	}
+	if len(parameters) == 1 && m.Type == discordgo.MessageTypeReply && m.ReferencedMessage != nil {
+		return m.ReferencedMessage.ID, true
+	}
+	return "", false
+}
+
+// cancelCommand handles "!cancel", withdrawing an open challenge so it never counts for anyone.
+// The challenger can cancel until someone votes, server managers can cancel at any time. The
+// announcement is edited to say so and its buttons disabled, returning the reply
+func (b *Bot) cancelCommand(s session, m *discordgo.Message, parameters []string) (string, error) {
+	messageID, ok := cancelTarget(m, parameters)
+	if !ok {
+		return cancelUsage(), nil
+	}
+	challengeEntry, err := b.Store.SelectChallengeRow(m.GuildID, messageID)
+	if err == sql.ErrNoRows {
+		return "Sorry, I couldn't find challenge " + messageID + ".", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	manager := isManager(s, m.Author.ID, m.ChannelID)
+	if !manager && m.Author.ID != challengeEntry.ChallengerID {
+		return "Sorry, only <@" + challengeEntry.ChallengerID + "> or a server manager can cancel this challenge.", nil
+	}
+	challengeEntry, err = b.Store.CancelChallenge(m.GuildID, messageID, manager)
+	if err == ErrVotingClosed {
+		if challengeEntry.Outcome == OutcomeCancelled {
+			return "That challenge was cancelled already.", nil
+		}
+		return "Sorry, voting on that challenge has closed, so it can't be cancelled.", nil
+	}
+	if err == ErrHasVotes {
+		return "Sorry, people have already voted on this challenge, so only a server manager can cancel it now.", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	b.editTally(s, m.GuildID, messageID)
+	return "<@" + m.Author.ID + "> cancelled the challenge between <@" + challengeEntry.ChallengerID + "> and <@" + challengeEntry.DefenderID + ">. It won't count towards anyone's score.", nil
+}
@@ -0,0 +1,119 @@
+package db
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestStoreCancelChallenge(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store) {
+		store.InsertChallengeRow(initChallengeTableEntry(testGuildID, testChannelID, "0", "1", "Gabe", "2", "Miia"))
+		store.InsertChallengeRow(initChallengeTableEntry(testGuildID, testChannelID, "1", "1", "Gabe", "2", "Miia"))
+		store.InsertChallengeRow(initChallengeTableEntry(testGuildID, testChannelID, "2", "1", "Gabe", "2", "Miia"))
+
+		cancelled, err := store.CancelChallenge(testGuildID, "0", false)
+		if err != nil || cancelled.Status != ChallengeClosed || cancelled.Outcome != OutcomeCancelled || cancelled.ClosedAt == 0 {
+			t.Errorf("got %+v and %v, wanted challenge 0 cancelled", cancelled, err)
+		}
+		_, err = store.CancelChallenge(testGuildID, "0", true)
+		if err != ErrVotingClosed {
+			t.Errorf("got %v, wanted %v", err, ErrVotingClosed)
+		}
+		_, _, err = store.RecordVote(testGuildID, "0", "10", ChallengerVote, twoStopVotes)
+		if err != ErrVotingClosed {
+			t.Errorf("got %v, wanted votes on a cancelled challenge refused", err)
+		}
+
+		store.RecordVote(testGuildID, "1", "10", StopVote, twoStopVotes)
+		_, err = store.CancelChallenge(testGuildID, "1", false)
+		if err != ErrHasVotes {
+			t.Errorf("got %v, wanted %v", err, ErrHasVotes)
+		}
+		cancelled, err = store.CancelChallenge(testGuildID, "1", true)
+		if err != nil || cancelled.Outcome != OutcomeCancelled || cancelled.StopVotes != 1 {
+			t.Errorf("got %+v and %v, wanted challenge 1 cancelled with its votes kept", cancelled, err)
+		}
+		_, err = store.CancelChallenge(testGuildID, "9", true)
+		if err == nil {
+			t.Errorf("cancelling a missing challenge should fail")
+		}
+
+		store.InsertScoreboardRow(initScoreBoardRow(testGuildID, "1", "Gabe"))
+		store.InsertScoreboardRow(initScoreBoardRow(testGuildID, "2", "Miia"))
+		store.CloseChallenge(testGuildID, "2")
+		rows, _ := store.SelectHeadToHead(testGuildID, "1", "2")
+		if len(rows) != 1 || rows[0].MessageID != "2" {
+			t.Errorf("got %+v, wanted only challenge 2 in the head to head", rows)
+		}
+	})
+}
+
+func TestCancelCommand(t *testing.T) {
+	b := newTestChallenge(t)
+	b.startChallenge(testGuildID, testChannelID, "1", "1", "Gabe", "2", "Miia", testResponse, "6", 0, 0)
+	s := &fakeSession{permissions: discordgo.PermissionEmbedLinks}
+	announcement := &discordgo.Message{ID: "0", ChannelID: testChannelID}
+	cancel := func(s *fakeSession, userID string, content string, reply *discordgo.Message) string {
+		m := &discordgo.Message{GuildID: testGuildID, ChannelID: testChannelID, Content: content, Author: &discordgo.User{ID: userID}}
+		if reply != nil {
+			m.Type = discordgo.MessageTypeReply
+			m.ReferencedMessage = reply
+		}
+		b.messageCreate(s, m)
+		return s.sent[len(s.sent)-1]
+	}
+	if reply := cancel(s, "1", "!cancel", nil); reply != cancelUsage() {
+		t.Errorf("got %q, wanted %q", reply, cancelUsage())
+	}
+	if reply := cancel(s, "2", "!cancel", announcement); reply != "Sorry, only <@1> or a server manager can cancel this challenge." {
+		t.Errorf("got %q", reply)
+	}
+	if reply := cancel(s, "1", "!cancel", announcement); reply != "<@1> cancelled the challenge between <@1> and <@2>. It won't count towards anyone's score." {
+		t.Errorf("got %q", reply)
+	}
+	if len(s.edits) != 1 || s.edits[0].Embeds[0].Title != "Cancelled" || s.edits[0].Embeds[0].Description != "This challenge was cancelled, it doesn't count for anyone." {
+		t.Fatalf("got %+v, wanted the announcement marked cancelled", s.edits)
+	}
+	button := s.edits[0].Components[0].(discordgo.ActionsRow).Components[0].(discordgo.Button)
+	if !button.Disabled {
+		t.Errorf("the buttons should be disabled once a challenge is cancelled")
+	}
+	if reply := cancel(s, "1", "!cancel 0", nil); reply != "That challenge was cancelled already." {
+		t.Errorf("got %q", reply)
+	}
+
+	//reactions on a cancelled challenge are ignored and nothing is ever scored
+	for _, userID := range []string{"10", "11"} {
+		b.messageReactionCreate(s, &discordgo.MessageReaction{GuildID: testGuildID, UserID: userID, MessageID: "0", ChannelID: testChannelID, Emoji: discordgo.Emoji{Name: voteStop}})
+	}
+	challengeRow, _ := b.Store.SelectChallengeRow(testGuildID, "0")
+	if challengeRow.StopVotes != 0 || challengeRow.Outcome != OutcomeCancelled {
+		t.Errorf("got %+v, wanted the cancelled challenge left alone", challengeRow)
+	}
+	challenger, _ := b.Store.SelectScoreboardRow(testGuildID, "1")
+	if challenger.TotalChallenges != 0 {
+		t.Errorf("got %d, wanted a cancelled challenge not to count", challenger.TotalChallenges)
+	}
+	b.interactionCreate(s, buttonClick("10", ChallengerVote))
+	if reply := s.responses[len(s.responses)-1].Data.Content; reply != "This challenge was cancelled." {
+		t.Errorf("got %q", reply)
+	}
+
+	//once someone votes only a server manager can cancel
+	b.addVote(testGuildID, "1", "10", voteDefender)
+	if reply := cancel(s, "1", "!cancel 1", nil); !strings.HasPrefix(reply, "Sorry, people have already voted on this challenge") {
+		t.Errorf("got %q", reply)
+	}
+	manager := &fakeSession{permissions: discordgo.PermissionManageServer}
+	if reply := cancel(manager, "3", "!cancel 1", nil); reply != "<@3> cancelled the challenge between <@1> and <@2>. It won't count towards anyone's score." {
+		t.Errorf("got %q", reply)
+	}
+	if len(manager.edits) != 1 || !strings.HasSuffix(*manager.edits[0].Content, "\n\n📊 Cancelled: 🟦 0 · 🟨 1 · 🟥 0\nThis challenge was cancelled, it doesn't count for anyone.") {
+		t.Errorf("got %+v, wanted the announcement marked cancelled", manager.edits)
+	}
+	if reply := cancel(manager, "3", "!cancel 9", nil); reply != "Sorry, I couldn't find challenge 9." {
+		t.Errorf("got %q", reply)
+	}
+}
@@ -0,0 +1,168 @@
+package db
+
+import (
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// minSeason is the lowest /leaderboard season, Discord wants a pointer to it
+var minSeason = 0.0
+
+// slashCommands are the application commands registered at startup, they do the same as the
+// prefix commands without the bot needing to read message content
+var slashCommands = []*discordgo.ApplicationCommand{
+	{
+		//shows up under Apps when right clicking a message
+		Name: slashChallenge,
+		Type: discordgo.MessageApplicationCommand,
+	},
+	{
+		Name:        slashScore,
+		Type:        discordgo.ChatApplicationCommand,
+		Description: "Show a user's challenge record",
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionUser,
+				Name:        "user",
+				Description: "Whose record to show",
+				Required:    true,
+			},
+		},
+	},
+	{
+		Name:        slashLeaderboard,
+		Type:        discordgo.ChatApplicationCommand,
+		Description: "Show the server's leaderboard",
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionString,
+				Name:        "sort",
+				Description: "What to rank users by, wins if not given",
+				Choices:     leaderboardSortChoices(),
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionInteger,
+				Name:        "season",
+				Description: "A season that has ended, the current standings if not given",
+				MinValue:    &minSeason,
+			},
+		},
+	},
+}
+
+func leaderboardSortChoices() []*discordgo.ApplicationCommandOptionChoice {
+	choices := []*discordgo.ApplicationCommandOptionChoice{}
+	for _, sort := range leaderboardSorts {
+		choices = append(choices, &discordgo.ApplicationCommandOptionChoice{Name: string(sort), Value: string(sort)})
+	}
+	return choices
+}
+
+// RegisterCommands creates or updates the bot's application commands, call it once the session is open
+func (b *Bot) RegisterCommands() error {
+	//a bot's application ID is the same as its user ID, the session only knows it once it's open
+	b.botID = b.Session.State.User.ID
+	_, err := b.Session.ApplicationCommandBulkOverwrite(b.botID, "", slashCommands)
+	return err
+}
+
+// applicationCommand handles a slash or context menu command
+func (b *Bot) applicationCommand(s session, i *discordgo.Interaction) {
+	if i.GuildID == "" || i.Member == nil {
+		respondEphemeral(s, i, "Sorry, these commands only work in servers.")
+		return
+	}
+	data := i.ApplicationCommandData()
+	switch data.Name {
+	case slashChallenge:
+		b.challengeCommand(s, i, data)
+	case slashScore:
+		//the option is required, so Discord always sends it
+		user := data.Options[0].UserValue(nil)
+		if data.Resolved != nil && data.Resolved.Users[user.ID] != nil {
+			user = data.Resolved.Users[user.ID]
+		}
+		output, embeds, err := b.scoreReply(s, i.ChannelID, i.GuildID, user)
+		if err != nil {
+			oops(err, "scoreReply")
+			return
+		}
+		respond(s, i, &discordgo.InteractionResponseData{Content: output, Embeds: embeds})
+	case slashLeaderboard:
+		sortName := ""
+		season := currentSeason
+		for _, option := range data.Options {
+			switch option.Name {
+			case "sort":
+				sortName = option.StringValue()
+			case "season":
+				season = int(option.IntValue())
+			}
+		}
+		sort, _ := parseLeaderboardSort(sortName)
+		embed, buttons, err := b.leaderboardPage(i.GuildID, sort, season, 0)
+		if err != nil {
+			oops(err, "leaderboardPage")
+			return
+		}
+		respond(s, i, &discordgo.InteractionResponseData{Embeds: []*discordgo.MessageEmbed{embed}, Components: buttons})
+	}
+}
+
+// challengeCommand starts a challenge against the message the command was used on, the
+// announcement is the interaction's response
+func (b *Bot) challengeCommand(s session, i *discordgo.Interaction, data discordgo.ApplicationCommandInteractionData) {
+	if data.Resolved == nil || data.Resolved.Messages[data.TargetID] == nil {
+		respondEphemeral(s, i, "Sorry, I couldn't find that message.")
+		return
+	}
+	challenged := data.Resolved.Messages[data.TargetID]
+	challenger := i.Member.User
+	refusal := challengeRefusal(challenger, challenged.Author)
+	if refusal == "" {
+		refusal = b.checkChallengeLimits(i.GuildID, i.ChannelID, challenger.ID, challenged.Author.ID)
+	}
+	if refusal != "" {
+		respondEphemeral(s, i, refusal)
+		return
+	}
+	deadline := deadlineAfter(time.Now(), b.Config.DefaultChallengeDuration)
+
+	settings := b.guildSettings(i.GuildID)
+	content, embeds := b.announcement(s, i.ChannelID, challenger, challenged.Author, challenged.Content, deadline, settings)
+	err := s.InteractionRespond(i, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{Content: content, Embeds: embeds, Components: announcementButtons(settings, challenger.Username, challenged.Author.Username)},
+	})
+	if err != nil {
+		oops(err, "InteractionRespond")
+		return
+	}
+	//the response doesn't come back with its message ID, it has to be fetched
+	announcementMessage, err := s.InteractionResponse(b.botID, i)
+	if err != nil {
+		oops(err, "InteractionResponse")
+		return
+	}
+	err = b.openChallenge(s, i.GuildID, i.ChannelID, announcementMessage.ID, challenger, challenged, deadline, settings)
+	if err != nil {
+		oops(err, "openChallenge")
+	}
+}
+
+// respond answers an interaction with a message in its channel
+func respond(s session, i *discordgo.Interaction, data *discordgo.InteractionResponseData) {
+	err := s.InteractionRespond(i, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: data,
+	})
+	if err != nil {
+		oops(err, "InteractionRespond")
+	}
+}
+
+// respondEphemeral answers an interaction with a message only the user who used it can see
+func respondEphemeral(s session, i *discordgo.Interaction, content string) {
+	respond(s, i, &discordgo.InteractionResponseData{Content: content, Flags: uint64(discordgo.MessageFlagsEphemeral)})
+}
@@ -0,0 +1,93 @@
+package db
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// commandInteraction is an application command used by Gabe (1) in the test guild
+func commandInteraction(data discordgo.ApplicationCommandInteractionData) *discordgo.Interaction {
+	return &discordgo.Interaction{
+		Type:      discordgo.InteractionApplicationCommand,
+		GuildID:   testGuildID,
+		ChannelID: testChannelID,
+		Member:    &discordgo.Member{User: &discordgo.User{ID: "1", Username: "Gabe"}},
+		Data:      data,
+	}
+}
+
+func TestChallengeCommand(t *testing.T) {
+	b := newTestBot()
+	s := &fakeSession{}
+	statement := &discordgo.Message{ID: "50", Content: "Pineapple belongs on pizza", Author: &discordgo.User{ID: "2", Username: "Miia"}}
+	b.interactionCreate(s, commandInteraction(discordgo.ApplicationCommandInteractionData{
+		Name:     slashChallenge,
+		TargetID: "50",
+		Resolved: &discordgo.ApplicationCommandInteractionDataResolved{Messages: map[string]*discordgo.Message{"50": statement}},
+	}))
+	if len(s.responses) != 1 || !strings.Contains(s.responses[0].Data.Content, "Pineapple belongs on pizza") {
+		t.Fatalf("got %+v, wanted the challenge announcement as the response", s.responses)
+	}
+	if strings.Join(s.reactions, "") != voteChallenger+voteDefender+voteAbstain+voteStop {
+		t.Errorf("got %q, wanted the four voting reactions", s.reactions)
+	}
+	challengeRow, err := b.Store.SelectChallengeRow(testGuildID, "201")
+	if err != nil {
+		t.Fatalf("got %s, wanted the challenge stored under the response's ID", err)
+	}
+	if challengeRow.ChallengerID != "1" || challengeRow.DefenderID != "2" {
+		t.Errorf("got %q vs %q, wanted %q vs %q", challengeRow.ChallengerID, challengeRow.DefenderID, "1", "2")
+	}
+	//challenging your own message is refused where only you can see it
+	own := &discordgo.Message{ID: "51", Content: "I'm always right", Author: &discordgo.User{ID: "1", Username: "Gabe"}}
+	b.interactionCreate(s, commandInteraction(discordgo.ApplicationCommandInteractionData{
+		Name:     slashChallenge,
+		TargetID: "51",
+		Resolved: &discordgo.ApplicationCommandInteractionDataResolved{Messages: map[string]*discordgo.Message{"51": own}},
+	}))
+	if len(s.responses) != 2 || s.responses[1].Data.Content != "Sorry, you can't challenge your own message." || s.responses[1].Data.Flags != uint64(discordgo.MessageFlagsEphemeral) {
+		t.Errorf("got %+v, wanted the challenge refused", s.responses[1:])
+	}
+}
+
+func TestScoreCommand(t *testing.T) {
+	b := newTestChallenge(t)
+	s := &fakeSession{}
+	b.interactionCreate(s, commandInteraction(discordgo.ApplicationCommandInteractionData{
+		Name:    slashScore,
+		Options: []*discordgo.ApplicationCommandInteractionDataOption{{Name: "user", Type: discordgo.ApplicationCommandOptionUser, Value: "2"}},
+	}))
+	if len(s.responses) != 1 || !strings.HasPrefix(s.responses[0].Data.Content, "<@2> has the following challenge record:") {
+		t.Errorf("got %+v, wanted Miia's record", s.responses)
+	}
+}
+
+func TestLeaderboardCommand(t *testing.T) {
+	b := newTestBot()
+	addTestScores(b.Store)
+	s := &fakeSession{}
+	b.interactionCreate(s, commandInteraction(discordgo.ApplicationCommandInteractionData{
+		Name:    slashLeaderboard,
+		Options: []*discordgo.ApplicationCommandInteractionDataOption{{Name: "sort", Type: discordgo.ApplicationCommandOptionString, Value: "defenses"}},
+	}))
+	if len(s.responses) != 1 || len(s.responses[0].Data.Embeds) != 1 {
+		t.Fatalf("got %+v, wanted a leaderboard embed", s.responses)
+	}
+	if s.responses[0].Data.Embeds[0].Title != "Leaderboard by defenses" {
+		t.Errorf("got %q, wanted %q", s.responses[0].Data.Embeds[0].Title, "Leaderboard by defenses")
+	}
+}
+
+func TestCommandOutsideGuild(t *testing.T) {
+	b := newTestBot()
+	s := &fakeSession{}
+	i := commandInteraction(discordgo.ApplicationCommandInteractionData{Name: slashLeaderboard})
+	i.GuildID = ""
+	i.Member = nil
+	b.interactionCreate(s, i)
+	if len(s.responses) != 1 || s.responses[0].Data.Flags != uint64(discordgo.MessageFlagsEphemeral) {
+		t.Errorf("got %+v, wanted an ephemeral refusal", s.responses)
+	}
+}
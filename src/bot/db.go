@@ -1,11 +1,15 @@
 package db
 
 import (
-	"context"
 	"database/sql"
 	"github.com/jmoiron/sqlx"
+	"github.com/jmoiron/sqlx/reflectx"
+	_ "github.com/lib/pq"
+	_ "github.com/mattn/go-sqlite3"
 	"log"
+	"sort"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -13,18 +17,65 @@ func rowsAffected(rows int64, task string) {
 	log.Printf("%d rows affected while %s", rows, task)
 }
 
+// dbtx is satisfied by both *sqlx.DB and *sqlx.Tx, so the helpers below also work inside a transaction
+type dbtx interface {
+	sqlx.Ext
+	Get(dest interface{}, query string, args ...interface{}) error
+	Select(dest interface{}, query string, args ...interface{}) error
+	Prepare(query string) (*sql.Stmt, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
 // ConnectToDB creates DB if it doesn't exist already
 func ConnectToDB() (*sqlx.DB, error) {
-	db, err := sqlx.Open("sqlite3", dbname)
+	return connectSQLite(dbname)
+}
+
+// OpenDB connects to the database named by dsn: postgres:// and postgresql:// URLs
+// use Postgres, anything else is the name of a sqlite file
+func OpenDB(dsn string) (*sqlx.DB, error) {
+	if isPostgresDSN(dsn) {
+		return connectPostgres(dsn)
+	}
+	return connectSQLite(dsn)
+}
+
+func isPostgresDSN(dsn string) bool {
+	return strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://")
+}
+
+// connectPostgres opens a Postgres database. Postgres folds the unquoted column names
+// in our queries to lower case, so the db tags are matched in lower case too
+func connectPostgres(dsn string) (*sqlx.DB, error) {
+	db, err := sqlx.Open("postgres", dsn)
 	if err != nil {
 		oops(err, "Open()")
 		return nil, err
 	}
+	db.Mapper = reflectx.NewMapperTagFunc("db", strings.ToLower, strings.ToLower)
+	//several replicas can share one server, so don't let a burst of reactions use up its connections
+	db.SetMaxOpenConns(maxPostgresConns)
+	return db, nil
+}
+
+// connectSQLite opens a sqlite file for use by concurrent handlers. sqlite only has one writer,
+// so the pool is kept to one connection and handlers queue for it instead of racing for the
+// write lock and failing with "database is locked" once busyTimeout runs out. busyTimeout and
+// _txlock=immediate still cover other processes using the same file
+func connectSQLite(filename string) (*sqlx.DB, error) {
+	db, err := sqlx.Open("sqlite3", filename+"?_busy_timeout="+strconv.Itoa(busyTimeout)+"&_txlock=immediate")
+	if err != nil {
+		oops(err, "Open()")
+		return nil, err
+	}
+	db.SetMaxOpenConns(1)
 	return db, nil
 }
 
 //ChallengeTableEntryStruct fields
 type ChallengeTableEntryStruct struct {
+	GuildID         string `db:"GuildID"`
+	ChannelID       string `db:"ChannelID"`
 	MessageID       string `db:"MessageID"`
 	ChallengerID    string `db:"ChallengerID"`
 	ChallengerName  string `db:"ChallengerName"`
@@ -35,10 +86,48 @@ type ChallengeTableEntryStruct struct {
 	AbstainVotes    int    `db:"AbstainVotes"`
 	StopVotes       int    `db:"StopVotes"`
 	Outcome         int    `db:"Outcome"`
-	//0=tie, 1=challenger wins, 2=defender wins
-}
+	//0=tie, 1=challenger wins, 2=defender wins, OutcomeCancelled if it was withdrawn
+	Deadline int64 `db:"Deadline"`
+	//unix time voting closes on its own, 0=no time limit
+	Status int `db:"Status"`
+	//ChallengeOpen, ChallengeClosed or ChallengePending
+	Statement string `db:"Statement"`
+	//the challenged message
+	CreatedAt int64 `db:"CreatedAt"`
+	//unix time the challenge started, 0 for challenges from before it was recorded
+	StatementMessageID string `db:"StatementMessageID"`
+	//ID of the challenged message, MessageID is the announcement's
+	ClosedAt int64 `db:"ClosedAt"`
+	//unix time voting closed, 0 while it's open or if it closed before this was recorded
+	Acceptance int `db:"Acceptance"`
+	//how the defender answered, NotAsked unless the guild makes them accept first
+	AcceptBy int64 `db:"AcceptBy"`
+	//unix time a ChallengePending challenge is given up on, 0 if it was never pending
+}
+
+// Status values for challengeTable
+const (
+	ChallengeOpen   = 0
+	ChallengeClosed = 1
+	//waiting for the defender to accept before voting opens
+	ChallengePending = 2
+)
+
+// Acceptance values for challengeTable
+const (
+	NotAsked = 0
+	Accepted = 1
+	Declined = 2
+	//the defender didn't answer before AcceptBy
+	Unanswered = 3
+)
+
+// OutcomeCancelled is the Outcome of a challenge withdrawn with !cancel. It's closed without a
+// winner and never counts towards anyone's score
+const OutcomeCancelled = 3
 
 type ScoreboardTableEntryStruct struct {
+	GuildID              string `db:"GuildID"`
 	UserID               string `db:"UserID"`
 	Username             string `db:"Username"`
 	TotalChallengeWins   int    `db:"TotalChallengeWins"`
@@ -49,15 +138,34 @@ type ScoreboardTableEntryStruct struct {
 	FailedChallenges     int    `db:"FailedChallenges"`
 	SuccessfulDefenses   int    `db:"SuccessfulDefenses"`
 	FailedDefenses       int    `db:"FailedDefenses"`
+	Rating               int    `db:"Rating"`
+	CurrentWinStreak     int    `db:"CurrentWinStreak"`
+	//wins in a row up to now, a loss or tie starts it over
+	BestWinStreak        int `db:"BestWinStreak"`
+	CurrentDefenseStreak int `db:"CurrentDefenseStreak"`
+	//wins in a row as defender, a loss or tie as defender starts it over
+	BestDefenseStreak int `db:"BestDefenseStreak"`
+}
+
+// RatingHistoryEntryStruct is one participant's rating change from one challenge
+type RatingHistoryEntryStruct struct {
+	GuildID      string `db:"GuildID"`
+	MessageID    string `db:"MessageID"`
+	UserID       string `db:"UserID"`
+	RatingBefore int    `db:"RatingBefore"`
+	RatingAfter  int    `db:"RatingAfter"`
 }
 
 type VotingRecordEntryStruct struct {
+	GuildID         string `db:"GuildID"`
 	UserID          string `db:"UserID"`
 	MessageID       string `db:"MessageID"`
 	ChallengerVotes int    `db:"ChallengerVotes"`
 	DefenderVotes   int    `db:"DefenderVotes"`
 	AbstainVotes    int    `db:"AbstainVotes"`
 	StopVotes       int    `db:"StopVotes"`
+	AbstainedWith   Vote   `db:"AbstainedWith"`
+	//the reaction AbstainVotes was cast with, see abstainedWith
 }
 
 type VotesStruct struct {
@@ -67,48 +175,32 @@ type VotesStruct struct {
 	StopVotes       int `db:"StopVotes"`
 }
 
-// CreateChallengeTable this table stores values for challenge votes
-func CreateChallengeTable(db *sqlx.DB) error {
-	query := "CREATE TABLE IF NOT EXISTS challengeTable(MessageID string primary key, ChallengerID text, ChallengerName text, DefenderID text, DefenderName text, ChallengerVotes int, DefenderVotes int, AbstainVotes int, StopVotes int, Outcome int)"
-	ctx, cancelFunc := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancelFunc()
-	res, err := db.ExecContext(ctx, query)
-	if err != nil {
-		oops(err, "ExecContext")
-		return err
-	}
-	rows, err := res.RowsAffected()
-	if err != nil {
-		oops(err, "RowsAffected")
-		return err
-	}
-	rowsAffected(rows, "creating challenge table")
-	return nil
-}
-
-func insertChallengeRow(db *sqlx.DB, row ChallengeTableEntryStruct) {
-	query := "INSERT INTO challengeTable (MessageID, ChallengerID, ChallengerName, DefenderID, DefenderName, ChallengerVotes, DefenderVotes, AbstainVotes, StopVotes, Outcome) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)"
-	stmt, err := db.Prepare(query)
+func insertChallengeRow(db dbtx, row ChallengeTableEntryStruct) error {
+	query := "INSERT INTO challengeTable (GuildID, ChannelID, MessageID, ChallengerID, ChallengerName, DefenderID, DefenderName, ChallengerVotes, DefenderVotes, AbstainVotes, StopVotes, Outcome, Deadline, Status, Statement, CreatedAt, StatementMessageID, ClosedAt, Acceptance, AcceptBy) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)"
+	stmt, err := db.Prepare(db.Rebind(query))
 	if err != nil {
 		oops(err, "prepare insertChallengeRow")
-		return
+		return err
 	}
-	res, err := stmt.Exec(row.MessageID, row.ChallengerID, row.ChallengerName, row.DefenderID, row.DefenderName, row.ChallengerVotes, row.DefenderVotes, row.AbstainVotes, row.StopVotes, row.Outcome)
+	defer stmt.Close()
+	res, err := stmt.Exec(row.GuildID, row.ChannelID, row.MessageID, row.ChallengerID, row.ChallengerName, row.DefenderID, row.DefenderName, row.ChallengerVotes, row.DefenderVotes, row.AbstainVotes, row.StopVotes, row.Outcome, row.Deadline, row.Status, row.Statement, row.CreatedAt, row.StatementMessageID, row.ClosedAt, row.Acceptance, row.AcceptBy)
 	if err != nil {
 		oops(err, "execute insertChallengeRow")
-		return
+		return err
 	}
 	rows, err := res.RowsAffected()
 	if err != nil {
 		oops(err, "RowsAffected")
-		return
+		return err
 	}
 	rowsAffected(rows, "inserting challenge row")
-	return
+	return nil
 }
 
-func initChallengeTableEntry(messageID string, authorUserID string, authorUsername string, referencedAuthorID string, referencedAuthorName string) ChallengeTableEntryStruct {
+func initChallengeTableEntry(guildID string, channelID string, messageID string, authorUserID string, authorUsername string, referencedAuthorID string, referencedAuthorName string) ChallengeTableEntryStruct {
 	ChallengeTableEntry := ChallengeTableEntryStruct{
+		GuildID:         guildID,
+		ChannelID:       channelID,
 		MessageID:       messageID,
 		ChallengerID:    authorUserID,
 		ChallengerName:  authorUsername,
@@ -119,148 +211,185 @@ func initChallengeTableEntry(messageID string, authorUserID string, authorUserna
 		AbstainVotes:    0,
 		StopVotes:       0,
 		Outcome:         0,
+		Deadline:        0,
+		Status:          ChallengeOpen,
 	}
 	return ChallengeTableEntry
 }
 
-func selectChallengeRow(db *sqlx.DB, MessageID string) (ChallengeTableEntryStruct, error) {
+const challengeColumns = "GuildID, ChannelID, MessageID, ChallengerID, ChallengerName, DefenderID, DefenderName, ChallengerVotes, DefenderVotes, AbstainVotes, StopVotes, Outcome, Deadline, Status, Statement, CreatedAt, StatementMessageID, ClosedAt, Acceptance, AcceptBy"
+
+func selectChallengeRow(db dbtx, GuildID string, MessageID string) (ChallengeTableEntryStruct, error) {
 	challengeRow := ChallengeTableEntryStruct{}
-	err := db.Get(&challengeRow, "SELECT MessageID, ChallengerID, ChallengerName, DefenderID, DefenderName, ChallengerVotes, DefenderVotes, AbstainVotes, StopVotes, Outcome FROM challengeTable WHERE MessageID = ?", MessageID)
+	err := db.Get(&challengeRow, db.Rebind("SELECT "+challengeColumns+" FROM challengeTable WHERE GuildID = ? AND MessageID = ?"), GuildID, MessageID)
 	return challengeRow, err
 }
 
-func selectVotes(db *sqlx.DB, MessageID string) (VotesStruct, error) {
+func selectVotes(db dbtx, GuildID string, MessageID string) (VotesStruct, error) {
 	votes := VotesStruct{}
-	err := db.Get(&votes, "SELECT ChallengerVotes, DefenderVotes, AbstainVotes, StopVotes FROM challengeTable WHERE MessageID = ?", MessageID)
+	err := db.Get(&votes, db.Rebind("SELECT ChallengerVotes, DefenderVotes, AbstainVotes, StopVotes FROM challengeTable WHERE GuildID = ? AND MessageID = ?"), GuildID, MessageID)
 	return votes, err
 }
 
-func updateVotes(db *sqlx.DB, MessageID string, votes VotesStruct) {
-	query := "UPDATE challengeTable SET ChallengerVotes = ?, DefenderVotes = ?, AbstainVotes = ?, StopVotes = ? WHERE MessageID = ?"
-	stmt, err := db.Prepare(query)
+func updateVotes(db dbtx, GuildID string, MessageID string, votes VotesStruct) error {
+	query := "UPDATE challengeTable SET ChallengerVotes = ?, DefenderVotes = ?, AbstainVotes = ?, StopVotes = ? WHERE GuildID = ? AND MessageID = ?"
+	stmt, err := db.Prepare(db.Rebind(query))
 	if err != nil {
 		oops(err, "prepare updateVotes")
-		return
+		return err
 	}
-	res, err := stmt.Exec(votes.ChallengerVotes, votes.DefenderVotes, votes.AbstainVotes, votes.StopVotes, MessageID)
+	defer stmt.Close()
+	res, err := stmt.Exec(votes.ChallengerVotes, votes.DefenderVotes, votes.AbstainVotes, votes.StopVotes, GuildID, MessageID)
 	if err != nil {
 		oops(err, "execute updateVotes")
-		return
+		return err
 	}
 	rows, err := res.RowsAffected()
 	if err != nil {
 		oops(err, "RowsAffected")
-		return
+		return err
 	}
 	rowsAffected(rows, "updating votes")
-	return
+	return nil
 }
 
-func updateOutcome(db *sqlx.DB, MessageID string, votes VotesStruct) {
-	query := "UPDATE challengeTable SET Outcome = ? WHERE MessageID = ?"
-	stmt, err := db.Prepare(query)
+func updateOutcome(db dbtx, GuildID string, MessageID string, votes VotesStruct) error {
+	query := "UPDATE challengeTable SET Outcome = ? WHERE GuildID = ? AND MessageID = ?"
+	stmt, err := db.Prepare(db.Rebind(query))
 	if err != nil {
 		oops(err, "prepare updateOutcome")
-		return
+		return err
 	}
-	var res sql.Result
-	if votes.ChallengerVotes > votes.DefenderVotes {
-		res, err = stmt.Exec(1, MessageID)
+	defer stmt.Close()
+	res, err := stmt.Exec(outcomeOf(votes), GuildID, MessageID)
+	if err != nil {
+		oops(err, "execute updateOutcome")
+		return err
 	}
-	if votes.ChallengerVotes < votes.DefenderVotes {
-		res, err = stmt.Exec(2, MessageID)
+	rows, err := res.RowsAffected()
+	if err != nil {
+		oops(err, "RowsAffected")
+		return err
 	}
-	if votes.ChallengerVotes == votes.DefenderVotes {
-		res, err = stmt.Exec(0, MessageID)
+	rowsAffected(rows, "updating outcome")
+	return nil
+}
+
+// closeChallengeRow marks an open challenge closed as of now, it affects no rows if the challenge was already closed
+func closeChallengeRow(db dbtx, GuildID string, MessageID string) (int64, error) {
+	query := "UPDATE challengeTable SET Status = ?, ClosedAt = ? WHERE GuildID = ? AND MessageID = ? AND Status = ?"
+	stmt, err := db.Prepare(db.Rebind(query))
+	if err != nil {
+		oops(err, "prepare closeChallengeRow")
+		return 0, err
 	}
+	defer stmt.Close()
+	res, err := stmt.Exec(ChallengeClosed, time.Now().Unix(), GuildID, MessageID, ChallengeOpen)
 	if err != nil {
-		oops(err, "execute updateOutcome")
-		return
+		oops(err, "execute closeChallengeRow")
+		return 0, err
 	}
 	rows, err := res.RowsAffected()
 	if err != nil {
 		oops(err, "RowsAffected")
-		return
+		return 0, err
 	}
-	rowsAffected(rows, "updating outcome")
-	return
+	rowsAffected(rows, "closing challenge")
+	return rows, nil
 }
 
-// CreateScoreboardTable this table stores results of challenge votes
-func CreateScoreboardTable(db *sqlx.DB) error {
-	query := "CREATE TABLE IF NOT EXISTS scoreboardTable(UserID text primary key, Username text, TotalChallengeWins int, TotalChallengeLosses int, TotalChallengeTies int, TotalChallenges int, SuccessfulChallenges int, FailedChallenges int, SuccessfulDefenses int, FailedDefenses int)"
-	ctx, cancelFunc := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancelFunc()
-	res, err := db.ExecContext(ctx, query)
+// cancelChallengeRow marks an open or pending challenge cancelled as of now. Unless evenWithVotes it only
+// affects a challenge nobody has voted on yet
+func cancelChallengeRow(db dbtx, GuildID string, MessageID string, evenWithVotes bool) (int64, error) {
+	query := "UPDATE challengeTable SET Status = ?, Outcome = ?, ClosedAt = ? WHERE GuildID = ? AND MessageID = ? AND Status != ?"
+	if !evenWithVotes {
+		query += " AND ChallengerVotes = 0 AND DefenderVotes = 0 AND AbstainVotes = 0 AND StopVotes = 0"
+	}
+	stmt, err := db.Prepare(db.Rebind(query))
 	if err != nil {
-		oops(err, "CreateScoreboardTable")
-		return err
+		oops(err, "prepare cancelChallengeRow")
+		return 0, err
+	}
+	defer stmt.Close()
+	res, err := stmt.Exec(ChallengeClosed, OutcomeCancelled, time.Now().Unix(), GuildID, MessageID, ChallengeClosed)
+	if err != nil {
+		oops(err, "execute cancelChallengeRow")
+		return 0, err
 	}
 	rows, err := res.RowsAffected()
 	if err != nil {
 		oops(err, "RowsAffected")
-		return err
+		return 0, err
 	}
-	rowsAffected(rows, "creating scoreboard table")
-	return nil
+	rowsAffected(rows, "cancelling challenge")
+	return rows, nil
 }
 
-func insertScoreboardRow(db *sqlx.DB, row ScoreboardTableEntryStruct) {
-	query := "INSERT OR IGNORE INTO scoreboardTable (UserID, Username, TotalChallengeWins, TotalChallengeLosses, TotalChallengeTies, TotalChallenges, SuccessfulChallenges, FailedChallenges, SuccessfulDefenses, FailedDefenses) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)"
-	stmt, err := db.Prepare(query)
+// selectExpiredChallenges finds the open challenges in every guild whose deadline is at or before now
+func selectExpiredChallenges(db dbtx, now int64) ([]ChallengeTableEntryStruct, error) {
+	challengeRows := []ChallengeTableEntryStruct{}
+	err := db.Select(&challengeRows, db.Rebind("SELECT "+challengeColumns+" FROM challengeTable WHERE Status = ? AND Deadline > 0 AND Deadline <= ? ORDER BY Deadline"), ChallengeOpen, now)
+	return challengeRows, err
+}
+
+func insertScoreboardRow(db dbtx, row ScoreboardTableEntryStruct) error {
+	query := "INSERT INTO scoreboardTable (GuildID, UserID, Username, TotalChallengeWins, TotalChallengeLosses, TotalChallengeTies, TotalChallenges, SuccessfulChallenges, FailedChallenges, SuccessfulDefenses, FailedDefenses, Rating, CurrentWinStreak, BestWinStreak, CurrentDefenseStreak, BestDefenseStreak) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?) ON CONFLICT DO NOTHING"
+	stmt, err := db.Prepare(db.Rebind(query))
 	if err != nil {
 		oops(err, "prepare insertScoreboardRow")
-		return
+		return err
 	}
-	res, err := stmt.Exec(row.UserID, row.Username, row.TotalChallengeWins, row.TotalChallengeLosses, row.TotalChallengeTies, row.TotalChallenges, row.SuccessfulChallenges, row.FailedChallenges, row.SuccessfulDefenses, row.FailedDefenses)
+	defer stmt.Close()
+	res, err := stmt.Exec(row.GuildID, row.UserID, row.Username, row.TotalChallengeWins, row.TotalChallengeLosses, row.TotalChallengeTies, row.TotalChallenges, row.SuccessfulChallenges, row.FailedChallenges, row.SuccessfulDefenses, row.FailedDefenses, row.Rating, row.CurrentWinStreak, row.BestWinStreak, row.CurrentDefenseStreak, row.BestDefenseStreak)
 	if err != nil {
 		oops(err, "execute insertScoreboardRow")
-		return
+		return err
 	}
 	rows, err := res.RowsAffected()
 	if err != nil {
 		oops(err, "RowsAffected")
-		return
+		return err
 	}
 	rowsAffected(rows, "inserting scoreboard row")
-	return
+	return nil
 }
 
-func initScoreBoardRow(userID string, username string) ScoreboardTableEntryStruct {
-	scoreboardTableEntry := ScoreboardTableEntryStruct{userID, username, 0, 0, 0, 0, 0, 0, 0, 0}
+func initScoreBoardRow(guildID string, userID string, username string) ScoreboardTableEntryStruct {
+	scoreboardTableEntry := ScoreboardTableEntryStruct{guildID, userID, username, 0, 0, 0, 0, 0, 0, 0, 0, initialRating, 0, 0, 0, 0}
 	return scoreboardTableEntry
 }
 
-func selectScoreboardRow(db *sqlx.DB, UserID string) (ScoreboardTableEntryStruct, error) {
+func selectScoreboardRow(db dbtx, GuildID string, UserID string) (ScoreboardTableEntryStruct, error) {
 	scoreboardRow := ScoreboardTableEntryStruct{}
-	err := db.Get(&scoreboardRow, "SELECT UserID, Username, TotalChallengeWins, TotalChallengeLosses, TotalChallengeTies, TotalChallenges, SuccessfulChallenges, FailedChallenges, SuccessfulDefenses, FailedDefenses FROM scoreboardTable WHERE UserID = ?", UserID)
+	err := db.Get(&scoreboardRow, db.Rebind("SELECT GuildID, UserID, Username, TotalChallengeWins, TotalChallengeLosses, TotalChallengeTies, TotalChallenges, SuccessfulChallenges, FailedChallenges, SuccessfulDefenses, FailedDefenses, Rating, CurrentWinStreak, BestWinStreak, CurrentDefenseStreak, BestDefenseStreak FROM scoreboardTable WHERE GuildID = ? AND UserID = ?"), GuildID, UserID)
 	return scoreboardRow, err
 }
 
-func updateScoreboard(db *sqlx.DB, scoreboardEntry ScoreboardTableEntryStruct) {
-	query := "UPDATE scoreboardTable SET UserID = ?, Username = ?, TotalChallengeWins = ?, TotalChallengeLosses = ?, TotalChallengeTies = ?, TotalChallenges = ?, SuccessfulChallenges = ?, FailedChallenges = ?, SuccessfulDefenses = ?, FailedDefenses = ? WHERE UserID = ?"
-	stmt, err := db.Prepare(query)
+func updateScoreboard(db dbtx, scoreboardEntry ScoreboardTableEntryStruct) error {
+	query := "UPDATE scoreboardTable SET UserID = ?, Username = ?, TotalChallengeWins = ?, TotalChallengeLosses = ?, TotalChallengeTies = ?, TotalChallenges = ?, SuccessfulChallenges = ?, FailedChallenges = ?, SuccessfulDefenses = ?, FailedDefenses = ?, Rating = ?, CurrentWinStreak = ?, BestWinStreak = ?, CurrentDefenseStreak = ?, BestDefenseStreak = ? WHERE GuildID = ? AND UserID = ?"
+	stmt, err := db.Prepare(db.Rebind(query))
 	if err != nil {
 		oops(err, "prepare updateScoreboard")
-		return
+		return err
 	}
-	res, err := stmt.Exec(scoreboardEntry.UserID, scoreboardEntry.Username, scoreboardEntry.TotalChallengeWins, scoreboardEntry.TotalChallengeLosses, scoreboardEntry.TotalChallengeTies, scoreboardEntry.TotalChallenges, scoreboardEntry.SuccessfulChallenges, scoreboardEntry.FailedChallenges, scoreboardEntry.SuccessfulDefenses, scoreboardEntry.FailedDefenses, scoreboardEntry.UserID)
+	defer stmt.Close()
+	res, err := stmt.Exec(scoreboardEntry.UserID, scoreboardEntry.Username, scoreboardEntry.TotalChallengeWins, scoreboardEntry.TotalChallengeLosses, scoreboardEntry.TotalChallengeTies, scoreboardEntry.TotalChallenges, scoreboardEntry.SuccessfulChallenges, scoreboardEntry.FailedChallenges, scoreboardEntry.SuccessfulDefenses, scoreboardEntry.FailedDefenses, scoreboardEntry.Rating, scoreboardEntry.CurrentWinStreak, scoreboardEntry.BestWinStreak, scoreboardEntry.CurrentDefenseStreak, scoreboardEntry.BestDefenseStreak, scoreboardEntry.GuildID, scoreboardEntry.UserID)
 	if err != nil {
 		oops(err, "execute updateScoreboard")
-		return
+		return err
 	}
 	rows, err := res.RowsAffected()
 	if err != nil {
 		oops(err, "RowsAffected")
-		return
+		return err
 	}
 	rowsAffected(rows, "updating scoreboard")
-	return
+	return nil
 }
 
-func userInScoreboard(db *sqlx.DB, UserID string) bool {
-	query := "SELECT UserID FROM scoreboardTable WHERE UserID = ?"
-	row := db.QueryRow(query, UserID)
+func userInScoreboard(db dbtx, GuildID string, UserID string) bool {
+	query := "SELECT UserID FROM scoreboardTable WHERE GuildID = ? AND UserID = ?"
+	row := db.QueryRow(db.Rebind(query), GuildID, UserID)
 	temp := ""
 	err := row.Scan(&temp)
 	if err != nil {
@@ -272,6 +401,45 @@ func userInScoreboard(db *sqlx.DB, UserID string) bool {
 	return false
 }
 
+// selectLeaderboard returns one page of a guild's scoreboard, best first, leaving out anyone
+// whose challenges haven't finished yet
+func selectLeaderboard(db dbtx, GuildID string, sort LeaderboardSort, limit int, offset int) ([]ScoreboardTableEntryStruct, error) {
+	rows := []ScoreboardTableEntryStruct{}
+	query := "SELECT GuildID, UserID, Username, TotalChallengeWins, TotalChallengeLosses, TotalChallengeTies, TotalChallenges, SuccessfulChallenges, FailedChallenges, SuccessfulDefenses, FailedDefenses, Rating, CurrentWinStreak, BestWinStreak, CurrentDefenseStreak, BestDefenseStreak FROM scoreboardTable WHERE GuildID = ? AND TotalChallenges > 0 ORDER BY " + sort.orderBy() + " LIMIT ? OFFSET ?"
+	err := db.Select(&rows, db.Rebind(query), GuildID, limit, offset)
+	return rows, err
+}
+
+// selectChallengeHistory returns one page of the challenges a user took part in on either side, newest first
+func selectChallengeHistory(db dbtx, GuildID string, UserID string, limit int, offset int) ([]ChallengeTableEntryStruct, error) {
+	challengeRows := []ChallengeTableEntryStruct{}
+	query := "SELECT " + challengeColumns + " FROM challengeTable WHERE GuildID = ? AND (ChallengerID = ? OR DefenderID = ?) ORDER BY CreatedAt DESC, MessageID DESC LIMIT ? OFFSET ?"
+	err := db.Select(&challengeRows, db.Rebind(query), GuildID, UserID, UserID, limit, offset)
+	return challengeRows, err
+}
+
+// countChallengeHistory is how many challenges selectChallengeHistory can return for a user
+func countChallengeHistory(db dbtx, GuildID string, UserID string) (int, error) {
+	count := 0
+	err := db.Get(&count, db.Rebind("SELECT COUNT(*) FROM challengeTable WHERE GuildID = ? AND (ChallengerID = ? OR DefenderID = ?)"), GuildID, UserID, UserID)
+	return count, err
+}
+
+// selectHeadToHead returns the finished challenges between two users, oldest first, cancelled ones are left out
+func selectHeadToHead(db dbtx, GuildID string, UserA string, UserB string) ([]ChallengeTableEntryStruct, error) {
+	challengeRows := []ChallengeTableEntryStruct{}
+	query := "SELECT " + challengeColumns + " FROM challengeTable WHERE GuildID = ? AND Status = ? AND Outcome != ? AND ((ChallengerID = ? AND DefenderID = ?) OR (ChallengerID = ? AND DefenderID = ?)) ORDER BY CreatedAt, MessageID"
+	err := db.Select(&challengeRows, db.Rebind(query), GuildID, ChallengeClosed, OutcomeCancelled, UserA, UserB, UserB, UserA)
+	return challengeRows, err
+}
+
+// countLeaderboard is how many users selectLeaderboard can return for a guild
+func countLeaderboard(db dbtx, GuildID string) (int, error) {
+	count := 0
+	err := db.Get(&count, db.Rebind("SELECT COUNT(*) FROM scoreboardTable WHERE GuildID = ? AND TotalChallenges > 0"), GuildID)
+	return count, err
+}
+
 func winnerID(score ChallengeTableEntryStruct) string {
 	if score.Outcome == 1 {
 		return score.ChallengerID
@@ -283,100 +451,91 @@ func winnerID(score ChallengeTableEntryStruct) string {
 }
 
 func scoreboardToString(s ScoreboardTableEntryStruct) string {
-	score := "`" + s.Username + "\nTotal challenge wins: " + strconv.Itoa(s.TotalChallengeWins) + "\nTotal challenge losses: " + strconv.Itoa(s.TotalChallengeLosses) + "\nTotal challenge ties: " + strconv.Itoa(s.TotalChallengeTies) + "\nTotal challenges: " + strconv.Itoa(s.TotalChallenges) + "\nWins as challenger: " + strconv.Itoa(s.SuccessfulChallenges) + "\nLosses as challenger: " + strconv.Itoa(s.FailedChallenges) + "\nWins as defender: " + strconv.Itoa(s.SuccessfulDefenses) + "\nLosses as defender: " + strconv.Itoa(s.FailedDefenses) + "`"
+	score := "`" + s.Username + "\nTotal challenge wins: " + strconv.Itoa(s.TotalChallengeWins) + "\nTotal challenge losses: " + strconv.Itoa(s.TotalChallengeLosses) + "\nTotal challenge ties: " + strconv.Itoa(s.TotalChallengeTies) + "\nTotal challenges: " + strconv.Itoa(s.TotalChallenges) + "\nWins as challenger: " + strconv.Itoa(s.SuccessfulChallenges) + "\nLosses as challenger: " + strconv.Itoa(s.FailedChallenges) + "\nWins as defender: " + strconv.Itoa(s.SuccessfulDefenses) + "\nLosses as defender: " + strconv.Itoa(s.FailedDefenses) + "\nRating: " + strconv.Itoa(s.Rating) + "\nWin streak: " + strconv.Itoa(s.CurrentWinStreak) + " (best " + strconv.Itoa(s.BestWinStreak) + ")\nDefense streak: " + strconv.Itoa(s.CurrentDefenseStreak) + " (best " + strconv.Itoa(s.BestDefenseStreak) + ")`"
 	return score
 }
 
-// CreateVotingRecord this table stores users' votes on each challenge
-func CreateVotingRecord(db *sqlx.DB) error {
-	query := "CREATE TABLE IF NOT EXISTS votingRecord(UserID text, MessageID text, ChallengerVotes int, DefenderVotes int, AbstainVotes int, StopVotes int, PRIMARY KEY (UserID, MessageID))"
-	ctx, cancelFunc := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancelFunc()
-	res, err := db.ExecContext(ctx, query)
-	if err != nil {
-		oops(err, "execute createVotingRecord")
-		return err
-	}
-	rows, err := res.RowsAffected()
-	if err != nil {
-		oops(err, "RowsAffected")
-		return err
-	}
-	rowsAffected(rows, "creating voting record")
-	return nil
-}
-
-func removeVotingRecordRow(db *sqlx.DB, row VotingRecordEntryStruct) {
-	query := "DELETE FROM votingRecord WHERE MessageID = ? AND UserID = ?"
-	stmt, err := db.Prepare(query)
+func removeVotingRecordRow(db dbtx, row VotingRecordEntryStruct) error {
+	query := "DELETE FROM votingRecord WHERE GuildID = ? AND MessageID = ? AND UserID = ?"
+	stmt, err := db.Prepare(db.Rebind(query))
 	if err != nil {
 		oops(err, "prepare removeVotingRecordRow")
-		return
+		return err
 	}
-	res, err := stmt.Exec(row.MessageID, row.UserID)
+	defer stmt.Close()
+	res, err := stmt.Exec(row.GuildID, row.MessageID, row.UserID)
 	if err != nil {
 		oops(err, "execute removeVotingRecordRow")
-		return
+		return err
 	}
 	rows, err := res.RowsAffected()
 	if err != nil {
 		oops(err, "RowsAffected")
-		return
+		return err
 	}
 	rowsAffected(rows, "removing voting record row")
-	return
+	return nil
 }
 
-func insertVotingRecordRow(db *sqlx.DB, row VotingRecordEntryStruct) {
-	query := "INSERT OR IGNORE INTO votingRecord (UserID, MessageID, ChallengerVotes, DefenderVotes, AbstainVotes, StopVotes) VALUES (?, ?, ?, ?, ?, ?)"
-	stmt, err := db.Prepare(query)
+func insertVotingRecordRow(db dbtx, row VotingRecordEntryStruct) error {
+	query := "INSERT INTO votingRecord (GuildID, UserID, MessageID, ChallengerVotes, DefenderVotes, AbstainVotes, StopVotes, AbstainedWith) VALUES (?, ?, ?, ?, ?, ?, ?, ?) ON CONFLICT DO NOTHING"
+	stmt, err := db.Prepare(db.Rebind(query))
 	if err != nil {
 		oops(err, "prepare insertVotingRecordRow")
-		return
+		return err
 	}
-	res, err := stmt.Exec(row.UserID, row.MessageID, row.ChallengerVotes, row.DefenderVotes, row.AbstainVotes, row.StopVotes)
+	defer stmt.Close()
+	res, err := stmt.Exec(row.GuildID, row.UserID, row.MessageID, row.ChallengerVotes, row.DefenderVotes, row.AbstainVotes, row.StopVotes, row.AbstainedWith)
 	if err != nil {
 		oops(err, "execute insertVotingRecordRow")
-		return
+		return err
 	}
 	rows, err := res.RowsAffected()
 	if err != nil {
 		oops(err, "RowsAffected")
-		return
+		return err
 	}
 	rowsAffected(rows, "inserting voting record row")
-	return
+	return nil
 }
 
-func selectVotingRecordRow(db *sqlx.DB, UserID string, MessageID string) (VotingRecordEntryStruct, error) {
+func selectVotingRecordRow(db dbtx, GuildID string, UserID string, MessageID string) (VotingRecordEntryStruct, error) {
 	votingRecordRow := VotingRecordEntryStruct{}
-	err := db.Get(&votingRecordRow, "SELECT UserID, MessageID, ChallengerVotes, DefenderVotes, AbstainVotes, StopVotes FROM votingRecord WHERE UserID = ? AND MessageID = ?", UserID, MessageID)
+	err := db.Get(&votingRecordRow, db.Rebind("SELECT GuildID, UserID, MessageID, ChallengerVotes, DefenderVotes, AbstainVotes, StopVotes, AbstainedWith FROM votingRecord WHERE GuildID = ? AND UserID = ? AND MessageID = ?"), GuildID, UserID, MessageID)
 	return votingRecordRow, err
 }
 
-func updateVotingRecord(db *sqlx.DB, VotingRecordEntry VotingRecordEntryStruct) {
-	query := "UPDATE votingRecord SET ChallengerVotes = ?, DefenderVotes = ?, AbstainVotes = ?, StopVotes = ? WHERE MessageID = ? AND UserID = ?"
-	stmt, err := db.Prepare(query)
+// selectVotingRecords returns everyone's voting record for a challenge, ordered by user
+func selectVotingRecords(db dbtx, GuildID string, MessageID string) ([]VotingRecordEntryStruct, error) {
+	votingRecordRows := []VotingRecordEntryStruct{}
+	err := db.Select(&votingRecordRows, db.Rebind("SELECT GuildID, UserID, MessageID, ChallengerVotes, DefenderVotes, AbstainVotes, StopVotes, AbstainedWith FROM votingRecord WHERE GuildID = ? AND MessageID = ? ORDER BY UserID"), GuildID, MessageID)
+	return votingRecordRows, err
+}
+
+func updateVotingRecord(db dbtx, VotingRecordEntry VotingRecordEntryStruct) error {
+	query := "UPDATE votingRecord SET ChallengerVotes = ?, DefenderVotes = ?, AbstainVotes = ?, StopVotes = ?, AbstainedWith = ? WHERE GuildID = ? AND MessageID = ? AND UserID = ?"
+	stmt, err := db.Prepare(db.Rebind(query))
 	if err != nil {
 		oops(err, "prepare updateVotingRecord")
-		return
+		return err
 	}
-	res, err := stmt.Exec(VotingRecordEntry.ChallengerVotes, VotingRecordEntry.DefenderVotes, VotingRecordEntry.AbstainVotes, VotingRecordEntry.StopVotes, VotingRecordEntry.MessageID, VotingRecordEntry.UserID)
+	defer stmt.Close()
+	res, err := stmt.Exec(VotingRecordEntry.ChallengerVotes, VotingRecordEntry.DefenderVotes, VotingRecordEntry.AbstainVotes, VotingRecordEntry.StopVotes, VotingRecordEntry.AbstainedWith, VotingRecordEntry.GuildID, VotingRecordEntry.MessageID, VotingRecordEntry.UserID)
 	if err != nil {
 		oops(err, "execute updateVotingRecord")
-		return
+		return err
 	}
 	rows, err := res.RowsAffected()
 	if err != nil {
 		oops(err, "RowsAffected")
-		return
+		return err
 	}
 	rowsAffected(rows, "updating voting record")
-	return
+	return nil
 }
 
-func hasVotedBlue(db *sqlx.DB, VotingRecordEntry VotingRecordEntryStruct) bool {
-	rec, err := selectVotingRecordRow(db, VotingRecordEntry.UserID, VotingRecordEntry.MessageID)
+func hasVotedBlue(db dbtx, VotingRecordEntry VotingRecordEntryStruct) bool {
+	rec, err := selectVotingRecordRow(db, VotingRecordEntry.GuildID, VotingRecordEntry.UserID, VotingRecordEntry.MessageID)
 	if err != nil {
 		return false
 	}
@@ -386,8 +545,8 @@ func hasVotedBlue(db *sqlx.DB, VotingRecordEntry VotingRecordEntryStruct) bool {
 	return false
 }
 
-func hasVotedYellow(db *sqlx.DB, VotingRecordEntry VotingRecordEntryStruct) bool {
-	rec, err := selectVotingRecordRow(db, VotingRecordEntry.UserID, VotingRecordEntry.MessageID)
+func hasVotedYellow(db dbtx, VotingRecordEntry VotingRecordEntryStruct) bool {
+	rec, err := selectVotingRecordRow(db, VotingRecordEntry.GuildID, VotingRecordEntry.UserID, VotingRecordEntry.MessageID)
 	if err != nil {
 		return false
 	}
@@ -397,8 +556,8 @@ func hasVotedYellow(db *sqlx.DB, VotingRecordEntry VotingRecordEntryStruct) bool
 	return false
 }
 
-func hasVotedRed(db *sqlx.DB, VotingRecordEntry VotingRecordEntryStruct) bool {
-	rec, err := selectVotingRecordRow(db, VotingRecordEntry.UserID, VotingRecordEntry.MessageID)
+func hasVotedRed(db dbtx, VotingRecordEntry VotingRecordEntryStruct) bool {
+	rec, err := selectVotingRecordRow(db, VotingRecordEntry.GuildID, VotingRecordEntry.UserID, VotingRecordEntry.MessageID)
 	if err != nil {
 		return false
 	}
@@ -408,8 +567,8 @@ func hasVotedRed(db *sqlx.DB, VotingRecordEntry VotingRecordEntryStruct) bool {
 	return false
 }
 
-func hasVotedStop(db *sqlx.DB, VotingRecordEntry VotingRecordEntryStruct) bool {
-	rec, err := selectVotingRecordRow(db, VotingRecordEntry.UserID, VotingRecordEntry.MessageID)
+func hasVotedStop(db dbtx, VotingRecordEntry VotingRecordEntryStruct) bool {
+	rec, err := selectVotingRecordRow(db, VotingRecordEntry.GuildID, VotingRecordEntry.UserID, VotingRecordEntry.MessageID)
 	if err != nil {
 		return false
 	}
@@ -419,9 +578,9 @@ func hasVotedStop(db *sqlx.DB, VotingRecordEntry VotingRecordEntryStruct) bool {
 	return false
 }
 
-func checkStopVotes(db *sqlx.DB, MessageID string) int {
+func checkStopVotes(db dbtx, GuildID string, MessageID string) int {
 	stopVotes := -1
-	challengeRow, err := selectChallengeRow(db, MessageID)
+	challengeRow, err := selectChallengeRow(db, GuildID, MessageID)
 	if err != nil {
 		oops(err, "checkStopVotes")
 		return stopVotes
@@ -430,51 +589,163 @@ func checkStopVotes(db *sqlx.DB, MessageID string) int {
 	return stopVotes
 }
 
-func pushScore(db *sqlx.DB, challengeEntry ChallengeTableEntryStruct) {
-	challengerID := challengeEntry.ChallengerID
-	defenderID := challengeEntry.DefenderID
-	challengerScoreboardRow, err := selectScoreboardRow(db, challengerID)
+// pushScore scores a closed challenge for both participants and saves the achievements it unlocked
+// for them, checked against the rows it just wrote
+func pushScore(db dbtx, challengeEntry ChallengeTableEntryStruct, achievements []Achievement) error {
+	err := lockScoreboardRows(db, challengeEntry.GuildID, challengeEntry.ChallengerID, challengeEntry.DefenderID)
+	if err != nil {
+		return err
+	}
+	challengerScoreboardRow, err := selectScoreboardRow(db, challengeEntry.GuildID, challengeEntry.ChallengerID)
 	if err != nil {
 		oops(err, "selectScoreboardRow")
+		return err
 	}
-	defenderScoreboardRow, err := selectScoreboardRow(db, defenderID)
+	defenderScoreboardRow, err := selectScoreboardRow(db, challengeEntry.GuildID, challengeEntry.DefenderID)
 	if err != nil {
 		oops(err, "selectScoreboardRow")
+		return err
+	}
+	history := []RatingHistoryEntryStruct{
+		{challengeEntry.GuildID, challengeEntry.MessageID, challengeEntry.ChallengerID, challengerScoreboardRow.Rating, 0},
+		{challengeEntry.GuildID, challengeEntry.MessageID, challengeEntry.DefenderID, defenderScoreboardRow.Rating, 0},
+	}
+	applyOutcome(&challengerScoreboardRow, &defenderScoreboardRow, challengeEntry.Outcome)
+	history[0].RatingAfter = challengerScoreboardRow.Rating
+	history[1].RatingAfter = defenderScoreboardRow.Rating
+	err = updateScoreboard(db, challengerScoreboardRow)
+	if err != nil {
+		return err
+	}
+	err = updateScoreboard(db, defenderScoreboardRow)
+	if err != nil {
+		return err
+	}
+	for _, row := range history {
+		err = insertRatingHistoryRow(db, row)
+		if err != nil {
+			return err
+		}
+	}
+	rows := []ScoreboardTableEntryStruct{challengerScoreboardRow, defenderScoreboardRow}
+	for _, row := range reachedAchievements(achievements, challengeEntry, rows, history, time.Now().Unix()) {
+		_, err = insertAchievementRow(db, row)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// lockScoreboardRows touches both players' scoreboard rows so other closes and season resets for
+// them wait until we commit. Rows are locked in UserID order so two closes can't deadlock
+func lockScoreboardRows(db dbtx, GuildID string, UserIDs ...string) error {
+	sort.Strings(UserIDs)
+	for _, UserID := range UserIDs {
+		_, err := db.Exec(db.Rebind("UPDATE scoreboardTable SET Rating = Rating WHERE GuildID = ? AND UserID = ?"), GuildID, UserID)
+		if err != nil {
+			oops(err, "lock scoreboard row")
+			return err
+		}
+	}
+	return nil
+}
+
+func insertRatingHistoryRow(db dbtx, row RatingHistoryEntryStruct) error {
+	query := "INSERT INTO ratingHistory (GuildID, MessageID, UserID, RatingBefore, RatingAfter) VALUES (?, ?, ?, ?, ?)"
+	stmt, err := db.Prepare(db.Rebind(query))
+	if err != nil {
+		oops(err, "prepare insertRatingHistoryRow")
+		return err
+	}
+	defer stmt.Close()
+	res, err := stmt.Exec(row.GuildID, row.MessageID, row.UserID, row.RatingBefore, row.RatingAfter)
+	if err != nil {
+		oops(err, "execute insertRatingHistoryRow")
+		return err
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		oops(err, "RowsAffected")
+		return err
+	}
+	rowsAffected(rows, "inserting rating history row")
+	return nil
+}
+
+// selectRatingHistory is how a challenge changed its participants' ratings, challenger first
+func selectRatingHistory(db dbtx, GuildID string, MessageID string) ([]RatingHistoryEntryStruct, error) {
+	history := []RatingHistoryEntryStruct{}
+	err := db.Select(&history, db.Rebind("SELECT ratingHistory.GuildID, ratingHistory.MessageID, ratingHistory.UserID, RatingBefore, RatingAfter FROM ratingHistory JOIN challengeTable ON challengeTable.GuildID = ratingHistory.GuildID AND challengeTable.MessageID = ratingHistory.MessageID WHERE ratingHistory.GuildID = ? AND ratingHistory.MessageID = ? ORDER BY CASE WHEN ratingHistory.UserID = challengeTable.ChallengerID THEN 0 ELSE 1 END"), GuildID, MessageID)
+	return history, err
+}
+
+// outcomeOf works out the Outcome value for a set of votes
+func outcomeOf(votes VotesStruct) int {
+	if votes.ChallengerVotes > votes.DefenderVotes {
+		return 1
+	}
+	if votes.ChallengerVotes < votes.DefenderVotes {
+		return 2
+	}
+	return 0
+}
+
+// applyOutcome adds the result of a single challenge to both participants' scoreboard rows, ratings included
+func applyOutcome(challenger *ScoreboardTableEntryStruct, defender *ScoreboardTableEntryStruct, outcome int) {
+	if outcome == 1 {
+		challenger.SuccessfulChallenges += 1
+		challenger.TotalChallengeWins += 1
+		defender.TotalChallengeLosses += 1
+		defender.FailedDefenses += 1
+	}
+	if outcome == 2 {
+		defender.SuccessfulDefenses += 1
+		defender.TotalChallengeWins += 1
+		challenger.FailedChallenges += 1
+		challenger.TotalChallengeLosses += 1
+	}
+	if outcome == 0 {
+		challenger.TotalChallengeTies += 1
+		defender.TotalChallengeTies += 1
+	}
+	challenger.TotalChallenges += 1
+	defender.TotalChallenges += 1
+	updateStreaks(challenger, defender, outcome)
+	challenger.Rating, defender.Rating = eloRatings(challenger.Rating, defender.Rating, outcome)
+}
+
+// updateStreaks carries on the winner's streaks and starts the loser's over, a tie starts
+// both participants' win streaks and the defender's defense streak over
+func updateStreaks(challenger *ScoreboardTableEntryStruct, defender *ScoreboardTableEntryStruct, outcome int) {
+	switch outcome {
+	case 1:
+		challenger.CurrentWinStreak += 1
+		defender.CurrentWinStreak = 0
+		defender.CurrentDefenseStreak = 0
+	case 2:
+		defender.CurrentWinStreak += 1
+		defender.CurrentDefenseStreak += 1
+		challenger.CurrentWinStreak = 0
+	default:
+		challenger.CurrentWinStreak = 0
+		defender.CurrentWinStreak = 0
+		defender.CurrentDefenseStreak = 0
+	}
+	for _, row := range []*ScoreboardTableEntryStruct{challenger, defender} {
+		if row.CurrentWinStreak > row.BestWinStreak {
+			row.BestWinStreak = row.CurrentWinStreak
+		}
+		if row.CurrentDefenseStreak > row.BestDefenseStreak {
+			row.BestDefenseStreak = row.CurrentDefenseStreak
+		}
 	}
-	if challengeEntry.Outcome == 1 {
-		challengerScoreboardRow.SuccessfulChallenges += 1
-		challengerScoreboardRow.TotalChallengeWins += 1
-		challengerScoreboardRow.TotalChallenges += 1
-		defenderScoreboardRow.TotalChallengeLosses += 1
-		defenderScoreboardRow.FailedDefenses += 1
-		defenderScoreboardRow.TotalChallenges += 1
-		updateScoreboard(db, challengerScoreboardRow)
-		updateScoreboard(db, defenderScoreboardRow)
-	}
-	if challengeEntry.Outcome == 2 {
-		defenderScoreboardRow.SuccessfulDefenses += 1
-		defenderScoreboardRow.TotalChallengeWins += 1
-		defenderScoreboardRow.TotalChallenges += 1
-		challengerScoreboardRow.FailedChallenges += 1
-		challengerScoreboardRow.TotalChallengeLosses += 1
-		challengerScoreboardRow.TotalChallenges += 1
-		updateScoreboard(db, challengerScoreboardRow)
-		updateScoreboard(db, defenderScoreboardRow)
-	}
-	if challengeEntry.Outcome == 0 {
-		challengerScoreboardRow.TotalChallengeTies += 1
-		challengerScoreboardRow.TotalChallenges += 1
-		defenderScoreboardRow.TotalChallengeTies += 1
-		defenderScoreboardRow.TotalChallenges += 1
-		updateScoreboard(db, challengerScoreboardRow)
-		updateScoreboard(db, defenderScoreboardRow)
-	}
-	return
 }
 
 //print in terminal
 
 func printChallengeRow(row ChallengeTableEntryStruct) {
+	GuildID := row.GuildID
 	MessageID := row.MessageID
 	ChallengerID := row.ChallengerID
 	ChallengerName := row.ChallengerName
@@ -485,10 +756,11 @@ func printChallengeRow(row ChallengeTableEntryStruct) {
 	AbstainVotes := strconv.Itoa(row.AbstainVotes)
 	Outcome := strconv.Itoa(row.Outcome)
 	s := "-"
-	log.Println("Challenge row values: " + MessageID + s + ChallengerID + s + ChallengerName + s + DefenderID + s + DefenderName + s + ChallengerVotes + s + DefenderVotes + s + AbstainVotes + s + Outcome)
+	log.Println("Challenge row values: " + GuildID + s + MessageID + s + ChallengerID + s + ChallengerName + s + DefenderID + s + DefenderName + s + ChallengerVotes + s + DefenderVotes + s + AbstainVotes + s + Outcome)
 }
 
 func printScoreboardRow(r ScoreboardTableEntryStruct) {
+	GuildID := r.GuildID
 	UserID := r.UserID
 	Username := r.Username
 	TotalChallengeWins := strconv.Itoa(r.TotalChallengeWins)
@@ -500,5 +772,5 @@ func printScoreboardRow(r ScoreboardTableEntryStruct) {
 	SuccessfulDefenses := strconv.Itoa(r.SuccessfulDefenses)
 	FailedDefenses := strconv.Itoa(r.FailedDefenses)
 	s := "-"
-	log.Println(UserID + s + Username + s + TotalChallengeWins + s + TotalChallengeLosses + s + TotalChallengeTies + s + TotalChallenges + s + SuccessfulChallenges + s + FailedChallenges + s + SuccessfulDefenses + s + FailedDefenses)
+	log.Println(GuildID + s + UserID + s + Username + s + TotalChallengeWins + s + TotalChallengeLosses + s + TotalChallengeTies + s + TotalChallenges + s + SuccessfulChallenges + s + FailedChallenges + s + SuccessfulDefenses + s + FailedDefenses)
 }
@@ -26,7 +26,7 @@ func TestConnectToDB(t *testing.T) {
 
 func TestInitChallengeTableEntryCorrect(t *testing.T) {
 
-	actual := initChallengeTableEntry("0", "1", "Gabe", "2", "Miia")
+	actual := initChallengeTableEntry(testGuildID, testChannelID, "0", "1", "Gabe", "2", "Miia")
 	expectedChallengeID := "0"
 	expectedChallengerID := "1"
 	expectedChallengerName := "Gabe"
@@ -51,7 +51,7 @@ func TestInitChallengeTableEntryCorrect(t *testing.T) {
 
 func TestInitChallengeTableEntryError(t *testing.T) {
 
-	actual := initChallengeTableEntry("0", "1", "Gabe", "Miia", "2")
+	actual := initChallengeTableEntry(testGuildID, testChannelID, "0", "1", "Gabe", "Miia", "2")
 	expectedChallengeID := "0"
 	expectedChallengerID := "1"
 	expectedChallengerName := "Gabe"
@@ -75,7 +75,7 @@ func TestInitChallengeTableEntryError(t *testing.T) {
 }
 
 func TestInitScoreBoardRowPass(t *testing.T) {
-	actual := initScoreBoardRow("1", "Gabe")
+	actual := initScoreBoardRow(testGuildID, "1", "Gabe")
 	expectedUserID := "1"
 	expectedUserName := "Gabe"
 	if expectedUserID != actual.UserID {
@@ -87,7 +87,7 @@ func TestInitScoreBoardRowPass(t *testing.T) {
 }
 
 func TestInitScoreBoardRowFail(t *testing.T) {
-	actual := initScoreBoardRow("Gabe", "1")
+	actual := initScoreBoardRow(testGuildID, "Gabe", "1")
 	expectedUserID := "1"
 	expectedUserName := "Gabe"
 	if expectedUserID == actual.UserID {
@@ -104,14 +104,14 @@ func TestInsertChallengeRow(t *testing.T) {
 		t.Errorf("database not open")
 		return
 	}
-	err = CreateChallengeTable(db)
+	err = Migrate(db, "")
 	if err != nil {
-		oops(err, "CreateChallengeTable")
+		oops(err, "Migrate")
 		return
 	}
-	test := initChallengeTableEntry("0", "1", "Gabe", "2", "Miia")
+	test := initChallengeTableEntry(testGuildID, testChannelID, "0", "1", "Gabe", "2", "Miia")
 	insertChallengeRow(db, test)
-	actual, err := selectChallengeRow(db, "0")
+	actual, err := selectChallengeRow(db, testGuildID, "0")
 	if err != nil {
 		oops(err, "Selecting challenge row")
 		return
@@ -145,7 +145,7 @@ func TestSelectVotes(t *testing.T) {
 		t.Errorf("database not open")
 		return
 	}
-	actual, err := selectVotes(db, "0")
+	actual, err := selectVotes(db, testGuildID, "0")
 	if err != nil {
 		oops(err, "Selecting votes")
 		return
@@ -175,7 +175,7 @@ func TestUpdateVotes(t *testing.T) {
 		t.Errorf("database not open")
 		return
 	}
-	votes, err := selectVotes(db, "0")
+	votes, err := selectVotes(db, testGuildID, "0")
 	if err != nil {
 		oops(err, "Selecting votes")
 		return
@@ -188,8 +188,8 @@ func TestUpdateVotes(t *testing.T) {
 	expectedDefenderVotes := 1
 	expectedAbstainVotes := 3
 	expectedStopVotes := 1
-	updateVotes(db, "0", votes)
-	actual, err := selectVotes(db, "0")
+	updateVotes(db, testGuildID, "0", votes)
+	actual, err := selectVotes(db, testGuildID, "0")
 	if err != nil {
 		oops(err, "Selecting votes")
 		return
@@ -215,13 +215,13 @@ func TestUpdateOutcomeChallengerWin(t *testing.T) {
 		t.Errorf("database not open")
 		return
 	}
-	votes, err := selectVotes(db, "0")
+	votes, err := selectVotes(db, testGuildID, "0")
 	if err != nil {
 		oops(err, "Selecting votes")
 		return
 	}
-	updateOutcome(db, "0", votes)
-	actual, err := selectChallengeRow(db, "0")
+	updateOutcome(db, testGuildID, "0", votes)
+	actual, err := selectChallengeRow(db, testGuildID, "0")
 	if err != nil {
 		oops(err, "Selecting challenge row")
 		return
@@ -238,10 +238,10 @@ func TestUpdateOutcomeDefenderWin(t *testing.T) {
 		t.Errorf("database not open")
 		return
 	}
-	test := initChallengeTableEntry("1", "1", "Gabe", "2", "Miia")
+	test := initChallengeTableEntry(testGuildID, testChannelID, "1", "1", "Gabe", "2", "Miia")
 	insertChallengeRow(db, test)
 
-	votes, err := selectVotes(db, "1")
+	votes, err := selectVotes(db, testGuildID, "1")
 	if err != nil {
 		oops(err, "Selecting votes")
 		return
@@ -250,8 +250,8 @@ func TestUpdateOutcomeDefenderWin(t *testing.T) {
 	votes.DefenderVotes = 2
 	votes.AbstainVotes = 3
 	votes.StopVotes = 1
-	updateOutcome(db, "1", votes)
-	actual, err := selectChallengeRow(db, "1")
+	updateOutcome(db, testGuildID, "1", votes)
+	actual, err := selectChallengeRow(db, testGuildID, "1")
 	if err != nil {
 		oops(err, "Selecting challenge row")
 		return
@@ -269,10 +269,10 @@ func TestUpdateOutcomeTie(t *testing.T) {
 		t.Errorf("database not open")
 		return
 	}
-	test := initChallengeTableEntry("2", "1", "Gabe", "2", "Miia")
+	test := initChallengeTableEntry(testGuildID, testChannelID, "2", "1", "Gabe", "2", "Miia")
 	insertChallengeRow(db, test)
 
-	votes, err := selectVotes(db, "2")
+	votes, err := selectVotes(db, testGuildID, "2")
 	if err != nil {
 		oops(err, "Selecting votes")
 		return
@@ -281,8 +281,8 @@ func TestUpdateOutcomeTie(t *testing.T) {
 	votes.DefenderVotes = 1
 	votes.AbstainVotes = 3
 	votes.StopVotes = 1
-	updateOutcome(db, "2", votes)
-	actual, err := selectChallengeRow(db, "2")
+	updateOutcome(db, testGuildID, "2", votes)
+	actual, err := selectChallengeRow(db, testGuildID, "2")
 	if err != nil {
 		oops(err, "Selecting challenge row")
 		return
@@ -300,8 +300,8 @@ func TestInitScoreBoardRow(t *testing.T) {
 		t.Errorf("database not open")
 		return
 	}
-	CreateScoreboardTable(db)
-	actual := initScoreBoardRow("1", "Gabe")
+	Migrate(db, "")
+	actual := initScoreBoardRow(testGuildID, "1", "Gabe")
 	expectedUserID := "1"
 	expectedUsername := "Gabe"
 	if actual.UserID != expectedUserID {
@@ -319,9 +319,9 @@ func TestInsertScoreboardRow(t *testing.T) {
 		t.Errorf("database not open")
 		return
 	}
-	score := initScoreBoardRow("1", "Gabe")
+	score := initScoreBoardRow(testGuildID, "1", "Gabe")
 	insertScoreboardRow(db, score)
-	actual, err := selectScoreboardRow(db, "1")
+	actual, err := selectScoreboardRow(db, testGuildID, "1")
 	if err != nil {
 		oops(err, "Selecting scoreboard row")
 		return
@@ -343,7 +343,7 @@ func TestUpdateScoreboard(t *testing.T) {
 		t.Errorf("database not open")
 		return
 	}
-	score, err := selectScoreboardRow(db, "1")
+	score, err := selectScoreboardRow(db, testGuildID, "1")
 	if err != nil {
 		t.Errorf("Selecting scoreboard row 1")
 		return
@@ -365,7 +365,7 @@ func TestUpdateScoreboard(t *testing.T) {
 	expectedSuccessfulDefenses := 2
 	expectedFailedDefenses := 2
 	updateScoreboard(db, score)
-	actual, err := selectScoreboardRow(db, "1")
+	actual, err := selectScoreboardRow(db, testGuildID, "1")
 	if err != nil {
 		t.Errorf("Selecting scoreboard row 2")
 		return
@@ -403,7 +403,7 @@ func TestUserInScoreboardTrue(t *testing.T) {
 		t.Errorf("database not open")
 		return
 	}
-	actual := userInScoreboard(db, "1")
+	actual := userInScoreboard(db, testGuildID, "1")
 	expected := true
 	if expected != actual {
 		t.Errorf("got %t, wanted%t", actual, expected)
@@ -417,7 +417,7 @@ func TestUserInScoreboardFalse(t *testing.T) {
 		t.Errorf("database not open")
 		return
 	}
-	actual := userInScoreboard(db, "3")
+	actual := userInScoreboard(db, testGuildID, "3")
 	expected := true
 	if expected == actual {
 		t.Errorf("got %t, wanted %t", actual, expected)
@@ -426,7 +426,7 @@ func TestUserInScoreboardFalse(t *testing.T) {
 }
 
 func TestWinnerID1(t *testing.T) {
-	test := initChallengeTableEntry("2", "1", "Gabe", "2", "Miia")
+	test := initChallengeTableEntry(testGuildID, testChannelID, "2", "1", "Gabe", "2", "Miia")
 	test.Outcome = 1
 	actual := winnerID(test)
 	expected := "1"
@@ -436,7 +436,7 @@ func TestWinnerID1(t *testing.T) {
 }
 
 func TestWinnerID2(t *testing.T) {
-	test := initChallengeTableEntry("2", "1", "Gabe", "2", "Miia")
+	test := initChallengeTableEntry(testGuildID, testChannelID, "2", "1", "Gabe", "2", "Miia")
 	test.Outcome = 2
 	actual := winnerID(test)
 	expected := "2"
@@ -446,7 +446,7 @@ func TestWinnerID2(t *testing.T) {
 }
 
 func TestWinnerIDtie(t *testing.T) {
-	test := initChallengeTableEntry("2", "1", "Gabe", "2", "Miia")
+	test := initChallengeTableEntry(testGuildID, testChannelID, "2", "1", "Gabe", "2", "Miia")
 	test.Outcome = 0
 	actual := winnerID(test)
 	expected := "tie"
@@ -461,13 +461,13 @@ func TestScoreBoardToString(t *testing.T) {
 		t.Errorf("database not open")
 		return
 	}
-	test, err := selectScoreboardRow(db, "1")
+	test, err := selectScoreboardRow(db, testGuildID, "1")
 	if err != nil {
 		t.Errorf("Selecting scoreboard row 1")
 		return
 	}
 	actual := scoreboardToString(test)
-	expected := "`Gabe\nTotal challenge wins: 1\nTotal challenge losses: 2\nTotal challenge ties: 3\nTotal challenges: 6\nWins as challenger: 1\nLosses as challenger: 2\nWins as defender: 2\nLosses as defender: 2`"
+	expected := "`Gabe\nTotal challenge wins: 1\nTotal challenge losses: 2\nTotal challenge ties: 3\nTotal challenges: 6\nWins as challenger: 1\nLosses as challenger: 2\nWins as defender: 2\nLosses as defender: 2\nRating: 1000\nWin streak: 0 (best 0)\nDefense streak: 0 (best 0)`"
 	if expected != actual {
 		t.Errorf("got %q, wanted%q", actual, expected)
 	}
@@ -480,7 +480,7 @@ func TestSelectVotingRecordRowError(t *testing.T) {
 		t.Errorf("database not open")
 		return
 	}
-	test, err := selectVotingRecordRow(db, "10", "10")
+	test, err := selectVotingRecordRow(db, testGuildID, "10", "10")
 	if err == nil {
 		t.Errorf("got %t, wanted an error", err)
 	}
@@ -494,10 +494,10 @@ func TestInsertVotingRecordRow(t *testing.T) {
 		t.Errorf("database not open")
 		return
 	}
-	CreateVotingRecord(db)
-	votingRecord := VotingRecordEntryStruct{"1", "0", 1, 0, 0, 1}
+	Migrate(db, "")
+	votingRecord := VotingRecordEntryStruct{testGuildID, "1", "0", 1, 0, 0, 1, AbstainVote}
 	insertVotingRecordRow(db, votingRecord)
-	actual, err := selectVotingRecordRow(db, "1", "0")
+	actual, err := selectVotingRecordRow(db, testGuildID, "1", "0")
 	if err != nil {
 		t.Errorf("select ")
 		return
@@ -531,13 +531,13 @@ func TestUpdateVotingRecord(t *testing.T) {
 		t.Errorf("database not open")
 		return
 	}
-	test, err := selectVotingRecordRow(db, "1", "0")
+	test, err := selectVotingRecordRow(db, testGuildID, "1", "0")
 	test.ChallengerVotes = 0
 	test.DefenderVotes = 1
 	expectedChallengerVotes := 0
 	expectedDefenderVotes := 1
 	updateVotingRecord(db, test)
-	actual, err := selectVotingRecordRow(db, "1", "0")
+	actual, err := selectVotingRecordRow(db, testGuildID, "1", "0")
 	if expectedChallengerVotes != actual.ChallengerVotes {
 		t.Errorf("got %q, wanted% q", actual.ChallengerVotes, expectedChallengerVotes)
 	}
@@ -553,7 +553,7 @@ func TestHasVotedBlueTrue(t *testing.T) {
 		t.Errorf("database not open")
 		return
 	}
-	votingRecord := VotingRecordEntryStruct{"1", "0", 1, 0, 0, 0}
+	votingRecord := VotingRecordEntryStruct{testGuildID, "1", "0", 1, 0, 0, 0, AbstainVote}
 	updateVotingRecord(db, votingRecord)
 	if hasVotedBlue(db, votingRecord) != true {
 		t.Errorf("got %t, wanted %t", hasVotedBlue(db, votingRecord), true)
@@ -567,7 +567,7 @@ func TestHasVotedBlueFalse(t *testing.T) {
 		t.Errorf("database not open")
 		return
 	}
-	votingRecord := VotingRecordEntryStruct{"1", "0", 0, 0, 0, 0}
+	votingRecord := VotingRecordEntryStruct{testGuildID, "1", "0", 0, 0, 0, 0, AbstainVote}
 	updateVotingRecord(db, votingRecord)
 	if hasVotedBlue(db, votingRecord) == true {
 		t.Errorf("got %t, wanted %t", hasVotedBlue(db, votingRecord), false)
@@ -581,7 +581,7 @@ func TestHasVotedYellowTrue(t *testing.T) {
 		t.Errorf("database not open")
 		return
 	}
-	votingRecord := VotingRecordEntryStruct{"1", "0", 0, 1, 0, 0}
+	votingRecord := VotingRecordEntryStruct{testGuildID, "1", "0", 0, 1, 0, 0, AbstainVote}
 	updateVotingRecord(db, votingRecord)
 	if hasVotedYellow(db, votingRecord) != true {
 		t.Errorf("got %t, wanted %t", hasVotedBlue(db, votingRecord), true)
@@ -595,7 +595,7 @@ func TestHasVotedYellowFalse(t *testing.T) {
 		t.Errorf("database not open")
 		return
 	}
-	votingRecord := VotingRecordEntryStruct{"1", "0", 0, 0, 0, 0}
+	votingRecord := VotingRecordEntryStruct{testGuildID, "1", "0", 0, 0, 0, 0, AbstainVote}
 	updateVotingRecord(db, votingRecord)
 	if hasVotedYellow(db, votingRecord) == true {
 		t.Errorf("got %t, wanted %t", hasVotedBlue(db, votingRecord), false)
@@ -609,7 +609,7 @@ func TestHasVotedRedTrue(t *testing.T) {
 		t.Errorf("database not open")
 		return
 	}
-	votingRecord := VotingRecordEntryStruct{"1", "0", 0, 0, 1, 0}
+	votingRecord := VotingRecordEntryStruct{testGuildID, "1", "0", 0, 0, 1, 0, AbstainVote}
 	updateVotingRecord(db, votingRecord)
 	if hasVotedRed(db, votingRecord) != true {
 		t.Errorf("got %t, wanted %t", hasVotedBlue(db, votingRecord), true)
@@ -623,7 +623,7 @@ func TestHasVotedRedFalse(t *testing.T) {
 		t.Errorf("database not open")
 		return
 	}
-	votingRecord := VotingRecordEntryStruct{"1", "0", 0, 0, 0, 0}
+	votingRecord := VotingRecordEntryStruct{testGuildID, "1", "0", 0, 0, 0, 0, AbstainVote}
 	updateVotingRecord(db, votingRecord)
 	if hasVotedRed(db, votingRecord) == true {
 		t.Errorf("got %t, wanted %t", hasVotedBlue(db, votingRecord), false)
@@ -637,7 +637,7 @@ func TestHasVotedStopTrue(t *testing.T) {
 		t.Errorf("database not open")
 		return
 	}
-	votingRecord := VotingRecordEntryStruct{"1", "0", 0, 0, 0, 1}
+	votingRecord := VotingRecordEntryStruct{testGuildID, "1", "0", 0, 0, 0, 1, AbstainVote}
 	updateVotingRecord(db, votingRecord)
 	if hasVotedStop(db, votingRecord) != true {
 		t.Errorf("got %t, wanted %t", hasVotedBlue(db, votingRecord), true)
@@ -651,7 +651,7 @@ func TestHasVotedStopFalse(t *testing.T) {
 		t.Errorf("database not open")
 		return
 	}
-	votingRecord := VotingRecordEntryStruct{"1", "0", 0, 0, 0, 0}
+	votingRecord := VotingRecordEntryStruct{testGuildID, "1", "0", 0, 0, 0, 0, AbstainVote}
 	updateVotingRecord(db, votingRecord)
 	if hasVotedStop(db, votingRecord) == true {
 		t.Errorf("got %t, wanted %t", hasVotedBlue(db, votingRecord), false)
@@ -665,10 +665,10 @@ func TestRemoveVotingRecordRow(t *testing.T) {
 		t.Errorf("database not open")
 		return
 	}
-	test, err := selectVotingRecordRow(db, "1", "0")
+	test, err := selectVotingRecordRow(db, testGuildID, "1", "0")
 	removeVotingRecordRow(db, test)
 	expected := ""
-	actual, err := selectVotingRecordRow(db, "1", "0")
+	actual, err := selectVotingRecordRow(db, testGuildID, "1", "0")
 	if err == nil {
 		t.Errorf("got %q, wanted% q", actual.UserID, expected)
 	}
@@ -682,9 +682,9 @@ func TestCheckStopVotes(t *testing.T) {
 		return
 	}
 	expected := 1
-	checkStopVotes(db, "0")
-	if checkStopVotes(db, "0") != expected {
-		t.Errorf("got %q, wanted %q", checkStopVotes(db, "0"), expected)
+	checkStopVotes(db, testGuildID, "0")
+	if checkStopVotes(db, testGuildID, "0") != expected {
+		t.Errorf("got %q, wanted %q", checkStopVotes(db, testGuildID, "0"), expected)
 	}
 	db.Close()
 }
@@ -695,14 +695,14 @@ func TestPushScore1(t *testing.T) {
 		t.Errorf("database not open")
 		return
 	}
-	insertScoreboardRow(db, initScoreBoardRow("2", "Miia"))
-	challengeTable := ChallengeTableEntryStruct{"10", "1", "Gabe", "2", "Miia", 0, 0, 0, 0, 1}
-	pushScore(db, challengeTable)
-	challenger, err := selectScoreboardRow(db, "1")
+	insertScoreboardRow(db, initScoreBoardRow(testGuildID, "2", "Miia"))
+	challengeTable := ChallengeTableEntryStruct{testGuildID, testChannelID, "10", "1", "Gabe", "2", "Miia", 0, 0, 0, 0, 1, 0, 0, "", 0, "", 0, 0, 0}
+	pushScore(db, challengeTable, nil)
+	challenger, err := selectScoreboardRow(db, testGuildID, "1")
 	if err != nil {
 		t.Errorf("selecting scoreboard row")
 	}
-	defender, err := selectScoreboardRow(db, "2")
+	defender, err := selectScoreboardRow(db, testGuildID, "2")
 	if err != nil {
 		t.Errorf("selecting scoreboard row")
 	}
@@ -712,12 +712,12 @@ func TestPushScore1(t *testing.T) {
 	expectedTotalChallengeLosses := defender.TotalChallengeLosses + 1
 	expectedFailedDefenses := defender.FailedDefenses + 1
 	expectedDTotalCHallenges := defender.TotalChallenges + 1
-	pushScore(db, challengeTable)
-	challenger, err = selectScoreboardRow(db, "1")
+	pushScore(db, challengeTable, nil)
+	challenger, err = selectScoreboardRow(db, testGuildID, "1")
 	if err != nil {
 		t.Errorf("selecting scoreboard row")
 	}
-	defender, err = selectScoreboardRow(db, "2")
+	defender, err = selectScoreboardRow(db, testGuildID, "2")
 	if err != nil {
 		t.Errorf("selecting scoreboard row")
 	}
@@ -748,13 +748,13 @@ func TestPushScore2(t *testing.T) {
 		t.Errorf("database not open")
 		return
 	}
-	challengeTable := ChallengeTableEntryStruct{"10", "1", "Gabe", "2", "Miia", 0, 0, 0, 0, 2}
-	pushScore(db, challengeTable)
-	challenger, err := selectScoreboardRow(db, "1")
+	challengeTable := ChallengeTableEntryStruct{testGuildID, testChannelID, "10", "1", "Gabe", "2", "Miia", 0, 0, 0, 0, 2, 0, 0, "", 0, "", 0, 0, 0}
+	pushScore(db, challengeTable, nil)
+	challenger, err := selectScoreboardRow(db, testGuildID, "1")
 	if err != nil {
 		t.Errorf("selecting scoreboard row")
 	}
-	defender, err := selectScoreboardRow(db, "2")
+	defender, err := selectScoreboardRow(db, testGuildID, "2")
 	if err != nil {
 		t.Errorf("selecting scoreboard row")
 	}
@@ -764,12 +764,12 @@ func TestPushScore2(t *testing.T) {
 	expectedTotalChallengeWins := defender.TotalChallengeWins + 1
 	expectedSuccesfulDefenses := defender.SuccessfulDefenses + 1
 	expectedDTotalCHallenges := defender.TotalChallenges + 1
-	pushScore(db, challengeTable)
-	challenger, err = selectScoreboardRow(db, "1")
+	pushScore(db, challengeTable, nil)
+	challenger, err = selectScoreboardRow(db, testGuildID, "1")
 	if err != nil {
 		t.Errorf("selecting scoreboard row")
 	}
-	defender, err = selectScoreboardRow(db, "2")
+	defender, err = selectScoreboardRow(db, testGuildID, "2")
 	if err != nil {
 		t.Errorf("selecting scoreboard row")
 	}
@@ -800,12 +800,12 @@ func TestPushScoretie(t *testing.T) {
 		t.Errorf("database not open")
 		return
 	}
-	challengeTable := ChallengeTableEntryStruct{"10", "1", "Gabe", "2", "Miia", 0, 0, 0, 0, 0}
-	challenger, err := selectScoreboardRow(db, "1")
+	challengeTable := ChallengeTableEntryStruct{testGuildID, testChannelID, "10", "1", "Gabe", "2", "Miia", 0, 0, 0, 0, 0, 0, 0, "", 0, "", 0, 0, 0}
+	challenger, err := selectScoreboardRow(db, testGuildID, "1")
 	if err != nil {
 		t.Errorf("selecting scoreboard row")
 	}
-	defender, err := selectScoreboardRow(db, "2")
+	defender, err := selectScoreboardRow(db, testGuildID, "2")
 	if err != nil {
 		t.Errorf("selecting scoreboard row")
 	}
@@ -813,12 +813,12 @@ func TestPushScoretie(t *testing.T) {
 	expectedCTotalChallenges := challenger.TotalChallenges + 1
 	expectedDTotalChallengeTies := defender.TotalChallengeTies + 1
 	expectedDTotalCHallenges := defender.TotalChallenges + 1
-	pushScore(db, challengeTable)
-	challenger, err = selectScoreboardRow(db, "1")
+	pushScore(db, challengeTable, nil)
+	challenger, err = selectScoreboardRow(db, testGuildID, "1")
 	if err != nil {
 		t.Errorf("selecting scoreboard row")
 	}
-	defender, err = selectScoreboardRow(db, "2")
+	defender, err = selectScoreboardRow(db, testGuildID, "2")
 	if err != nil {
 		t.Errorf("selecting scoreboard row")
 	}
@@ -843,7 +843,7 @@ func TestPushScoreChallengerError(t *testing.T) {
 		t.Errorf("database not open")
 		return
 	}
-	challengeTable := ChallengeTableEntryStruct{"10", "7", "Gabe", "2", "Miia", 0, 0, 0, 0, 0}
-	pushScore(db, challengeTable)
+	challengeTable := ChallengeTableEntryStruct{testGuildID, testChannelID, "10", "7", "Gabe", "2", "Miia", 0, 0, 0, 0, 0, 0, 0, "", 0, "", 0, 0, 0}
+	pushScore(db, challengeTable, nil)
 	db.Close()
 }
@@ -1,14 +1,14 @@
 package db
 
 import (
-	"fmt"
+	"database/sql"
 	"log"
 	"regexp"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/bwmarrin/discordgo"
-	"github.com/jmoiron/sqlx"
 )
 
 const (
@@ -19,11 +19,31 @@ const (
 	testResponse2 = "This is another statement you might disagree with."
 
 	//for sqlite
-	dbname = "scoreboardDB"
+	dbname      = "scoreboardDB"
+	busyTimeout = 5000
+
+	//for postgres
+	maxPostgresConns = 10
+	//advisory lock key replicas take while migrating
+	migrationLockID = 8675309
+	//advisory lock key taken with the guild's while its challenge limits are checked
+	challengeLimitLockID = 8675310
 
 	//bot commands
-	commandChallenge  = "!challenge"
-	commandCheckScore = "!checkscore"
+	commandChallenge   = "!challenge"
+	commandCheckScore  = "!checkscore"
+	commandLeaderboard = "!leaderboard"
+	commandSettings    = "!settings"
+	commandHistory     = "!history"
+	commandHeadToHead  = "!h2h"
+	commandSeason      = "!season"
+	commandCancel      = "!cancel"
+	commandInfo        = "info"
+
+	//application commands
+	slashChallenge   = "Challenge"
+	slashScore       = "score"
+	slashLeaderboard = "leaderboard"
 
 	//bot messages
 	challengeMessage1 = " has challenged "
@@ -33,12 +53,67 @@ const (
 	challengeMessage5 = "\n🟥 = Abstain"
 	challengeMessage6 = "\n✋  = Close Voting"
 
+	//voting reactions
+	voteChallenger = "🟦"
+	voteDefender   = "🟨"
+	voteAbstain    = "🟥"
+	voteStop       = "✋"
+
+	//leaderboard
+	leaderboardPageSize     = 10
+	leaderboardColor        = 0x3498db
+	leaderboardButtonPrefix = "leaderboard:"
+	seasonArgPrefix         = "season:"
+
+	//voting buttons
+	voteButtonPrefix = "vote:"
+
+	//the defender's buttons when they have to accept a challenge
+	acceptButtonID  = "challenge:accept"
+	declineButtonID = "challenge:decline"
+
+	//!history and !challenge info
+	defaultHistoryLength = 5
+	maxHistoryLength     = 25
+	maxStatementLength   = 80
+	infoVotersPageSize   = 15
+	historyColor         = 0x3498db
+	historyButtonPrefix  = "history:"
+	infoButtonPrefix     = "info:"
+
+	//!h2h
+	headToHeadColor = 0x9b59b6
+
+	//embeds
+	challengerColor       = 0x3498db
+	defenderColor         = 0xf1c40f
+	tieColor              = 0x95a5a6
+	challengeFooterPrefix = "Challenge ID: "
+	tallyMarker           = "\n\n📊 "
+
+	//time limits for !challenge <duration>
+	minChallengeDuration = time.Minute
+	maxChallengeDuration = 7 * 24 * time.Hour
+
+	//elo ratings
+	initialRating = 1000
+	eloK          = 32
+
+	//most ✋ votes a guild can require to close a challenge
+	maxStopVotes = 25
+	//highest cap !settings maxopen takes
+	maxOpenChallenges = 25
+
 	//values
 	maxIDLength = 18
 )
 
 // var RegexUserPatternID = regexp.MustCompile(fmt.Sprintf(`^(<@!(\d{%d,})>)$`, maxIDLength))
-var RegexUserPatternID = regexp.MustCompile(fmt.Sprintf(`<@.?[0-9]*?>`))
+// RegexUserPatternID matches a user mention, <@id> or <@!id>, but not a role mention (<@&id>)
+var RegexUserPatternID = regexp.MustCompile(`^<@!?([0-9]+)>$`)
+
+// RegexRolePattern matches a role mention
+var RegexRolePattern = regexp.MustCompile(`^<@&[0-9]+>$`)
 
 func oops(e error, n string) {
 	log.Printf("Error %s in %s", e, n)
@@ -49,10 +124,15 @@ func alreadyVoted() {
 }
 
 // MessageCreate trigger>response for messagecreate events
-func MessageCreate(s *discordgo.Session, m *discordgo.MessageCreate) {
+func (b *Bot) MessageCreate(s *discordgo.Session, m *discordgo.MessageCreate) {
+	b.messageCreate(s, m.Message)
+}
+
+func (b *Bot) messageCreate(s session, m *discordgo.Message) {
 
 	var messageContent = m.Content
 	var messageType = m.Type
+	parameters := strings.Split(messageContent, " ")
 
 	//to send a message when m.Content == <whatever trigger you want>
 	//follow this format (EqualFold compares strings, ignores case and returns True if they are equal):
@@ -72,550 +152,615 @@ func MessageCreate(s *discordgo.Session, m *discordgo.MessageCreate) {
 		}
 	}
 
-	//!challenge
-	if strings.EqualFold(messageContent, commandChallenge) && messageType == discordgo.MessageTypeReply {
-		//connect to challengeDB
-		db, err := ConnectToDB()
-		if err != nil {
-			oops(err, "connectToDB()")
-			return
-		}
-		defer func(db *sqlx.DB) {
-			err := db.Close()
+	//!challenge [duration], a reply of !challenge info is for the info page below
+	if len(parameters) <= 2 && strings.EqualFold(parameters[0], commandChallenge) && messageType == discordgo.MessageTypeReply && !(len(parameters) == 2 && strings.EqualFold(parameters[1], commandInfo)) {
+		duration := b.Config.DefaultChallengeDuration
+		if len(parameters) == 2 {
+			var err error
+			duration, err = parseChallengeDuration(parameters[1])
 			if err != nil {
-				oops(err, "Close()")
+				_, err = s.ChannelMessageSend(m.ChannelID, "Sorry, "+err.Error()+".")
+				if err != nil {
+					oops(err, "ChannelMessageSend")
+				}
+				return
 			}
-		}(db)
-
-		authorUsername := m.Message.Author.Username
-		authorUserID := m.Message.Author.ID
-		referencedAuthorUsername := m.ReferencedMessage.Author.Username
-		referencedAuthorID := m.ReferencedMessage.Author.ID
-
-		challengerInfo := "<@" + authorUserID + ">" + challengeMessage1 + "<@" + referencedAuthorID + ">" + "!"
-		debate := "\n\n<@" + referencedAuthorID + ">" + " says: `" + m.ReferencedMessage.Content + "`\n\n<@" + authorUserID + "> disagrees!\n"
-		votingInfo := "\n" + challengeMessage2 + challengeMessage3 + "<@" + authorUserID + ">" + challengeMessage4 + "<@" + referencedAuthorID + ">" + challengeMessage5 + challengeMessage6
-		fullChallengeMessage := challengerInfo + debate + votingInfo
-		announcementMessage, err := s.ChannelMessageSend(m.ChannelID, fullChallengeMessage)
-		if err != nil {
-			oops(err, "ChannelMessageSend")
-			return
-		}
-		err = s.MessageReactionAdd(m.ChannelID, announcementMessage.ID, "🟦")
-		if err != nil {
-			oops(err, "MessageReactionAdd")
-			return
 		}
-		err = s.MessageReactionAdd(m.ChannelID, announcementMessage.ID, "🟨")
-		if err != nil {
-			oops(err, "MessageReactionAdd")
-			return
+		refusal := challengeRefusal(m.Author, m.ReferencedMessage.Author)
+		if refusal == "" {
+			refusal = b.checkChallengeLimits(m.GuildID, m.ChannelID, m.Author.ID, m.ReferencedMessage.Author.ID)
 		}
-		err = s.MessageReactionAdd(m.ChannelID, announcementMessage.ID, "🟥")
-		if err != nil {
-			oops(err, "MessageReactionAdd")
+		if refusal != "" {
+			_, err := s.ChannelMessageSend(m.ChannelID, refusal)
+			if err != nil {
+				oops(err, "ChannelMessageSend")
+			}
 			return
 		}
-		err = s.MessageReactionAdd(m.ChannelID, announcementMessage.ID, "✋")
+		deadline := deadlineAfter(time.Now(), duration)
+
+		settings := b.guildSettings(m.GuildID)
+		content, embeds := b.announcement(s, m.ChannelID, m.Author, m.ReferencedMessage.Author, m.ReferencedMessage.Content, deadline, settings)
+		announcementMessage, err := s.ChannelMessageSendComplex(m.ChannelID, &discordgo.MessageSend{
+			Content:    content,
+			Embeds:     embeds,
+			Components: announcementButtons(settings, m.Author.Username, m.ReferencedMessage.Author.Username),
+		})
 		if err != nil {
-			oops(err, "MessageReactionAdd")
+			oops(err, "ChannelMessageSendComplex")
 			return
 		}
-		announcementMessageID := announcementMessage.ID
-
-		//create ChallengeTableEntry
-		challengeTableEntry := initChallengeTableEntry(announcementMessageID, authorUserID, authorUsername, referencedAuthorID, referencedAuthorUsername)
-		insertChallengeRow(db, challengeTableEntry)
-		_, err = selectChallengeRow(db, announcementMessageID)
+		err = b.openChallenge(s, m.GuildID, m.ChannelID, announcementMessage.ID, m.Author, m.ReferencedMessage, deadline, settings)
 		if err != nil {
-			oops(err, "selectChallengeRow")
-		}
-
-		//createScoreboardTableEntry x2 (one for challenger, one for defender)
-		if !userInScoreboard(db, authorUserID) {
-			scoreboardRow := initScoreBoardRow(authorUserID, authorUsername)
-			insertScoreboardRow(db, scoreboardRow)
-		}
-
-		if !userInScoreboard(db, referencedAuthorID) {
-			scoreboardRow := initScoreBoardRow(referencedAuthorID, referencedAuthorUsername)
-			insertScoreboardRow(db, scoreboardRow)
+			oops(err, "openChallenge")
 		}
 	}
 
 	//!checkscore @username
-	parameters := strings.Split(messageContent, " ")
-	if strings.EqualFold(parameters[0], commandCheckScore) && RegexUserPatternID.MatchString(parameters[1]) {
-		fmt.Println("checkscore criteria met")
-		//connect to challengeDB
-		db, err := ConnectToDB()
+	if len(parameters) > 1 && strings.EqualFold(parameters[0], commandCheckScore) && RegexUserPatternID.MatchString(parameters[1]) {
+		output, embeds, err := b.scoreReply(s, m.ChannelID, m.GuildID, mentionedUser(m, parameters[1]))
 		if err != nil {
-			oops(err, "connectToDB")
+			oops(err, "scoreReply")
 			return
 		}
-		defer func(db *sqlx.DB) {
-			err := db.Close()
-			if err != nil {
-				oops(err, "Close()")
-			}
-		}(db)
-		mentionedUser := parameters[1]
-		re, err := regexp.Compile(`[^\w]`)
-		if err != nil {
-			oops(err, "regexp.Compile()")
+		if embeds == nil {
+			_, err = s.ChannelMessageSend(m.ChannelID, output)
+		} else {
+			_, err = s.ChannelMessageSendComplex(m.ChannelID, &discordgo.MessageSend{Content: output, Embeds: embeds})
 		}
-		mentionedUser = re.ReplaceAllString(mentionedUser, "")
-		mentionedScoreboard, err := selectScoreboardRow(db, mentionedUser)
-		output := "<@" + mentionedUser + "> has the following challenge record:\n" + scoreboardToString(mentionedScoreboard)
-		_, err = s.ChannelMessageSend(m.ChannelID, output)
 		if err != nil {
 			oops(err, "channelMessageSend")
 			return
 		}
 	}
 
-}
-
-// MessageReactionCreate trigger>response for messagereactionadd events
-func MessageReactionCreate(s *discordgo.Session, r *discordgo.MessageReactionAdd) {
-	reactionEmoji := r.Emoji.Name
-	messageID := r.MessageID
-	reactionAuthorID := r.UserID
-
-	//ignore all reactions created by the bot itself
-	if r.UserID == s.State.User.ID {
-		return
-	}
-
-	if reactionEmoji == "🛹" {
-		log.Println("Skateboard detected")
-	}
-
-	if reactionEmoji == "🟦" {
-		//connect to challengeDB
-		db, err := ConnectToDB()
-		if err != nil {
-			oops(err, "connectToDB")
-			return
-		}
-		defer func(db *sqlx.DB) {
-			err := db.Close()
+	//!leaderboard [wins|winrate|challenges|defenses|rating] [season:N]
+	if len(parameters) <= 3 && strings.EqualFold(parameters[0], commandLeaderboard) {
+		sort, season, ok := parseLeaderboardArgs(parameters[1:])
+		if !ok {
+			_, err := s.ChannelMessageSend(m.ChannelID, leaderboardUsage())
 			if err != nil {
-				oops(err, "Close()")
+				oops(err, "ChannelMessageSend")
 			}
-		}(db)
-		if checkStopVotes(db, messageID) == 2 {
 			return
 		}
-		votingRecordEntry, err := selectVotingRecordRow(db, reactionAuthorID, messageID)
-		if hasVotedBlue(db, votingRecordEntry) || hasVotedYellow(db, votingRecordEntry) || hasVotedRed(db, votingRecordEntry) {
-			alreadyVoted()
-			return
-		}
-		if !hasVotedBlue(db, votingRecordEntry) && !hasVotedRed(db, votingRecordEntry) && !hasVotedYellow(db, votingRecordEntry) {
-			votingRecordEntry.UserID = reactionAuthorID
-			votingRecordEntry.MessageID = messageID
-			insertVotingRecordRow(db, votingRecordEntry)
-		}
-		votingRecordEntry.ChallengerVotes = 1
-		updateVotingRecord(db, votingRecordEntry)
-		votes, err := selectVotes(db, messageID)
+		embed, buttons, err := b.leaderboardPage(m.GuildID, sort, season, 0)
 		if err != nil {
-			oops(err, "selectVotes")
+			oops(err, "leaderboardPage")
 			return
 		}
-		ChallengerVotes := votes.ChallengerVotes + 1
-		DefenderVotes := votes.DefenderVotes
-		AbstainVotes := votes.AbstainVotes
-		StopVotes := votes.StopVotes
-		updatedVotes := VotesStruct{ChallengerVotes, DefenderVotes, AbstainVotes, StopVotes}
-		updateVotes(db, messageID, updatedVotes)
-		votes, err = selectVotes(db, messageID)
+		_, err = s.ChannelMessageSendComplex(m.ChannelID, &discordgo.MessageSend{Embeds: []*discordgo.MessageEmbed{embed}, Components: buttons})
 		if err != nil {
-			oops(err, "selectVotes")
+			oops(err, "ChannelMessageSendComplex")
 			return
 		}
-		updateOutcome(db, messageID, votes)
-		_, err = selectChallengeRow(db, messageID)
 	}
 
-	if reactionEmoji == "🟨" {
-		//connect to challengeDB
-		db, err := ConnectToDB()
-		if err != nil {
-			oops(err, "connectToDB")
-			return
-		}
-		defer func(db *sqlx.DB) {
-			err := db.Close()
+	//!history [@user] [n]
+	if strings.EqualFold(parameters[0], commandHistory) {
+		userID, length, ok := parseHistoryArgs(m, parameters[1:])
+		if !ok {
+			_, err := s.ChannelMessageSend(m.ChannelID, historyUsage())
 			if err != nil {
-				oops(err, "Close()")
+				oops(err, "ChannelMessageSend")
 			}
-		}(db)
-		if checkStopVotes(db, messageID) == 2 {
 			return
 		}
-		votingRecordEntry, err := selectVotingRecordRow(db, reactionAuthorID, messageID)
-		if hasVotedYellow(db, votingRecordEntry) || hasVotedBlue(db, votingRecordEntry) || hasVotedRed(db, votingRecordEntry) {
-			alreadyVoted()
+		embed, buttons, err := b.historyPage(m.GuildID, userID, length, 0)
+		if err != nil {
+			oops(err, "historyPage")
 			return
 		}
-		if !hasVotedBlue(db, votingRecordEntry) && !hasVotedRed(db, votingRecordEntry) && !hasVotedYellow(db, votingRecordEntry) {
-			votingRecordEntry.UserID = reactionAuthorID
-			votingRecordEntry.MessageID = messageID
-			insertVotingRecordRow(db, votingRecordEntry)
-		}
-		votingRecordEntry.DefenderVotes = 1
-		updateVotingRecord(db, votingRecordEntry)
-		votes, err := selectVotes(db, messageID)
+		_, err = s.ChannelMessageSendComplex(m.ChannelID, &discordgo.MessageSend{Embeds: []*discordgo.MessageEmbed{embed}, Components: buttons})
 		if err != nil {
-			oops(err, "selectVotes")
+			oops(err, "ChannelMessageSendComplex")
 			return
 		}
-		ChallengerVotes := votes.ChallengerVotes
-		DefenderVotes := votes.DefenderVotes + 1
-		AbstainVotes := votes.AbstainVotes
-		StopVotes := votes.StopVotes
-		updatedVotes := VotesStruct{ChallengerVotes, DefenderVotes, AbstainVotes, StopVotes}
-		updateVotes(db, messageID, updatedVotes)
-		votes, err = selectVotes(db, messageID)
-		if err != nil {
-			oops(err, "selectVotes")
+	}
+
+	//!h2h @user @user
+	if strings.EqualFold(parameters[0], commandHeadToHead) {
+		userA, userB, ok := parseHeadToHeadArgs(m, parameters[1:])
+		if !ok || userA == userB {
+			_, err := s.ChannelMessageSend(m.ChannelID, headToHeadUsage())
+			if err != nil {
+				oops(err, "ChannelMessageSend")
+			}
 			return
 		}
-		updateOutcome(db, messageID, votes)
-		_, err = selectChallengeRow(db, messageID)
+		embed, err := b.headToHeadEmbed(m.GuildID, userA, userB)
 		if err != nil {
-			oops(err, "selectChallengeRow")
+			oops(err, "headToHeadEmbed")
 			return
 		}
-	}
-
-	if reactionEmoji == "🟥" {
-		//connect to challengeDB
-		db, err := ConnectToDB()
+		_, err = s.ChannelMessageSendComplex(m.ChannelID, &discordgo.MessageSend{Embeds: []*discordgo.MessageEmbed{embed}})
 		if err != nil {
-			oops(err, "connectToDB")
+			oops(err, "ChannelMessageSendComplex")
 			return
 		}
-		defer func(db *sqlx.DB) {
-			err := db.Close()
+	}
+
+	//!challenge info <id>, or as a reply to the announcement
+	if len(parameters) > 1 && strings.EqualFold(parameters[0], commandChallenge) && strings.EqualFold(parameters[1], commandInfo) && (len(parameters) == 3 || len(parameters) == 2 && messageType == discordgo.MessageTypeReply && m.ReferencedMessage != nil) {
+		var messageID string
+		if len(parameters) == 3 {
+			messageID = parseChallengeID(parameters[2])
+		} else {
+			messageID = m.ReferencedMessage.ID
+		}
+		embed, buttons, err := b.infoPage(m.GuildID, messageID, 0)
+		if err == sql.ErrNoRows {
+			_, err = s.ChannelMessageSend(m.ChannelID, "Sorry, I couldn't find challenge "+messageID+".")
 			if err != nil {
-				oops(err, "Close()")
+				oops(err, "ChannelMessageSend")
 			}
-		}(db)
-		if checkStopVotes(db, messageID) == 2 {
 			return
 		}
-		votingRecordEntry, err := selectVotingRecordRow(db, reactionAuthorID, messageID)
 		if err != nil {
-			oops(err, "selectVotingRecordRow")
-		}
-		if hasVotedRed(db, votingRecordEntry) || hasVotedBlue(db, votingRecordEntry) || hasVotedYellow(db, votingRecordEntry) {
-			alreadyVoted()
+			oops(err, "infoPage")
 			return
 		}
-		if !hasVotedBlue(db, votingRecordEntry) && !hasVotedRed(db, votingRecordEntry) && !hasVotedYellow(db, votingRecordEntry) {
-			votingRecordEntry.UserID = reactionAuthorID
-			votingRecordEntry.MessageID = messageID
-			insertVotingRecordRow(db, votingRecordEntry)
-		}
-		votingRecordEntry.AbstainVotes = 1
-		updateVotingRecord(db, votingRecordEntry)
-		votes, err := selectVotes(db, messageID)
+		_, err = s.ChannelMessageSendComplex(m.ChannelID, &discordgo.MessageSend{Embeds: []*discordgo.MessageEmbed{embed}, Components: buttons})
 		if err != nil {
-			oops(err, "selectVotes")
+			oops(err, "ChannelMessageSendComplex")
 			return
 		}
-		ChallengerVotes := votes.ChallengerVotes
-		DefenderVotes := votes.DefenderVotes
-		AbstainVotes := votes.AbstainVotes + 1
-		StopVotes := votes.StopVotes
-		updatedVotes := VotesStruct{ChallengerVotes, DefenderVotes, AbstainVotes, StopVotes}
-		updateVotes(db, messageID, updatedVotes)
-		votes, err = selectVotes(db, messageID)
+	}
+
+	//!season [start|end]
+	if strings.EqualFold(parameters[0], commandSeason) {
+		output, err := b.seasonCommand(s, m, parameters)
 		if err != nil {
-			oops(err, "selectVotes")
+			oops(err, "seasonCommand")
 			return
 		}
-		updateOutcome(db, messageID, votes)
-		_, err = selectChallengeRow(db, messageID)
+		_, err = s.ChannelMessageSend(m.ChannelID, output)
 		if err != nil {
-			oops(err, "selectChallengeRow")
+			oops(err, "ChannelMessageSend")
 			return
 		}
 	}
 
-	if reactionEmoji == "✋" {
-		db, err := ConnectToDB()
+	//!cancel [challenge id]
+	if strings.EqualFold(parameters[0], commandCancel) {
+		output, err := b.cancelCommand(s, m, parameters)
 		if err != nil {
-			oops(err, "connectToDB")
+			oops(err, "cancelCommand")
 			return
 		}
-		defer func(db *sqlx.DB) {
-			err := db.Close()
-			if err != nil {
-				oops(err, "Close()")
-			}
-		}(db)
-		if checkStopVotes(db, messageID) == 2 {
+		_, err = s.ChannelMessageSend(m.ChannelID, output)
+		if err != nil {
+			oops(err, "ChannelMessageSend")
 			return
 		}
-		challengeEntry, err := selectChallengeRow(db, messageID)
+	}
+
+	//!settings [<setting> <value>]
+	if strings.EqualFold(parameters[0], commandSettings) {
+		output, err := b.settingsCommand(s, m, parameters)
 		if err != nil {
-			oops(err, "selectChallengeRow")
+			oops(err, "settingsCommand")
 			return
 		}
-		stopVotesTotal := checkStopVotes(db, messageID)
-		userVotingRecord, err := selectVotingRecordRow(db, reactionAuthorID, messageID)
-		challengeVotes, err := selectVotes(db, messageID)
-		if !hasVotedStop(db, userVotingRecord) {
-			userVotingRecord.StopVotes = 1
-			updateVotingRecord(db, userVotingRecord)
-			challengeVotes.StopVotes += 1
-			updateVotes(db, messageID, challengeVotes)
-		}
-		stopVotesTotal = checkStopVotes(db, messageID)
-		if stopVotesTotal != 2 {
+		_, err = s.ChannelMessageSend(m.ChannelID, output)
+		if err != nil {
+			oops(err, "ChannelMessageSend")
 			return
 		}
-		if stopVotesTotal == 2 {
-			pushScore(db, challengeEntry)
-			winnerIsChallenger := "\n<@" + challengeEntry.ChallengerID + "> has won the challenge!\n\nThe score was: " + strconv.Itoa(challengeEntry.ChallengerVotes) + " to " + strconv.Itoa(challengeEntry.DefenderVotes)
-			winnerIsDefender := "\n<@" + challengeEntry.DefenderID + "> has won the challenge!\n\nThe score was: " + strconv.Itoa(challengeEntry.DefenderVotes) + " to " + strconv.Itoa(challengeEntry.ChallengerVotes)
-			tie := "\nThe challenge between <@" + challengeEntry.ChallengerID + "> and <@" + challengeEntry.DefenderID + "> was a tie!"
-			_, err = selectScoreboardRow(db, challengeEntry.ChallengerID)
-			if err != nil {
-				oops(err, "selectScoreboardRow")
-			}
-			_, err = selectScoreboardRow(db, challengeEntry.DefenderID)
-			if winnerID(challengeEntry) == "tie" {
-				_, err := s.ChannelMessageSend(r.ChannelID, tie)
-				if err != nil {
-					oops(err, "ChannelMessageSend")
-					return
-				}
-			}
-			if winnerID(challengeEntry) == challengeEntry.ChallengerID {
-				_, err := s.ChannelMessageSend(r.ChannelID, winnerIsChallenger)
-				if err != nil {
-					oops(err, "ChannelMessageSend")
-					return
-				}
-			}
-			if winnerID(challengeEntry) == challengeEntry.DefenderID {
-				_, err := s.ChannelMessageSend(r.ChannelID, winnerIsDefender)
-				if err != nil {
-					oops(err, "ChannelMessageSend")
-					return
-				}
-			}
-		}
 	}
+
 }
 
-// MessageReactionDelete trigger>response for messagereactionremove events
-func MessageReactionDelete(s *discordgo.Session, r *discordgo.MessageReactionRemove) {
-	reactionEmoji := r.Emoji.Name
-	messageID := r.MessageID
-	reactionAuthorID := r.UserID
+// InteractionCreate trigger>response for interactioncreate events: application commands, voting buttons and the previous/next buttons of paged embeds
+func (b *Bot) InteractionCreate(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	b.interactionCreate(s, i.Interaction)
+}
 
-	if reactionEmoji == "🛹" {
-		log.Println("Skateboard removed")
+func (b *Bot) interactionCreate(s session, i *discordgo.Interaction) {
+	if i.Type == discordgo.InteractionApplicationCommand {
+		b.applicationCommand(s, i)
+		return
+	}
+	if i.Type != discordgo.InteractionMessageComponent {
+		return
+	}
+	customID := i.MessageComponentData().CustomID
+	if vote, ok := parseVoteButtonID(customID); ok {
+		b.voteButtonClicked(s, i, vote)
+		return
+	}
+	if customID == acceptButtonID || customID == declineButtonID {
+		b.acceptButtonClicked(s, i, customID == acceptButtonID)
+		return
+	}
+	var embed *discordgo.MessageEmbed
+	var buttons []discordgo.MessageComponent
+	var err error
+	if userID, length, page, ok := parseHistoryButtonID(customID); ok {
+		embed, buttons, err = b.historyPage(i.GuildID, userID, length, page)
+	} else if messageID, page, ok := parseInfoButtonID(customID); ok {
+		embed, buttons, err = b.infoPage(i.GuildID, messageID, page)
+	} else if sort, season, page, ok := parseLeaderboardButtonID(customID); ok {
+		embed, buttons, err = b.leaderboardPage(i.GuildID, sort, season, page)
+	} else {
+		return
+	}
+	if err != nil {
+		oops(err, "page "+customID)
+		return
+	}
+	//swap the page shown in the message the button is on
+	err = s.InteractionRespond(i, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseUpdateMessage,
+		Data: &discordgo.InteractionResponseData{Embeds: []*discordgo.MessageEmbed{embed}, Components: buttons},
+	})
+	if err != nil {
+		oops(err, "InteractionRespond")
+	}
+}
+
+func leaderboardUsage() string {
+	sorts := []string{}
+	for _, sort := range leaderboardSorts {
+		sorts = append(sorts, string(sort))
 	}
+	return "Usage: " + commandLeaderboard + " [" + strings.Join(sorts, "|") + "] [" + seasonArgPrefix + "<number>]"
+}
 
-	if reactionEmoji == "🟦" {
-		db, err := ConnectToDB()
-		if err != nil {
-			oops(err, "connectToDB")
+// MessageReactionCreate trigger>response for messagereactionadd events
+func (b *Bot) MessageReactionCreate(s *discordgo.Session, r *discordgo.MessageReactionAdd) {
+	//ignore all reactions created by the bot itself
+	if r.UserID == s.State.User.ID {
+		return
+	}
+	b.messageReactionCreate(s, r.MessageReaction)
+}
+
+func (b *Bot) messageReactionCreate(s session, r *discordgo.MessageReaction) {
+	if r.Emoji.Name == "🛹" {
+		log.Println("Skateboard detected")
+	}
+
+	if !isVoteEmoji(r.Emoji.Name) {
+		return
+	}
+	if r.Emoji.Name == voteStop {
+		err := b.checkCloser(s, r.GuildID, r.MessageID, r.UserID, nil)
+		if err == ErrNotCloser {
+			b.removeSwitchedReaction(s, r.ChannelID, r.MessageID, r.UserID, StopVote)
 			return
 		}
-		defer func(db *sqlx.DB) {
-			err := db.Close()
-			if err != nil {
-				oops(err, "Close()")
+		if err != nil {
+			if err != sql.ErrNoRows {
+				oops(err, "checkCloser")
 			}
-		}(db)
-		if checkStopVotes(db, messageID) == 2 {
 			return
 		}
-		votingRecordEntry, err := selectVotingRecordRow(db, reactionAuthorID, messageID)
-		if hasVotedBlue(db, votingRecordEntry) {
-			removeVotingRecordRow(db, votingRecordEntry)
-			votes, err := selectVotes(db, messageID)
-			if err != nil {
-				oops(err, "selectVotes")
-				return
-			}
-			ChallengerVotes := votes.ChallengerVotes - 1
-			DefenderVotes := votes.DefenderVotes
-			AbstainVotes := votes.AbstainVotes
-			StopVotes := votes.StopVotes
-			updatedVotes := VotesStruct{ChallengerVotes, DefenderVotes, AbstainVotes, StopVotes}
-			updateVotes(db, messageID, updatedVotes)
-			votes, err = selectVotes(db, messageID)
-			if err != nil {
-				oops(err, "selectVotes")
-				return
-			}
-			updateOutcome(db, messageID, votes)
-			_, err = selectChallengeRow(db, messageID)
-			if err != nil {
-				oops(err, "selectChallengeRow")
-				return
-			}
+	}
+	challengeEntry, replaced, closed, err := b.addVote(r.GuildID, r.MessageID, r.UserID, r.Emoji.Name)
+	if err == ErrParticipantVote || err == ErrAlreadyAbstained {
+		//take the reaction off like a switched vote's, so it doesn't look like it counts
+		vote, _ := voteForEmoji(r.Emoji.Name)
+		b.removeSwitchedReaction(s, r.ChannelID, r.MessageID, r.UserID, vote)
+		return
+	}
+	if err != nil {
+		if err != sql.ErrNoRows {
+			oops(err, "addVote")
 		}
+		return
 	}
+	b.removeSwitchedReaction(s, r.ChannelID, r.MessageID, r.UserID, replaced)
+	b.updateTally(s, r.GuildID, r.MessageID)
+	if closed {
+		b.sendResult(s, r.ChannelID, challengeEntry, "")
+	}
+}
 
-	if reactionEmoji == "🟨" {
-		db, err := ConnectToDB()
-		if err != nil {
-			oops(err, "ConnectToDB")
-			return
-		}
-		defer func(db *sqlx.DB) {
-			err := db.Close()
-			if err != nil {
-				oops(err, "Close()")
-			}
-		}(db)
-		if checkStopVotes(db, messageID) == 2 {
-			return
-		}
-		votingRecordEntry, err := selectVotingRecordRow(db, reactionAuthorID, messageID)
-		if hasVotedYellow(db, votingRecordEntry) {
-			removeVotingRecordRow(db, votingRecordEntry)
-			votes, err := selectVotes(db, messageID)
-			if err != nil {
-				oops(err, "selectVotes")
-				return
-			}
-			ChallengerVotes := votes.ChallengerVotes
-			DefenderVotes := votes.DefenderVotes - 1
-			AbstainVotes := votes.AbstainVotes
-			StopVotes := votes.StopVotes
-			updatedVotes := VotesStruct{ChallengerVotes, DefenderVotes, AbstainVotes, StopVotes}
-			updateVotes(db, messageID, updatedVotes)
-			votes, err = selectVotes(db, messageID)
-			if err != nil {
-				oops(err, "selectVotes")
-				return
-			}
-			updateOutcome(db, messageID, votes)
-			_, err = selectChallengeRow(db, messageID)
+// MessageReactionDelete trigger>response for messagereactionremove events
+func (b *Bot) MessageReactionDelete(s *discordgo.Session, r *discordgo.MessageReactionRemove) {
+	b.messageReactionDelete(s, r.MessageReaction)
+}
+
+func (b *Bot) messageReactionDelete(s session, r *discordgo.MessageReaction) {
+	if r.Emoji.Name == "🛹" {
+		log.Println("Skateboard removed")
+	}
+
+	if !isVoteEmoji(r.Emoji.Name) {
+		return
+	}
+	challengeEntry, closed, err := b.removeVote(r.GuildID, r.MessageID, r.UserID, r.Emoji.Name)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			oops(err, "removeVote")
 		}
+		return
+	}
+	b.updateTally(s, r.GuildID, r.MessageID)
+	if closed {
+		b.sendResult(s, r.ChannelID, challengeEntry, "")
+	}
+}
+
+func isVoteEmoji(emoji string) bool {
+	_, ok := voteForEmoji(emoji)
+	return ok
+}
+
+func challengeAnnouncement(challengerID string, defenderID string, statement string, deadline int64, settings GuildSettingsEntryStruct) string {
+	challengerInfo := "<@" + challengerID + ">" + challengeMessage1 + "<@" + defenderID + ">" + "!"
+	debate := "\n\n<@" + defenderID + ">" + " says: `" + statement + "`\n\n<@" + challengerID + "> disagrees!\n"
+	votingInfo := "\n" + challengeMessage2 + challengeMessage3 + "<@" + challengerID + ">" + challengeMessage4 + "<@" + defenderID + ">" + challengeMessage5 + challengeMessage6 + " (" + settings.closeText() + ")"
+	if deadline > 0 {
+		//Discord shows <t:...:R> as a countdown in each reader's own time zone
+		votingInfo += "\n\nVoting closes <t:" + strconv.FormatInt(deadline, 10) + ":R>"
 	}
+	return challengerInfo + debate + votingInfo
+}
+
+// challengeRefusal explains why challenger can't challenge a message by author, it's empty when they can
+func challengeRefusal(challenger *discordgo.User, author *discordgo.User) string {
+	if author.ID == challenger.ID {
+		return "Sorry, you can't challenge your own message."
+	}
+	if author.Bot {
+		return "Sorry, bots can't be challenged, they can't vote or defend themselves."
+	}
+	return ""
+}
+
+// openChallenge starts the challenge against the author of the challenged message. Voting opens
+// right away with the voting reactions on its announcement, unless the guild's settings make the
+// defender accept first, then the announcement says who it's waiting for. If another challenge
+// got past the guild's limits first, the announcement is changed to the refusal instead
+func (b *Bot) openChallenge(s session, guildID string, channelID string, announcementID string, challenger *discordgo.User, challenged *discordgo.Message, deadline int64, settings GuildSettingsEntryStruct) error {
+	acceptBy := settings.acceptBy(time.Now())
+	err := b.startChallenge(guildID, channelID, announcementID, challenger.ID, challenger.Username, challenged.Author.ID, challenged.Author.Username, challenged.Content, challenged.ID, deadline, acceptBy)
+	if refusal, ok := err.(limitRefusal); ok {
+		return b.refuseAnnouncement(s, channelID, announcementID, string(refusal))
+	}
+	if err != nil {
+		return err
+	}
+	if acceptBy == 0 {
+		return addVoteReactions(s, channelID, announcementID)
+	}
+	b.editTally(s, guildID, announcementID)
+	return nil
+}
 
-	if reactionEmoji == "🟥" {
-		db, err := ConnectToDB()
+// addVoteReactions adds the voting reactions to a challenge's announcement
+func addVoteReactions(s session, channelID string, announcementID string) error {
+	for _, emoji := range []string{voteChallenger, voteDefender, voteAbstain, voteStop} {
+		err := s.MessageReactionAdd(channelID, announcementID, emoji)
 		if err != nil {
-			oops(err, "connectToDB")
-			return
-		}
-		defer func(db *sqlx.DB) {
-			err := db.Close()
-			if err != nil {
-				oops(err, "Close()")
-			}
-		}(db)
-		if checkStopVotes(db, messageID) == 2 {
-			return
-		}
-		votingRecordEntry, err := selectVotingRecordRow(db, reactionAuthorID, messageID)
-		if hasVotedRed(db, votingRecordEntry) {
-			removeVotingRecordRow(db, votingRecordEntry)
-			votes, err := selectVotes(db, messageID)
-			if err != nil {
-				oops(err, "selectVotes")
-				return
-			}
-			ChallengerVotes := votes.ChallengerVotes
-			DefenderVotes := votes.DefenderVotes
-			AbstainVotes := votes.AbstainVotes - 1
-			StopVotes := votes.StopVotes
-			updatedVotes := VotesStruct{ChallengerVotes, DefenderVotes, AbstainVotes, StopVotes}
-			updateVotes(db, messageID, updatedVotes)
-			votes, err = selectVotes(db, messageID)
-			if err != nil {
-				oops(err, "selectVotes")
-				return
-			}
-			updateOutcome(db, messageID, votes)
-			_, err = selectChallengeRow(db, messageID)
-			if err != nil {
-				oops(err, "selectChallengeRow")
-				return
-			}
+			return err
 		}
 	}
+	return nil
+}
 
-	if reactionEmoji == "✋" {
-		db, err := ConnectToDB()
+// startChallenge stores a new challenge and makes sure both users are on the guild's scoreboard,
+// statement and statementMessageID are the challenged message's text and ID, and deadline is when
+// the scheduler closes it (0 to wait for stop votes). acceptBy is when a challenge waiting for the
+// defender to accept is given up on, 0 opens voting right away. It fails with a limitRefusal if the
+// challenge breaks one of the guild's limits
+func (b *Bot) startChallenge(guildID string, channelID string, messageID string, authorUserID string, authorUsername string, referencedAuthorID string, referencedAuthorUsername string, statement string, statementMessageID string, deadline int64, acceptBy int64) error {
+	//create ChallengeTableEntry
+	challengeTableEntry := initChallengeTableEntry(guildID, channelID, messageID, authorUserID, authorUsername, referencedAuthorID, referencedAuthorUsername)
+	challengeTableEntry.Deadline = deadline
+	if acceptBy > 0 {
+		challengeTableEntry.Status = ChallengePending
+		challengeTableEntry.AcceptBy = acceptBy
+	}
+	challengeTableEntry.Statement = statement
+	challengeTableEntry.StatementMessageID = statementMessageID
+	challengeTableEntry.CreatedAt = time.Now().Unix()
+	refusal, err := b.Store.InsertChallengeRowWithinLimits(challengeTableEntry, b.guildSettings(guildID))
+	if err != nil {
+		return err
+	}
+	if refusal != "" {
+		return limitRefusal(refusal)
+	}
+
+	//createScoreboardTableEntry x2 (one for challenger, one for defender)
+	if !b.Store.UserInScoreboard(guildID, authorUserID) {
+		err = b.Store.InsertScoreboardRow(initScoreBoardRow(guildID, authorUserID, authorUsername))
 		if err != nil {
-			oops(err, "connectToDB")
-			return
-		}
-		defer func(db *sqlx.DB) {
-			err := db.Close()
-			if err != nil {
-				oops(err, "Close()")
-			}
-		}(db)
-		if checkStopVotes(db, messageID) == 2 {
-			return
+			return err
 		}
-		challengeEntry, err := selectChallengeRow(db, messageID)
+	}
+	if !b.Store.UserInScoreboard(guildID, referencedAuthorID) {
+		err = b.Store.InsertScoreboardRow(initScoreBoardRow(guildID, referencedAuthorID, referencedAuthorUsername))
 		if err != nil {
-			oops(err, "selectChallengeRow")
-			return
+			return err
 		}
-		userVotingRecord, err := selectVotingRecordRow(db, reactionAuthorID, messageID)
-		challengeVotes, err := selectVotes(db, messageID)
-		stopVotesTotal := checkStopVotes(db, messageID)
-		if hasVotedStop(db, userVotingRecord) {
-			userVotingRecord.StopVotes = 0
-			updateVotingRecord(db, userVotingRecord)
-			challengeVotes.StopVotes -= 1
-			updateVotes(db, messageID, challengeVotes)
-		}
-		stopVotesTotal = checkStopVotes(db, messageID)
-		if stopVotesTotal != 2 {
-			return
-		}
-		if stopVotesTotal == 2 {
-			pushScore(db, challengeEntry)
-			winnerIsChallenger := "\n<@" + challengeEntry.ChallengerID + "> has won the challenge!\n\nThe score was: " + strconv.Itoa(challengeEntry.ChallengerVotes) + " to " + strconv.Itoa(challengeEntry.DefenderVotes)
-			winnerIsDefender := "\n<@" + challengeEntry.DefenderID + "> has won the challenge!\n\nThe score was: " + strconv.Itoa(challengeEntry.DefenderVotes) + " to " + strconv.Itoa(challengeEntry.ChallengerVotes)
-			tie := "\nThe challenge between <@" + challengeEntry.ChallengerID + "> and <@" + challengeEntry.DefenderID + "> was a tie!"
-			_, err := selectScoreboardRow(db, challengeEntry.ChallengerID)
-			if err != nil {
-				oops(err, "selectScoreboardRow")
-			}
-			_, err = selectScoreboardRow(db, challengeEntry.DefenderID)
-			if err != nil {
-				oops(err, "selectScoreboardRow")
-			}
-			if winnerID(challengeEntry) == "tie" {
-				_, err := s.ChannelMessageSend(r.ChannelID, tie)
-				if err != nil {
-					oops(err, "ChannelMessageSend")
-					return
-				}
-			}
-			if winnerID(challengeEntry) == challengeEntry.ChallengerID {
-				_, err := s.ChannelMessageSend(r.ChannelID, winnerIsChallenger)
-				if err != nil {
-					oops(err, "ChannelMessageSend")
-					return
-				}
-			}
-			if winnerID(challengeEntry) == challengeEntry.DefenderID {
-				_, err := s.ChannelMessageSend(r.ChannelID, winnerIsDefender)
-				if err != nil {
-					oops(err, "ChannelMessageSend")
-					return
-				}
-			}
+	}
+	return nil
+}
+
+// addVote records a voting reaction, closed is true when it was the vote that ended the challenge.
+// replaced is the side the user voted for before, or NoVote
+func (b *Bot) addVote(GuildID string, MessageID string, UserID string, emoji string) (challengeEntry ChallengeTableEntryStruct, replaced Vote, closed bool, err error) {
+	vote, ok := voteForEmoji(emoji)
+	if !ok {
+		return challengeEntry, NoVote, false, nil
+	}
+	challengeEntry, replaced, _, closed, err = b.recordVote(GuildID, MessageID, UserID, vote, true)
+	return challengeEntry, replaced, closed, ignoreUncountedVote(err)
+}
+
+// removeVote takes back a voting reaction, only while the challenge is still open. With a
+// percentage close rule fewer voters can mean the stop votes are now enough, so it can close it too
+func (b *Bot) removeVote(GuildID string, MessageID string, UserID string, emoji string) (challengeEntry ChallengeTableEntryStruct, closed bool, err error) {
+	vote, ok := voteForEmoji(emoji)
+	if !ok {
+		return challengeEntry, false, nil
+	}
+	challengeEntry, _, _, closed, err = b.recordVote(GuildID, MessageID, UserID, vote, false)
+	return challengeEntry, closed, ignoreUncountedVote(err)
+}
+
+// ignoreUncountedVote drops the errors for reactions that just don't count, like a second ✋
+// or taking back a side the user already switched away from
+func ignoreUncountedVote(err error) error {
+	if err == ErrAlreadyVoted {
+		alreadyVoted()
+		return nil
+	}
+	if err == ErrNotVoted || err == ErrVotingClosed {
+		return nil
+	}
+	return err
+}
+
+// recordVote adds or takes back a vote under the guild's close rule, closed is true if that
+// closed the challenge and pushed its score. A new side replaces the user's old one, which is
+// returned (or NoVote). counted is the vote as the guild's participant vote rule counts it, taking
+// a vote back goes by how it was recorded instead, in case the rule changed since. Votes that
+// can't count come back as ErrAlreadyVoted, ErrAlreadyAbstained, ErrNotVoted, ErrVotingClosed or
+// ErrParticipantVote for the caller to explain
+func (b *Bot) recordVote(GuildID string, MessageID string, UserID string, vote Vote, add bool) (challengeEntry ChallengeTableEntryStruct, replaced Vote, counted Vote, closed bool, err error) {
+	settings := b.guildSettings(GuildID)
+	rule := settings.closeRule()
+	replaced = NoVote
+	recorded := vote
+	if add {
+		recorded, err = b.participantVote(settings, MessageID, UserID, vote)
+	}
+	counted = countedAs(recorded)
+	if err != nil {
+		return challengeEntry, NoVote, counted, false, err
+	}
+	if add {
+		challengeEntry, replaced, err = b.Store.RecordVote(GuildID, MessageID, UserID, recorded, rule)
+	} else {
+		challengeEntry, err = b.Store.RemoveVote(GuildID, MessageID, UserID, recorded, rule)
+	}
+	if err != nil {
+		return challengeEntry, NoVote, counted, false, err
+	}
+	//only the vote that met the close rule gets a closed row back, already scored in the same
+	//step, any later one fails with ErrVotingClosed, so the score is pushed exactly once
+	return challengeEntry, replaced, counted, challengeEntry.Status == ChallengeClosed, nil
+}
+
+// participantVote is how an added vote is recorded under the guild's participant vote rule. Only
+// side votes from the challenger or defender are affected: ignored ones fail with
+// ErrParticipantVote, and abstaining ones become ChallengerAbstain or DefenderAbstain, so the
+// voting record keeps which reaction cast the abstention
+func (b *Bot) participantVote(settings GuildSettingsEntryStruct, MessageID string, UserID string, vote Vote) (Vote, error) {
+	if settings.ParticipantVotes == CountParticipantVotes || (vote != ChallengerVote && vote != DefenderVote) {
+		return vote, nil
+	}
+	challengeEntry, err := b.Store.SelectChallengeRow(settings.GuildID, MessageID)
+	if err != nil {
+		return vote, err
+	}
+	if UserID != challengeEntry.ChallengerID && UserID != challengeEntry.DefenderID {
+		return vote, nil
+	}
+	if settings.ParticipantVotes == ParticipantVotesAbstain && vote == ChallengerVote {
+		return ChallengerAbstain, nil
+	}
+	if settings.ParticipantVotes == ParticipantVotesAbstain {
+		return DefenderAbstain, nil
+	}
+	return vote, ErrParticipantVote
+}
+
+// removeSwitchedReaction takes the reaction for a user's old side off the announcement after
+// they switch, if the bot is set to. Discord then sends a reaction removal for it, which is
+// ignored since the vote is already gone
+func (b *Bot) removeSwitchedReaction(s session, channelID string, messageID string, userID string, replaced Vote) {
+	if !b.Config.RemoveSwitchedReactions || replaced == NoVote {
+		return
+	}
+	err := s.MessageReactionRemove(channelID, messageID, emojiForVote(replaced), userID)
+	if err != nil {
+		oops(err, "MessageReactionRemove")
+	}
+}
+
+func voteForEmoji(emoji string) (Vote, bool) {
+	switch emoji {
+	case voteChallenger:
+		return ChallengerVote, true
+	case voteDefender:
+		return DefenderVote, true
+	case voteAbstain:
+		return AbstainVote, true
+	case voteStop:
+		return StopVote, true
+	}
+	return 0, false
+}
+
+func emojiForVote(vote Vote) string {
+	switch vote {
+	case ChallengerVote:
+		return voteChallenger
+	case DefenderVote:
+		return voteDefender
+	case AbstainVote:
+		return voteAbstain
+	}
+	return voteStop
+}
+
+// resultMessage announces the winner of a closed challenge
+func resultMessage(challengeEntry ChallengeTableEntryStruct) string {
+	if forfeited(challengeEntry) {
+		return "\n<@" + challengeEntry.ChallengerID + "> has won the challenge!\n\n" + acceptanceLine(challengeEntry)
+	}
+	if winnerID(challengeEntry) == challengeEntry.ChallengerID {
+		return "\n<@" + challengeEntry.ChallengerID + "> has won the challenge!\n\nThe score was: " + strconv.Itoa(challengeEntry.ChallengerVotes) + " to " + strconv.Itoa(challengeEntry.DefenderVotes)
+	}
+	if winnerID(challengeEntry) == challengeEntry.DefenderID {
+		return "\n<@" + challengeEntry.DefenderID + "> has won the challenge!\n\nThe score was: " + strconv.Itoa(challengeEntry.DefenderVotes) + " to " + strconv.Itoa(challengeEntry.ChallengerVotes)
+	}
+	return "\nThe challenge between <@" + challengeEntry.ChallengerID + "> and <@" + challengeEntry.DefenderID + "> was a tie!"
+}
+
+// mentionedUser is the user a !checkscore mention is for, from the message's mentions so their avatar is known
+func mentionedUser(m *discordgo.Message, mention string) *discordgo.User {
+	match := RegexUserPatternID.FindStringSubmatch(mention)
+	if match == nil {
+		return &discordgo.User{}
+	}
+	userID := match[1]
+	for _, user := range m.Mentions {
+		if user.ID == userID {
+			return user
 		}
 	}
+	return &discordgo.User{ID: userID}
+}
+
+// checkScore builds the plain text !checkscore reply for a mentioned user, from the scoreboard of the guild it was asked in
+func (b *Bot) checkScore(guildID string, mention string) (string, error) {
+	re, err := regexp.Compile(`[^\w]`)
+	if err != nil {
+		oops(err, "regexp.Compile()")
+		return "", err
+	}
+	mentionedUser := re.ReplaceAllString(mention, "")
+	mentionedScoreboard, err := b.Store.SelectScoreboardRow(guildID, mentionedUser)
+	if err == sql.ErrNoRows {
+		return "<@" + mentionedUser + "> hasn't taken part in any challenges yet!", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	output := "<@" + mentionedUser + "> has the following challenge record:\n" + scoreboardToString(mentionedScoreboard)
+	achievements, err := b.achievementNames(guildID, mentionedUser)
+	if err != nil {
+		return "", err
+	}
+	if len(achievements) > 0 {
+		output += "\nAchievements: " + strings.Join(achievements, ", ")
+	}
+	return output, nil
 }
@@ -0,0 +1,388 @@
+package db
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// fakeSession records what the handlers send instead of talking to Discord
+type fakeSession struct {
+	mu          sync.Mutex
+	sent        []string
+	reactions   []string
+	complex     []*discordgo.MessageSend
+	responses   []*discordgo.InteractionResponse
+	removed     []string
+	edits       []*discordgo.MessageEdit
+	permissions int64
+	//each user's roles, for GuildMember
+	roles map[string][]string
+	//what the messages the bot sent or edited look like now, by ID
+	messages map[string]*discordgo.Message
+}
+
+func (f *fakeSession) store(m *discordgo.Message) {
+	if f.messages == nil {
+		f.messages = map[string]*discordgo.Message{}
+	}
+	f.messages[m.ID] = m
+}
+
+func (f *fakeSession) ChannelMessageSend(channelID string, content string) (*discordgo.Message, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.sent = append(f.sent, content)
+	return &discordgo.Message{ID: strconv.Itoa(100 + len(f.sent)), ChannelID: channelID, Content: content}, nil
+}
+
+func (f *fakeSession) ChannelMessageSendComplex(channelID string, data *discordgo.MessageSend) (*discordgo.Message, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.complex = append(f.complex, data)
+	m := &discordgo.Message{ID: strconv.Itoa(100 + len(f.sent) + len(f.complex)), ChannelID: channelID, Content: data.Content, Embeds: data.Embeds}
+	f.store(m)
+	return m, nil
+}
+
+func (f *fakeSession) ChannelMessage(channelID, messageID string) (*discordgo.Message, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	m, ok := f.messages[messageID]
+	if !ok {
+		return &discordgo.Message{ID: messageID, ChannelID: channelID}, nil
+	}
+	return m, nil
+}
+
+func (f *fakeSession) GuildMember(guildID, userID string) (*discordgo.Member, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return &discordgo.Member{GuildID: guildID, User: &discordgo.User{ID: userID}, Roles: f.roles[userID]}, nil
+}
+
+func (f *fakeSession) UserChannelPermissions(userID, channelID string) (int64, error) {
+	return f.permissions, nil
+}
+
+func (f *fakeSession) InteractionRespond(interaction *discordgo.Interaction, resp *discordgo.InteractionResponse) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.responses = append(f.responses, resp)
+	return nil
+}
+
+func (f *fakeSession) InteractionResponse(appID string, interaction *discordgo.Interaction) (*discordgo.Message, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return &discordgo.Message{ID: strconv.Itoa(200 + len(f.responses)), ChannelID: interaction.ChannelID}, nil
+}
+
+func (f *fakeSession) MessageReactionAdd(channelID, messageID, emojiID string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.reactions = append(f.reactions, emojiID)
+	return nil
+}
+
+func (f *fakeSession) MessageReactionRemove(channelID, messageID, emojiID, userID string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.removed = append(f.removed, userID+":"+emojiID)
+	return nil
+}
+
+func (f *fakeSession) ChannelMessageEditComplex(m *discordgo.MessageEdit) (*discordgo.Message, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.edits = append(f.edits, m)
+	edited := &discordgo.Message{ID: m.ID, ChannelID: m.Channel, Embeds: m.Embeds}
+	if old, ok := f.messages[m.ID]; ok {
+		edited.Content = old.Content
+	}
+	if m.Content != nil {
+		edited.Content = *m.Content
+	}
+	f.store(edited)
+	return edited, nil
+}
+
+// testConfig edits the live tally straight away, so tests don't leave timers running
+func testConfig() Config {
+	config := DefaultConfig()
+	config.TallyInterval = 0
+	return config
+}
+
+func newTestBot() *Bot {
+	return NewBot(nil, NewMemoryStore(), testConfig())
+}
+
+// newTestChallenge returns a bot with challenge "0" between Gabe (1) and Miia (2)
+func newTestChallenge(t *testing.T) *Bot {
+	b := newTestBot()
+	err := b.startChallenge(testGuildID, testChannelID, "0", "1", "Gabe", "2", "Miia", testResponse, "5", 0, 0)
+	if err != nil {
+		t.Fatalf("got %s, wanted nil", err)
+	}
+	return b
+}
+
+func TestStartChallenge(t *testing.T) {
+	b := newTestChallenge(t)
+	challengeRow, err := b.Store.SelectChallengeRow(testGuildID, "0")
+	if err != nil {
+		t.Fatalf("got %s, wanted nil", err)
+	}
+	if challengeRow.ChallengerID != "1" || challengeRow.DefenderID != "2" {
+		t.Errorf("got %q vs %q, wanted %q vs %q", challengeRow.ChallengerID, challengeRow.DefenderID, "1", "2")
+	}
+	if !b.Store.UserInScoreboard(testGuildID, "1") || !b.Store.UserInScoreboard(testGuildID, "2") {
+		t.Errorf("both participants should be on the scoreboard")
+	}
+}
+
+func TestAddVoteCountsOncePerUser(t *testing.T) {
+	b := newTestChallenge(t)
+	b.addVote(testGuildID, "0", "10", voteChallenger)
+	b.addVote(testGuildID, "0", "10", voteChallenger)
+	b.addVote(testGuildID, "0", "11", voteDefender)
+	b.addVote(testGuildID, "0", "12", voteDefender)
+	//switching sides moves the vote instead of adding another
+	_, replaced, _, _ := b.addVote(testGuildID, "0", "10", voteDefender)
+	if replaced != ChallengerVote {
+		t.Errorf("got %d, wanted %d", replaced, ChallengerVote)
+	}
+	votes, _ := b.Store.SelectVotes(testGuildID, "0")
+	expected := VotesStruct{0, 3, 0, 0}
+	if votes != expected {
+		t.Errorf("got %v, wanted %v", votes, expected)
+	}
+	challengeRow, _ := b.Store.SelectChallengeRow(testGuildID, "0")
+	if challengeRow.Outcome != 2 {
+		t.Errorf("got %d, wanted %d", challengeRow.Outcome, 2)
+	}
+}
+
+func TestAddVoteIgnoresOtherMessages(t *testing.T) {
+	b := newTestChallenge(t)
+	_, _, closed, err := b.addVote(testGuildID, "5", "10", voteChallenger)
+	if err == nil || closed {
+		t.Errorf("a reaction on a message that isn't a challenge should be ignored")
+	}
+	_, err = b.Store.SelectVotingRecordRow(testGuildID, "10", "5")
+	if err == nil {
+		t.Errorf("no voting record should be stored for other messages")
+	}
+}
+
+func TestRemoveVote(t *testing.T) {
+	b := newTestChallenge(t)
+	b.addVote(testGuildID, "0", "10", voteChallenger)
+	b.addVote(testGuildID, "0", "10", voteStop)
+	b.removeVote(testGuildID, "0", "10", voteChallenger)
+	votes, _ := b.Store.SelectVotes(testGuildID, "0")
+	expected := VotesStruct{0, 0, 0, 1}
+	if votes != expected {
+		t.Errorf("got %v, wanted %v", votes, expected)
+	}
+	votingRecord, err := b.Store.SelectVotingRecordRow(testGuildID, "10", "0")
+	if err != nil || votingRecord.StopVotes != 1 {
+		t.Errorf("removing a vote should keep the user's stop vote")
+	}
+	b.removeVote(testGuildID, "0", "10", voteStop)
+	_, err = b.Store.SelectVotingRecordRow(testGuildID, "10", "0")
+	if err == nil {
+		t.Errorf("voting record should be removed once the user has no votes left")
+	}
+}
+
+func TestStopVotesCloseChallenge(t *testing.T) {
+	b := newTestChallenge(t)
+	b.addVote(testGuildID, "0", "10", voteChallenger)
+	_, _, closed, _ := b.addVote(testGuildID, "0", "10", voteStop)
+	if closed {
+		t.Errorf("one stop vote should not close the challenge")
+	}
+	_, _, closed, _ = b.addVote(testGuildID, "0", "10", voteStop)
+	if closed {
+		t.Errorf("the same user voting stop twice should not close the challenge")
+	}
+	challengeRow, _, closed, _ := b.addVote(testGuildID, "0", "11", voteStop)
+	if !closed {
+		t.Fatalf("two stop votes should close the challenge")
+	}
+	if !strings.Contains(resultMessage(challengeRow), "<@1> has won the challenge!") {
+		t.Errorf("got %q, wanted the challenger to win", resultMessage(challengeRow))
+	}
+	challenger, _ := b.Store.SelectScoreboardRow(testGuildID, "1")
+	if challenger.SuccessfulChallenges != 1 {
+		t.Errorf("got %d, wanted %d", challenger.SuccessfulChallenges, 1)
+	}
+	b.addVote(testGuildID, "0", "12", voteDefender)
+	votes, _ := b.Store.SelectVotes(testGuildID, "0")
+	if votes.DefenderVotes != 0 {
+		t.Errorf("votes after closing should be ignored")
+	}
+}
+
+func TestCheckScore(t *testing.T) {
+	b := newTestChallenge(t)
+	actual, err := b.checkScore(testGuildID, "<@!1>")
+	if err != nil {
+		t.Fatalf("got %s, wanted nil", err)
+	}
+	if !strings.HasPrefix(actual, "<@1> has the following challenge record:\n`Gabe") {
+		t.Errorf("got %q", actual)
+	}
+	actual, _ = b.checkScore(testGuildID, "<@3>")
+	if actual != "<@3> hasn't taken part in any challenges yet!" {
+		t.Errorf("got %q", actual)
+	}
+}
+
+func TestMessageCreateChallenge(t *testing.T) {
+	b := newTestBot()
+	s := &fakeSession{}
+	statement := &discordgo.Message{ID: "50", GuildID: testGuildID, Content: "Pineapple belongs on pizza", Author: &discordgo.User{ID: "2", Username: "Miia"}}
+	b.messageCreate(s, &discordgo.Message{ID: "51", GuildID: testGuildID, ChannelID: "9", Content: "!challenge", Type: discordgo.MessageTypeReply, Author: &discordgo.User{ID: "1", Username: "Gabe"}, ReferencedMessage: statement})
+	if len(s.complex) != 1 || !strings.Contains(s.complex[0].Content, "Pineapple belongs on pizza") {
+		t.Fatalf("got %+v, wanted the challenge announcement", s.complex)
+	}
+	if len(s.complex[0].Components) != 1 {
+		t.Errorf("got %+v, wanted a row of voting buttons", s.complex[0].Components)
+	}
+	if strings.Join(s.reactions, "") != voteChallenger+voteDefender+voteAbstain+voteStop {
+		t.Errorf("got %q, wanted the four voting reactions", s.reactions)
+	}
+	challengeRow, err := b.Store.SelectChallengeRow(testGuildID, "101")
+	if err != nil {
+		t.Fatalf("got %s, wanted the challenge stored under the announcement's ID", err)
+	}
+	if challengeRow.ChallengerID != "1" || challengeRow.DefenderID != "2" {
+		t.Errorf("got %q vs %q, wanted %q vs %q", challengeRow.ChallengerID, challengeRow.DefenderID, "1", "2")
+	}
+	if challengeRow.Statement != "Pineapple belongs on pizza" || challengeRow.StatementMessageID != "50" || challengeRow.ChannelID != "9" || challengeRow.CreatedAt == 0 {
+		t.Errorf("got %+v, wanted the statement, its message, the channel and the start time", challengeRow)
+	}
+}
+
+func TestMessageCreateChallengeRefused(t *testing.T) {
+	b := newTestBot()
+	s := &fakeSession{}
+	gabe := &discordgo.User{ID: "1", Username: "Gabe"}
+	own := &discordgo.Message{ID: "50", GuildID: testGuildID, Content: "I'm always right", Author: gabe}
+	bot := &discordgo.Message{ID: "52", GuildID: testGuildID, Content: testResponse, Author: &discordgo.User{ID: "99", Username: "Velociraptor", Bot: true}}
+	b.messageCreate(s, &discordgo.Message{ID: "51", GuildID: testGuildID, ChannelID: "9", Content: "!challenge", Type: discordgo.MessageTypeReply, Author: gabe, ReferencedMessage: own})
+	b.messageCreate(s, &discordgo.Message{ID: "53", GuildID: testGuildID, ChannelID: "9", Content: "!challenge", Type: discordgo.MessageTypeReply, Author: gabe, ReferencedMessage: bot})
+	expected := []string{
+		"Sorry, you can't challenge your own message.",
+		"Sorry, bots can't be challenged, they can't vote or defend themselves.",
+	}
+	if strings.Join(s.sent, "|") != strings.Join(expected, "|") {
+		t.Errorf("got %q, wanted %q", s.sent, expected)
+	}
+	if len(s.complex) != 0 || b.Store.UserInScoreboard(testGuildID, "1") {
+		t.Errorf("neither challenge should have started")
+	}
+}
+
+func TestMessageReactionCreateSwitchesVote(t *testing.T) {
+	b := newTestChallenge(t)
+	s := &fakeSession{}
+	b.messageReactionCreate(s, &discordgo.MessageReaction{GuildID: testGuildID, UserID: "10", MessageID: "0", ChannelID: "9", Emoji: discordgo.Emoji{Name: voteChallenger}})
+	b.messageReactionCreate(s, &discordgo.MessageReaction{GuildID: testGuildID, UserID: "10", MessageID: "0", ChannelID: "9", Emoji: discordgo.Emoji{Name: voteDefender}})
+	if len(s.removed) != 1 || s.removed[0] != "10:"+voteChallenger {
+		t.Errorf("got %q, wanted the old reaction removed", s.removed)
+	}
+	//Discord then tells the bot the old reaction is gone
+	b.messageReactionDelete(s, &discordgo.MessageReaction{GuildID: testGuildID, UserID: "10", MessageID: "0", ChannelID: "9", Emoji: discordgo.Emoji{Name: voteChallenger}})
+	votes, _ := b.Store.SelectVotes(testGuildID, "0")
+	if votes != (VotesStruct{0, 1, 0, 0}) {
+		t.Errorf("got %v, wanted %v", votes, VotesStruct{0, 1, 0, 0})
+	}
+
+	b.Config.RemoveSwitchedReactions = false
+	b.messageReactionCreate(s, &discordgo.MessageReaction{GuildID: testGuildID, UserID: "10", MessageID: "0", ChannelID: "9", Emoji: discordgo.Emoji{Name: voteAbstain}})
+	if len(s.removed) != 1 {
+		t.Errorf("got %q, reactions shouldn't be removed when turned off", s.removed)
+	}
+}
+
+func TestMessageReactionCreateAnnouncesWinner(t *testing.T) {
+	b := newTestChallenge(t)
+	s := &fakeSession{}
+	reactions := []*discordgo.MessageReaction{
+		{GuildID: testGuildID, UserID: "10", MessageID: "0", ChannelID: "9", Emoji: discordgo.Emoji{Name: voteDefender}},
+		{GuildID: testGuildID, UserID: "10", MessageID: "0", ChannelID: "9", Emoji: discordgo.Emoji{Name: voteStop}},
+		{GuildID: testGuildID, UserID: "11", MessageID: "0", ChannelID: "9", Emoji: discordgo.Emoji{Name: voteStop}},
+	}
+	for _, r := range reactions {
+		b.messageReactionCreate(s, r)
+	}
+	if len(s.sent) != 1 || !strings.Contains(s.sent[0], "<@2> has won the challenge!") {
+		t.Errorf("got %q, wanted the defender to win", s.sent)
+	}
+	b.messageReactionDelete(s, reactions[0])
+	votes, _ := b.Store.SelectVotes(testGuildID, "0")
+	if votes.DefenderVotes != 1 {
+		t.Errorf("removing a reaction after voting closed should not change the score")
+	}
+}
+
+// TestConcurrentReactions fires reactions the way discordgo does, each in its own goroutine,
+// and checks that no vote is lost and the challenge is only closed once
+func TestConcurrentReactions(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store) {
+		b := NewBot(nil, store, testConfig())
+		err := b.startChallenge(testGuildID, testChannelID, "0", "1", "Gabe", "2", "Miia", testResponse, "5", 0, 0)
+		if err != nil {
+			t.Fatalf("got %s, wanted nil", err)
+		}
+		s := &fakeSession{}
+		emojis := []string{voteChallenger, voteDefender, voteDefender, voteAbstain}
+		voters := 300
+		var wg sync.WaitGroup
+		for i := 0; i < voters; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				b.messageReactionCreate(s, &discordgo.MessageReaction{GuildID: testGuildID, UserID: strconv.Itoa(1000 + i), MessageID: "0", ChannelID: "9", Emoji: discordgo.Emoji{Name: emojis[i%len(emojis)]}})
+			}(i)
+		}
+		wg.Wait()
+		votes, err := b.Store.SelectVotes(testGuildID, "0")
+		if err != nil {
+			t.Fatalf("got %s, wanted nil", err)
+		}
+		expected := VotesStruct{75, 150, 75, 0}
+		if votes != expected {
+			t.Errorf("got %v, wanted %v", votes, expected)
+		}
+		for i := 0; i < voters; i++ {
+			_, err := b.Store.SelectVotingRecordRow(testGuildID, strconv.Itoa(1000+i), "0")
+			if err != nil {
+				t.Errorf("vote from %d was dropped: %s", 1000+i, err)
+			}
+		}
+
+		for i := 0; i < 20; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				b.messageReactionCreate(s, &discordgo.MessageReaction{GuildID: testGuildID, UserID: strconv.Itoa(1000 + i), MessageID: "0", ChannelID: "9", Emoji: discordgo.Emoji{Name: voteStop}})
+			}(i)
+		}
+		wg.Wait()
+		if len(s.sent) != 1 {
+			t.Errorf("got %d result messages, wanted 1", len(s.sent))
+		}
+		defender, _ := b.Store.SelectScoreboardRow(testGuildID, "2")
+		if defender.SuccessfulDefenses != 1 {
+			t.Errorf("got %d, wanted %d", defender.SuccessfulDefenses, 1)
+		}
+	})
+}
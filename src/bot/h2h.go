@@ -0,0 +1,148 @@
+package db
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// matchRecord is wins, losses and ties from one user's side
+type matchRecord struct {
+	Wins   int
+	Losses int
+	Ties   int
+}
+
+func (r matchRecord) String() string {
+	return fmt.Sprintf("%dW %dL %dT", r.Wins, r.Losses, r.Ties)
+}
+
+// add counts one finished challenge from userID's side
+func (r *matchRecord) add(row ChallengeTableEntryStruct, userID string) {
+	switch winnerID(row) {
+	case "tie":
+		r.Ties++
+	case userID:
+		r.Wins++
+	default:
+		r.Losses++
+	}
+}
+
+// headToHead is two users' finished challenges against each other, from A's side
+type headToHead struct {
+	UserA string
+	UserB string
+	NameA string
+	NameB string
+	// Overall is A's record against B
+	Overall matchRecord
+	// AsChallenger is A's record when A challenged B, and BAsChallenger is B's when B challenged A
+	AsChallenger  matchRecord
+	BAsChallenger matchRecord
+	// BestStreakA and BestStreakB are the most wins in a row each of them had, ties end a streak
+	BestStreakA int
+	BestStreakB int
+	// CurrentStreak is how many of the latest meetings in a row CurrentHolder won, 0 after a tie
+	CurrentStreak int
+	CurrentHolder string
+	Meetings      int
+	Last          ChallengeTableEntryStruct
+}
+
+// computeHeadToHead works out the rivalry from the challenges between A and B, oldest first
+func computeHeadToHead(rows []ChallengeTableEntryStruct, userA string, userB string) headToHead {
+	h := headToHead{UserA: userA, UserB: userB, Meetings: len(rows)}
+	for _, row := range rows {
+		//the latest usernames win
+		if row.ChallengerID == userA {
+			h.NameA, h.NameB = row.ChallengerName, row.DefenderName
+			h.AsChallenger.add(row, userA)
+		} else {
+			h.NameA, h.NameB = row.DefenderName, row.ChallengerName
+			h.BAsChallenger.add(row, userB)
+		}
+		h.Overall.add(row, userA)
+
+		winner := winnerID(row)
+		if winner == "tie" {
+			h.CurrentStreak, h.CurrentHolder = 0, ""
+		} else if winner == h.CurrentHolder {
+			h.CurrentStreak++
+		} else {
+			h.CurrentStreak, h.CurrentHolder = 1, winner
+		}
+		if h.CurrentHolder == userA && h.CurrentStreak > h.BestStreakA {
+			h.BestStreakA = h.CurrentStreak
+		}
+		if h.CurrentHolder == userB && h.CurrentStreak > h.BestStreakB {
+			h.BestStreakB = h.CurrentStreak
+		}
+		h.Last = row
+	}
+	return h
+}
+
+// parseHeadToHeadArgs reads the two users given to !h2h
+func parseHeadToHeadArgs(m *discordgo.Message, args []string) (string, string, bool) {
+	if len(args) != 2 || !RegexUserPatternID.MatchString(args[0]) || !RegexUserPatternID.MatchString(args[1]) {
+		return "", "", false
+	}
+	return mentionedUser(m, args[0]).ID, mentionedUser(m, args[1]).ID, true
+}
+
+func headToHeadUsage() string {
+	return "Usage: " + commandHeadToHead + " @user @user"
+}
+
+// headToHeadEmbed is the !h2h reply for two users in a guild
+func (b *Bot) headToHeadEmbed(guildID string, userA string, userB string) (*discordgo.MessageEmbed, error) {
+	rows, err := b.Store.SelectHeadToHead(guildID, userA, userB)
+	if err != nil {
+		return nil, err
+	}
+	h := computeHeadToHead(rows, userA, userB)
+	embed := &discordgo.MessageEmbed{
+		Title: "Head to head",
+		Color: headToHeadColor,
+	}
+	if h.Meetings == 0 {
+		embed.Description = "<@" + userA + "> and <@" + userB + "> haven't finished a challenge against each other yet!"
+		return embed, nil
+	}
+	embed.Title = h.NameA + " vs " + h.NameB
+	embed.Description = headToHeadLeader(h)
+	embed.Fields = []*discordgo.MessageEmbedField{
+		{Name: h.NameA, Value: h.Overall.String(), Inline: true},
+		{Name: h.NameB, Value: matchRecord{h.Overall.Losses, h.Overall.Wins, h.Overall.Ties}.String(), Inline: true},
+		{Name: "Meetings", Value: strconv.Itoa(h.Meetings), Inline: true},
+		{Name: h.NameA + " as challenger", Value: h.AsChallenger.String(), Inline: true},
+		{Name: h.NameB + " as challenger", Value: h.BAsChallenger.String(), Inline: true},
+		{Name: "Longest streaks", Value: fmt.Sprintf("<@%s>: %d\n<@%s>: %d", userA, h.BestStreakA, userB, h.BestStreakB), Inline: true},
+		{Name: "Last meeting", Value: fmt.Sprintf("%s · %s\n> %s\nID: `%s`", challengeDate(h.Last, "d"), leaderLine(h.Last), truncateStatement(h.Last.Statement, maxStatementLength), h.Last.MessageID)},
+	}
+	return embed, nil
+}
+
+// headToHeadLeader says who leads the rivalry, and who is on a run if anyone is
+func headToHeadLeader(h headToHead) string {
+	leader := "It's all square"
+	if h.Overall.Wins > h.Overall.Losses {
+		leader = fmt.Sprintf("<@%s> leads %d–%d", h.UserA, h.Overall.Wins, h.Overall.Losses)
+	} else if h.Overall.Losses > h.Overall.Wins {
+		leader = fmt.Sprintf("<@%s> leads %d–%d", h.UserB, h.Overall.Losses, h.Overall.Wins)
+	} else if h.Overall.Wins > 0 {
+		leader = fmt.Sprintf("It's all square at %d–%d", h.Overall.Wins, h.Overall.Losses)
+	}
+	if h.Overall.Ties == 1 {
+		leader += " with 1 tie"
+	} else if h.Overall.Ties > 1 {
+		leader += fmt.Sprintf(" with %d ties", h.Overall.Ties)
+	}
+	leader += "."
+	if h.CurrentStreak > 1 {
+		leader += fmt.Sprintf(" <@%s> has won the last %d.", h.CurrentHolder, h.CurrentStreak)
+	}
+	return leader
+}
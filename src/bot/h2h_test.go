@@ -0,0 +1,110 @@
+package db
+
+import (
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// addTestRivalry has Gabe (1) and Miia (2) meet six times: Gabe wins the first two, Miia wins
+// the third, the fourth is a tie and Miia wins the last two. Their open challenge, Gabe's
+// challenge against Sam (3) and their challenge in another guild don't count
+func addTestRivalry(store Store) {
+	meetings := []struct {
+		messageID    string
+		challengerID string
+		outcome      int
+	}{
+		{"20", "1", 1},
+		{"21", "2", 2},
+		{"22", "1", 2},
+		{"23", "1", 0},
+		{"24", "2", 1},
+		{"25", "2", 1},
+	}
+	names := map[string]string{"1": "Gabe", "2": "Miia"}
+	for i, meeting := range meetings {
+		defenderID := "2"
+		if meeting.challengerID == "2" {
+			defenderID = "1"
+		}
+		row := initChallengeTableEntry(testGuildID, testChannelID, meeting.messageID, meeting.challengerID, names[meeting.challengerID], defenderID, names[defenderID])
+		row.Outcome = meeting.outcome
+		row.Status = ChallengeClosed
+		row.CreatedAt = int64(2000 + i)
+		row.Statement = "statement " + meeting.messageID
+		store.InsertChallengeRow(row)
+	}
+	open := initChallengeTableEntry(testGuildID, testChannelID, "26", "1", "Gabe", "2", "Miia")
+	open.CreatedAt = 2010
+	store.InsertChallengeRow(open)
+	other := initChallengeTableEntry(testGuildID, testChannelID, "27", "1", "Gabe", "3", "Sam")
+	other.Status = ChallengeClosed
+	store.InsertChallengeRow(other)
+	elsewhere := initChallengeTableEntry("901", testChannelID, "28", "1", "Gabe", "2", "Miia")
+	elsewhere.Status = ChallengeClosed
+	store.InsertChallengeRow(elsewhere)
+}
+
+func TestStoreSelectHeadToHead(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store) {
+		addTestRivalry(store)
+		rows, err := store.SelectHeadToHead(testGuildID, "2", "1")
+		if err != nil {
+			t.Fatalf("got %s, wanted nil", err)
+		}
+		if historyMessageIDs(rows) != "20,21,22,23,24,25" {
+			t.Errorf("got %q, wanted %q", historyMessageIDs(rows), "20,21,22,23,24,25")
+		}
+		rows, _ = store.SelectHeadToHead(testGuildID, "2", "3")
+		if len(rows) != 0 {
+			t.Errorf("got %q, wanted no meetings", historyMessageIDs(rows))
+		}
+	})
+}
+
+func TestComputeHeadToHead(t *testing.T) {
+	store := NewMemoryStore()
+	addTestRivalry(store)
+	rows, _ := store.SelectHeadToHead(testGuildID, "1", "2")
+	h := computeHeadToHead(rows, "1", "2")
+	if h.Overall != (matchRecord{2, 3, 1}) {
+		t.Errorf("got %s, wanted %s", h.Overall, matchRecord{2, 3, 1})
+	}
+	if h.AsChallenger != (matchRecord{1, 1, 1}) || h.BAsChallenger != (matchRecord{2, 1, 0}) {
+		t.Errorf("got %s and %s, wanted %s and %s", h.AsChallenger, h.BAsChallenger, matchRecord{1, 1, 1}, matchRecord{2, 1, 0})
+	}
+	if h.BestStreakA != 2 || h.BestStreakB != 2 || h.CurrentStreak != 2 || h.CurrentHolder != "2" {
+		t.Errorf("got best streaks %d and %d, current %d for %q", h.BestStreakA, h.BestStreakB, h.CurrentStreak, h.CurrentHolder)
+	}
+	if h.Last.MessageID != "25" || h.NameA != "Gabe" || h.NameB != "Miia" {
+		t.Errorf("got %q, %q and %q", h.Last.MessageID, h.NameA, h.NameB)
+	}
+	expected := "<@2> leads 3–2 with 1 tie. <@2> has won the last 2."
+	if headToHeadLeader(h) != expected {
+		t.Errorf("got %q, wanted %q", headToHeadLeader(h), expected)
+	}
+}
+
+func TestMessageCreateHeadToHead(t *testing.T) {
+	b := newTestBot()
+	addTestRivalry(b.Store)
+	s := &fakeSession{}
+	b.messageCreate(s, &discordgo.Message{GuildID: testGuildID, ChannelID: testChannelID, Content: "!h2h <@1> <@!2>"})
+	if len(s.complex) != 1 || s.complex[0].Embeds[0].Title != "Gabe vs Miia" {
+		t.Fatalf("got %+v, wanted the rivalry embed", s.complex)
+	}
+	if s.complex[0].Embeds[0].Fields[0].Value != "2W 3L 1T" || s.complex[0].Embeds[0].Fields[1].Value != "3W 2L 1T" {
+		t.Errorf("got %q and %q", s.complex[0].Embeds[0].Fields[0].Value, s.complex[0].Embeds[0].Fields[1].Value)
+	}
+	b.messageCreate(s, &discordgo.Message{GuildID: testGuildID, ChannelID: testChannelID, Content: "!h2h <@2> <@3>"})
+	if len(s.complex) != 2 || s.complex[1].Embeds[0].Fields != nil {
+		t.Errorf("got %+v, wanted no meetings", s.complex[1].Embeds[0])
+	}
+	for _, content := range []string{"!h2h <@1>", "!h2h <@1> <@1>", "!h2h <@1> Miia", "!h2h <@1> <@&2>"} {
+		b.messageCreate(s, &discordgo.Message{GuildID: testGuildID, ChannelID: testChannelID, Content: content})
+	}
+	if len(s.sent) != 4 || s.sent[0] != "Usage: !h2h @user @user" {
+		t.Errorf("got %q, wanted the usage message four times", s.sent)
+	}
+}
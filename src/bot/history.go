@@ -0,0 +1,274 @@
+package db
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// parseHistoryArgs reads the optional @user and number of challenges given to !history,
+// with no @user it's the history of whoever asked
+func parseHistoryArgs(m *discordgo.Message, args []string) (string, int, bool) {
+	userID := m.Author.ID
+	length := defaultHistoryLength
+	if len(args) > 0 && RegexUserPatternID.MatchString(args[0]) {
+		userID = mentionedUser(m, args[0]).ID
+		args = args[1:]
+	}
+	if len(args) > 1 {
+		return "", 0, false
+	}
+	if len(args) == 1 {
+		n, err := strconv.Atoi(args[0])
+		if err != nil || n < 1 || n > maxHistoryLength {
+			return "", 0, false
+		}
+		length = n
+	}
+	return userID, length, true
+}
+
+func historyUsage() string {
+	return "Usage: " + commandHistory + " [@user] [1-" + strconv.Itoa(maxHistoryLength) + "]"
+}
+
+// historyButtonID is the custom ID of a previous/next button under a user's history
+func historyButtonID(userID string, length int, page int) string {
+	return historyButtonPrefix + userID + ":" + strconv.Itoa(length) + ":" + strconv.Itoa(page)
+}
+
+// parseHistoryButtonID undoes historyButtonID
+func parseHistoryButtonID(customID string) (string, int, int, bool) {
+	if !strings.HasPrefix(customID, historyButtonPrefix) {
+		return "", 0, 0, false
+	}
+	parts := strings.Split(strings.TrimPrefix(customID, historyButtonPrefix), ":")
+	if len(parts) != 3 || parts[0] == "" {
+		return "", 0, 0, false
+	}
+	length, err := strconv.Atoi(parts[1])
+	if err != nil || length < 1 || length > maxHistoryLength {
+		return "", 0, 0, false
+	}
+	page, err := strconv.Atoi(parts[2])
+	if err != nil {
+		return "", 0, 0, false
+	}
+	return parts[0], length, page, true
+}
+
+// historyPage draws one page (counting from 0) of the challenges a user took part in, newest
+// first and length to a page
+func (b *Bot) historyPage(guildID string, userID string, length int, page int) (*discordgo.MessageEmbed, []discordgo.MessageComponent, error) {
+	count, err := b.Store.CountChallengeHistory(guildID, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	pages := (count + length - 1) / length
+	if page >= pages {
+		page = pages - 1
+	}
+	if page < 0 {
+		page = 0
+	}
+	embed := &discordgo.MessageEmbed{
+		Title: "Challenge history",
+		Color: historyColor,
+	}
+	if count == 0 {
+		embed.Description = "<@" + userID + "> hasn't taken part in any challenges yet!"
+		return embed, nil, nil
+	}
+	rows, err := b.Store.SelectChallengeHistory(guildID, userID, length, page*length)
+	if err != nil {
+		return nil, nil, err
+	}
+	embed.Description = "Challenges <@" + userID + "> took part in, newest first:"
+	for _, row := range rows {
+		embed.Fields = append(embed.Fields, historyField(row, userID))
+	}
+	embed.Footer = &discordgo.MessageEmbedFooter{Text: fmt.Sprintf("Page %d of %d · %s %s <id> for details", page+1, pages, commandChallenge, commandInfo)}
+	if pages == 1 {
+		return embed, nil, nil
+	}
+	buttons := pageButtons(historyButtonID(userID, length, page-1), historyButtonID(userID, length, page+1), page, pages)
+	return embed, buttons, nil
+}
+
+// historyField is one challenge as userID saw it: who against, how it went and what it was about
+func historyField(row ChallengeTableEntryStruct, userID string) *discordgo.MessageEmbedField {
+	opponent, role := row.DefenderName, "as challenger"
+	ownVotes, opponentVotes := row.ChallengerVotes, row.DefenderVotes
+	if row.ChallengerID != userID {
+		opponent, role = row.ChallengerName, "as defender"
+		ownVotes, opponentVotes = row.DefenderVotes, row.ChallengerVotes
+	}
+	result := "Voting open against "
+	if row.Status == ChallengePending {
+		result = "Waiting to be accepted against "
+	} else if row.Outcome == OutcomeCancelled && notAccepted(row) {
+		result = "Not accepted against "
+	} else if row.Outcome == OutcomeCancelled {
+		result = "Cancelled against "
+	} else if row.Status != ChallengeOpen {
+		switch winnerID(row) {
+		case "tie":
+			result = "Tied with "
+		case userID:
+			result = "Won against "
+		default:
+			result = "Lost against "
+		}
+	}
+	value := fmt.Sprintf("%s · %d–%d · %s\n> %s\nID: `%s`", role, ownVotes, opponentVotes, challengeDate(row, "d"), truncateStatement(row.Statement, maxStatementLength), row.MessageID)
+	return &discordgo.MessageEmbedField{Name: result + opponent, Value: value}
+}
+
+// challengeDate shows when a challenge started in each reader's own time zone, style is a
+// Discord timestamp style like "d" or "f"
+func challengeDate(row ChallengeTableEntryStruct, style string) string {
+	if row.CreatedAt == 0 {
+		return "date unknown"
+	}
+	return "<t:" + strconv.FormatInt(row.CreatedAt, 10) + ":" + style + ">"
+}
+
+// truncateStatement fits a statement on one quoted line of at most length characters
+func truncateStatement(statement string, length int) string {
+	if statement == "" {
+		return "*no statement recorded*"
+	}
+	statement = strings.Join(strings.Fields(statement), " ")
+	runes := []rune(statement)
+	if len(runes) > length {
+		return string(runes[:length-1]) + "…"
+	}
+	return statement
+}
+
+// parseChallengeID reads the ID given to !challenge info, a link to the announcement works too
+func parseChallengeID(s string) string {
+	parts := strings.Split(strings.TrimSuffix(s, "/"), "/")
+	return parts[len(parts)-1]
+}
+
+// infoButtonID is the custom ID of a previous/next button under a challenge's voters
+func infoButtonID(messageID string, page int) string {
+	return infoButtonPrefix + messageID + ":" + strconv.Itoa(page)
+}
+
+// parseInfoButtonID undoes infoButtonID
+func parseInfoButtonID(customID string) (string, int, bool) {
+	if !strings.HasPrefix(customID, infoButtonPrefix) {
+		return "", 0, false
+	}
+	parts := strings.Split(strings.TrimPrefix(customID, infoButtonPrefix), ":")
+	if len(parts) != 2 || parts[0] == "" {
+		return "", 0, false
+	}
+	page, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return "", 0, false
+	}
+	return parts[0], page, true
+}
+
+// infoPage draws everything about one challenge, with one page (counting from 0) of who voted
+// which way. It fails with sql.ErrNoRows for a challenge that isn't in the guild
+func (b *Bot) infoPage(guildID string, messageID string, page int) (*discordgo.MessageEmbed, []discordgo.MessageComponent, error) {
+	row, err := b.Store.SelectChallengeRow(guildID, messageID)
+	if err != nil {
+		return nil, nil, err
+	}
+	records, err := b.Store.SelectVotingRecords(guildID, messageID)
+	if err != nil {
+		return nil, nil, err
+	}
+	pages := (len(records) + infoVotersPageSize - 1) / infoVotersPageSize
+	if page >= pages {
+		page = pages - 1
+	}
+	if page < 0 {
+		page = 0
+	}
+	status := "Voting open"
+	if row.Status == ChallengePending {
+		status = "Waiting to be accepted"
+	} else if row.Outcome == OutcomeCancelled && notAccepted(row) {
+		status = "Not accepted"
+	} else if row.Outcome == OutcomeCancelled {
+		status = "Cancelled"
+	} else if row.Status != ChallengeOpen {
+		status = "Closed"
+	}
+	embed := &discordgo.MessageEmbed{
+		Title:       row.ChallengerName + " vs " + row.DefenderName,
+		URL:         messageLink(row.GuildID, row.ChannelID, row.MessageID),
+		Description: "<@" + row.DefenderID + "> said:\n> " + truncateStatement(row.Statement, 1000) + "\n\n<@" + row.ChallengerID + "> disagreed!",
+		Color:       historyColor,
+		Fields: []*discordgo.MessageEmbedField{
+			{Name: "Status", Value: status + "\n" + leaderLine(row), Inline: true},
+			{Name: "Started", Value: challengeDate(row, "f"), Inline: true},
+		},
+	}
+	if row.ClosedAt > 0 {
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{Name: "Closed", Value: "<t:" + strconv.FormatInt(row.ClosedAt, 10) + ":f>", Inline: true})
+	} else if row.Deadline > 0 {
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{Name: "Time limit", Value: "<t:" + strconv.FormatInt(row.Deadline, 10) + ":f>", Inline: true})
+	}
+	embed.Fields = append(embed.Fields,
+		&discordgo.MessageEmbedField{Name: voteChallenger + " " + row.ChallengerName, Value: strconv.Itoa(row.ChallengerVotes), Inline: true},
+		&discordgo.MessageEmbedField{Name: voteDefender + " " + row.DefenderName, Value: strconv.Itoa(row.DefenderVotes), Inline: true},
+		&discordgo.MessageEmbedField{Name: voteAbstain + " Abstain", Value: strconv.Itoa(row.AbstainVotes), Inline: true},
+	)
+	if row.StatementMessageID != "" {
+		embed.Description += "\n[Challenged message](" + messageLink(row.GuildID, row.ChannelID, row.StatementMessageID) + ")"
+	}
+	voters := &discordgo.MessageEmbedField{Name: "Voters", Value: "Nobody has voted yet."}
+	embed.Fields = append(embed.Fields, voters)
+	footer := challengeFooterPrefix + row.MessageID
+	if len(records) == 0 {
+		embed.Footer = &discordgo.MessageEmbedFooter{Text: footer}
+		return embed, nil, nil
+	}
+	lines := []string{}
+	end := page*infoVotersPageSize + infoVotersPageSize
+	if end > len(records) {
+		end = len(records)
+	}
+	for _, record := range records[page*infoVotersPageSize : end] {
+		lines = append(lines, voterLine(row, record))
+	}
+	voters.Value = strings.Join(lines, "\n")
+	embed.Footer = &discordgo.MessageEmbedFooter{Text: fmt.Sprintf("%s · Voters page %d of %d", footer, page+1, pages)}
+	if pages == 1 {
+		return embed, nil, nil
+	}
+	buttons := pageButtons(infoButtonID(messageID, page-1), infoButtonID(messageID, page+1), page, pages)
+	return embed, buttons, nil
+}
+
+// messageLink is the URL that jumps to a message
+func messageLink(guildID string, channelID string, messageID string) string {
+	return "https://discord.com/channels/" + guildID + "/" + channelID + "/" + messageID
+}
+
+// voterLine is who a user voted for, and whether they voted to close voting
+func voterLine(row ChallengeTableEntryStruct, record VotingRecordEntryStruct) string {
+	votes := []string{}
+	if record.ChallengerVotes > 0 {
+		votes = append(votes, voteChallenger+" <@"+row.ChallengerID+">")
+	}
+	if record.DefenderVotes > 0 {
+		votes = append(votes, voteDefender+" <@"+row.DefenderID+">")
+	}
+	if record.AbstainVotes > 0 {
+		votes = append(votes, voteAbstain+" abstained")
+	}
+	if record.StopVotes > 0 {
+		votes = append(votes, voteStop+" close voting")
+	}
+	return "<@" + record.UserID + ">: " + strings.Join(votes, ", ")
+}
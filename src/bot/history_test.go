@@ -0,0 +1,270 @@
+package db
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// addTestHistory gives user 1 three challenges in the test guild, two as challenger and one as
+// defender, and one in another guild. Challenge "11" was won by user 1 and "12" is still open
+func addTestHistory(store Store) {
+	rows := []ChallengeTableEntryStruct{
+		initChallengeTableEntry(testGuildID, testChannelID, "10", "1", "Gabe", "2", "Miia"),
+		initChallengeTableEntry(testGuildID, testChannelID, "11", "3", "Sam", "1", "Gabe"),
+		initChallengeTableEntry(testGuildID, testChannelID, "12", "1", "Gabe", "3", "Sam"),
+		initChallengeTableEntry(testGuildID, testChannelID, "13", "2", "Miia", "3", "Sam"),
+		initChallengeTableEntry("901", testChannelID, "14", "1", "Gabe", "2", "Miia"),
+	}
+	for i, row := range rows {
+		row.Statement = "statement " + row.MessageID
+		row.CreatedAt = int64(1000 + i)
+		if row.MessageID != "12" {
+			row.Status = ChallengeClosed
+		}
+		if row.MessageID == "11" {
+			row.DefenderVotes = 3
+			row.ChallengerVotes = 1
+			row.Outcome = 2
+		}
+		store.InsertChallengeRow(row)
+	}
+}
+
+func historyMessageIDs(rows []ChallengeTableEntryStruct) string {
+	ids := []string{}
+	for _, row := range rows {
+		ids = append(ids, row.MessageID)
+	}
+	return strings.Join(ids, ",")
+}
+
+func TestStoreSelectChallengeHistory(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store) {
+		addTestHistory(store)
+		rows, err := store.SelectChallengeHistory(testGuildID, "1", 10, 0)
+		if err != nil {
+			t.Fatalf("got %s, wanted nil", err)
+		}
+		if historyMessageIDs(rows) != "12,11,10" {
+			t.Errorf("got %q, wanted %q", historyMessageIDs(rows), "12,11,10")
+		}
+		if rows[0].Statement != "statement 12" || rows[0].CreatedAt != 1002 {
+			t.Errorf("got %q at %d, wanted %q at %d", rows[0].Statement, rows[0].CreatedAt, "statement 12", 1002)
+		}
+		rows, _ = store.SelectChallengeHistory(testGuildID, "1", 2, 1)
+		if historyMessageIDs(rows) != "11,10" {
+			t.Errorf("got %q, wanted %q", historyMessageIDs(rows), "11,10")
+		}
+		count, _ := store.CountChallengeHistory(testGuildID, "1")
+		if count != 3 {
+			t.Errorf("got %d, wanted %d", count, 3)
+		}
+		count, _ = store.CountChallengeHistory(testGuildID, "4")
+		if count != 0 {
+			t.Errorf("got %d, wanted %d", count, 0)
+		}
+	})
+}
+
+func TestStoreSelectVotingRecords(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store) {
+		store.InsertChallengeRow(initChallengeTableEntry(testGuildID, testChannelID, "0", "1", "Gabe", "2", "Miia"))
+		store.RecordVote(testGuildID, "0", "12", DefenderVote, twoStopVotes)
+		store.RecordVote(testGuildID, "0", "10", ChallengerVote, twoStopVotes)
+		store.RecordVote(testGuildID, "0", "10", StopVote, twoStopVotes)
+		records, err := store.SelectVotingRecords(testGuildID, "0")
+		if err != nil {
+			t.Fatalf("got %s, wanted nil", err)
+		}
+		if len(records) != 2 || records[0].UserID != "10" || records[1].UserID != "12" {
+			t.Fatalf("got %+v, wanted users 10 and 12", records)
+		}
+		if records[0].ChallengerVotes != 1 || records[0].StopVotes != 1 || records[1].DefenderVotes != 1 {
+			t.Errorf("got %+v", records)
+		}
+	})
+}
+
+func TestParseHistoryArgs(t *testing.T) {
+	m := &discordgo.Message{Author: &discordgo.User{ID: "1"}, Mentions: []*discordgo.User{{ID: "2", Username: "Miia"}}}
+	tests := []struct {
+		args   string
+		userID string
+		length int
+		ok     bool
+	}{
+		{"", "1", defaultHistoryLength, true},
+		{"10", "1", 10, true},
+		{"<@2>", "2", defaultHistoryLength, true},
+		{"<@!2> 3", "2", 3, true},
+		{"0", "", 0, false},
+		{"26", "", 0, false},
+		{"lots", "", 0, false},
+		{"3 <@2>", "", 0, false},
+		{"<@&2>", "", 0, false},
+	}
+	for _, test := range tests {
+		args := strings.Fields(test.args)
+		userID, length, ok := parseHistoryArgs(m, args)
+		if userID != test.userID || length != test.length || ok != test.ok {
+			t.Errorf("%q got %q, %d, %t, wanted %q, %d, %t", test.args, userID, length, ok, test.userID, test.length, test.ok)
+		}
+	}
+}
+
+func TestHistoryButtonIDs(t *testing.T) {
+	userID, length, page, ok := parseHistoryButtonID(historyButtonID("1", 5, 2))
+	if !ok || userID != "1" || length != 5 || page != 2 {
+		t.Errorf("got %q, %d, page %d", userID, length, page)
+	}
+	messageID, page, ok := parseInfoButtonID(infoButtonID("10", 1))
+	if !ok || messageID != "10" || page != 1 {
+		t.Errorf("got %q page %d", messageID, page)
+	}
+	for _, customID := range []string{"leaderboard:wins:1", "history:1:5", "history:1:99:0", "info:10", "info::1"} {
+		_, _, _, historyOK := parseHistoryButtonID(customID)
+		_, _, infoOK := parseInfoButtonID(customID)
+		if historyOK || infoOK {
+			t.Errorf("%q shouldn't parse", customID)
+		}
+	}
+}
+
+func TestTruncateStatement(t *testing.T) {
+	tests := []struct {
+		statement string
+		expected  string
+	}{
+		{"", "*no statement recorded*"},
+		{"short", "short"},
+		{"two\nlines", "two lines"},
+		{"ünïcödé statement", "ünïcödé s…"},
+	}
+	for _, test := range tests {
+		actual := truncateStatement(test.statement, 10)
+		if actual != test.expected {
+			t.Errorf("got %q, wanted %q", actual, test.expected)
+		}
+	}
+}
+
+func TestHistoryPage(t *testing.T) {
+	b := newTestBot()
+	embed, buttons, err := b.historyPage(testGuildID, "1", defaultHistoryLength, 0)
+	if err != nil {
+		t.Fatalf("got %s, wanted nil", err)
+	}
+	if !strings.Contains(embed.Description, "hasn't taken part") || buttons != nil {
+		t.Errorf("got %q, wanted an empty history", embed.Description)
+	}
+	addTestHistory(b.Store)
+	embed, buttons, _ = b.historyPage(testGuildID, "1", 2, 0)
+	if len(embed.Fields) != 2 || embed.Footer.Text != "Page 1 of 2 · !challenge info <id> for details" {
+		t.Fatalf("got %+v and %q", embed.Fields, embed.Footer.Text)
+	}
+	expected := []string{"Voting open against Sam", "Won against Sam"}
+	for i, field := range embed.Fields {
+		if field.Name != expected[i] {
+			t.Errorf("got %q, wanted %q", field.Name, expected[i])
+		}
+	}
+	if embed.Fields[1].Value != "as defender · 3–1 · <t:1001:d>\n> statement 11\nID: `11`" {
+		t.Errorf("got %q", embed.Fields[1].Value)
+	}
+	next := buttons[0].(discordgo.ActionsRow).Components[1].(discordgo.Button)
+	if next.Disabled || next.CustomID != "history:1:2:1" {
+		t.Errorf("got %+v, wanted next enabled", next)
+	}
+	embed, _, _ = b.historyPage(testGuildID, "1", 2, 5)
+	if len(embed.Fields) != 1 || embed.Fields[0].Name != "Tied with Miia" {
+		t.Errorf("got %+v, wanted the last page", embed.Fields)
+	}
+}
+
+func TestInfoPage(t *testing.T) {
+	b := newTestChallenge(t)
+	_, _, err := b.infoPage(testGuildID, "99", 0)
+	if err == nil {
+		t.Errorf("a missing challenge should fail")
+	}
+	embed, buttons, err := b.infoPage(testGuildID, "0", 0)
+	if err != nil {
+		t.Fatalf("got %s, wanted nil", err)
+	}
+	voters := embed.Fields[len(embed.Fields)-1]
+	if voters.Value != "Nobody has voted yet." || buttons != nil {
+		t.Errorf("got %q, wanted no voters", voters.Value)
+	}
+	if !strings.Contains(embed.Description, testResponse) || embed.Title != "Gabe vs Miia" {
+		t.Errorf("got %q and %q", embed.Title, embed.Description)
+	}
+	b.addVote(testGuildID, "0", "10", voteChallenger)
+	b.addVote(testGuildID, "0", "11", voteDefender)
+	b.addVote(testGuildID, "0", "11", voteStop)
+	for i := 0; i < infoVotersPageSize; i++ {
+		b.addVote(testGuildID, "0", "2"+strings.Repeat("0", i+1), voteAbstain)
+	}
+	embed, buttons, _ = b.infoPage(testGuildID, "0", 0)
+	voters = embed.Fields[len(embed.Fields)-1]
+	lines := strings.Split(voters.Value, "\n")
+	if len(lines) != infoVotersPageSize || lines[0] != "<@10>: 🟦 <@1>" || lines[1] != "<@11>: 🟨 <@2>, ✋ close voting" {
+		t.Errorf("got %q", voters.Value)
+	}
+	if embed.Footer.Text != "Challenge ID: 0 · Voters page 1 of 2" || buttons == nil {
+		t.Errorf("got %q, wanted two pages of voters", embed.Footer.Text)
+	}
+}
+
+func TestMessageCreateHistory(t *testing.T) {
+	b := newTestBot()
+	addTestHistory(b.Store)
+	s := &fakeSession{}
+	b.messageCreate(s, &discordgo.Message{GuildID: testGuildID, ChannelID: testChannelID, Author: &discordgo.User{ID: "1"}, Content: "!history"})
+	if len(s.complex) != 1 || len(s.complex[0].Embeds[0].Fields) != 3 {
+		t.Fatalf("got %+v, wanted the author's history", s.complex)
+	}
+	b.messageCreate(s, &discordgo.Message{GuildID: testGuildID, ChannelID: testChannelID, Author: &discordgo.User{ID: "1"}, Content: "!history <@3> 1"})
+	if len(s.complex) != 2 || s.complex[1].Embeds[0].Fields[0].Name != "Tied with Miia" || s.complex[1].Components == nil {
+		t.Errorf("got %+v, wanted one of user 3's challenges", s.complex[1])
+	}
+	b.messageCreate(s, &discordgo.Message{GuildID: testGuildID, ChannelID: testChannelID, Author: &discordgo.User{ID: "1"}, Content: "!history all"})
+	if len(s.sent) != 1 || !strings.HasPrefix(s.sent[0], "Usage: !history") {
+		t.Errorf("got %q, wanted the usage message", s.sent)
+	}
+}
+
+func TestMessageCreateChallengeInfo(t *testing.T) {
+	b := newTestChallenge(t)
+	s := &fakeSession{}
+	b.messageCreate(s, &discordgo.Message{GuildID: testGuildID, ChannelID: testChannelID, Author: &discordgo.User{ID: "1"}, Content: "!challenge info https://discord.com/channels/900/800/0"})
+	if len(s.complex) != 1 || s.complex[0].Embeds[0].Title != "Gabe vs Miia" {
+		t.Fatalf("got %+v, wanted the challenge's details", s.complex)
+	}
+	b.messageCreate(s, &discordgo.Message{GuildID: testGuildID, ChannelID: testChannelID, Author: &discordgo.User{ID: "1"}, Content: "!challenge info 99"})
+	if len(s.sent) != 1 || s.sent[0] != "Sorry, I couldn't find challenge 99." {
+		t.Errorf("got %q", s.sent)
+	}
+	b.messageCreate(s, &discordgo.Message{GuildID: testGuildID, ChannelID: testChannelID, Author: &discordgo.User{ID: "1"}, Content: "!challenge info", Type: discordgo.MessageTypeReply, ReferencedMessage: &discordgo.Message{ID: "0", Author: &discordgo.User{ID: "bot"}}})
+	if len(s.sent) != 1 || len(s.complex) != 2 || s.complex[1].Embeds[0].Title != "Gabe vs Miia" {
+		t.Errorf("got %q and %+v, wanted a reply to the announcement to show its details", s.sent, s.complex)
+	}
+}
+
+func TestInteractionCreateHistoryButton(t *testing.T) {
+	b := newTestBot()
+	addTestHistory(b.Store)
+	s := &fakeSession{}
+	b.interactionCreate(s, &discordgo.Interaction{
+		Type:    discordgo.InteractionMessageComponent,
+		GuildID: testGuildID,
+		Data:    discordgo.MessageComponentInteractionData{CustomID: historyButtonID("1", 1, 1)},
+	})
+	if len(s.responses) != 1 || s.responses[0].Type != discordgo.InteractionResponseUpdateMessage {
+		t.Fatalf("got %+v, wanted the message updated", s.responses)
+	}
+	if s.responses[0].Data.Embeds[0].Fields[0].Name != "Won against Sam" {
+		t.Errorf("got %q", s.responses[0].Data.Embeds[0].Fields[0].Name)
+	}
+}
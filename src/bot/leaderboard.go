@@ -0,0 +1,241 @@
+package db
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// LeaderboardSort is the stat a leaderboard is ranked by
+type LeaderboardSort string
+
+const (
+	SortWins       LeaderboardSort = "wins"
+	SortWinRate    LeaderboardSort = "winrate"
+	SortChallenges LeaderboardSort = "challenges"
+	SortDefenses   LeaderboardSort = "defenses"
+	SortRating     LeaderboardSort = "rating"
+)
+
+// leaderboardSorts lists the sorts in the order they're shown in help text
+var leaderboardSorts = []LeaderboardSort{SortWins, SortWinRate, SortChallenges, SortDefenses, SortRating}
+
+// parseLeaderboardSort reads the sort given to !leaderboard, no sort at all means SortWins
+func parseLeaderboardSort(s string) (LeaderboardSort, bool) {
+	if s == "" {
+		return SortWins, true
+	}
+	for _, sort := range leaderboardSorts {
+		if strings.EqualFold(s, string(sort)) {
+			return sort, true
+		}
+	}
+	return SortWins, false
+}
+
+// orderBy is the ORDER BY clause for the sort, ties always fall back to more wins and then
+// the user ID so pages don't shuffle between clicks. less must agree with it
+func (sort LeaderboardSort) orderBy() string {
+	switch sort {
+	case SortWinRate:
+		return "TotalChallengeWins * 1.0 / TotalChallenges DESC, TotalChallengeWins DESC, UserID"
+	case SortChallenges:
+		return "TotalChallenges DESC, TotalChallengeWins DESC, UserID"
+	case SortDefenses:
+		return "SuccessfulDefenses DESC, TotalChallengeWins DESC, UserID"
+	case SortRating:
+		return "Rating DESC, TotalChallengeWins DESC, UserID"
+	}
+	return "TotalChallengeWins DESC, TotalChallenges, UserID"
+}
+
+// less is orderBy for rows that aren't in a database
+func (sort LeaderboardSort) less(a ScoreboardTableEntryStruct, b ScoreboardTableEntryStruct) bool {
+	switch sort {
+	case SortWinRate:
+		//compare wins/challenges without dividing
+		if a.TotalChallengeWins*b.TotalChallenges != b.TotalChallengeWins*a.TotalChallenges {
+			return a.TotalChallengeWins*b.TotalChallenges > b.TotalChallengeWins*a.TotalChallenges
+		}
+	case SortChallenges:
+		if a.TotalChallenges != b.TotalChallenges {
+			return a.TotalChallenges > b.TotalChallenges
+		}
+	case SortDefenses:
+		if a.SuccessfulDefenses != b.SuccessfulDefenses {
+			return a.SuccessfulDefenses > b.SuccessfulDefenses
+		}
+	case SortRating:
+		if a.Rating != b.Rating {
+			return a.Rating > b.Rating
+		}
+	}
+	if a.TotalChallengeWins != b.TotalChallengeWins {
+		return a.TotalChallengeWins > b.TotalChallengeWins
+	}
+	if sort == SortWins && a.TotalChallenges != b.TotalChallenges {
+		return a.TotalChallenges < b.TotalChallenges
+	}
+	return a.UserID < b.UserID
+}
+
+// stat is the number a row is ranked on, as shown next to the user
+func (sort LeaderboardSort) stat(row ScoreboardTableEntryStruct) string {
+	switch sort {
+	case SortWinRate:
+		return strconv.Itoa(winRate(row)) + "% win rate"
+	case SortChallenges:
+		return strconv.Itoa(row.TotalChallenges) + " challenges"
+	case SortDefenses:
+		return strconv.Itoa(row.SuccessfulDefenses) + " successful defenses"
+	case SortRating:
+		return "rated " + strconv.Itoa(row.Rating)
+	}
+	return strconv.Itoa(row.TotalChallengeWins) + " wins"
+}
+
+func winRate(row ScoreboardTableEntryStruct) int {
+	if row.TotalChallenges == 0 {
+		return 0
+	}
+	return row.TotalChallengeWins * 100 / row.TotalChallenges
+}
+
+// parseLeaderboardArgs reads the sort and "season:N" given to !leaderboard, in either order
+func parseLeaderboardArgs(args []string) (LeaderboardSort, int, bool) {
+	sort, season := SortWins, currentSeason
+	sortGiven, seasonGiven := false, false
+	for _, arg := range args {
+		if n, ok := parseSeasonArg(arg); ok && !seasonGiven {
+			season, seasonGiven = n, true
+			continue
+		}
+		parsed, ok := parseLeaderboardSort(arg)
+		if !ok || sortGiven {
+			return SortWins, currentSeason, false
+		}
+		sort, sortGiven = parsed, true
+	}
+	return sort, season, true
+}
+
+// leaderboardButtonID is the custom ID of a previous/next button, it carries everything
+// needed to draw the page it leads to. The season is left off for the current one
+func leaderboardButtonID(sort LeaderboardSort, season int, page int) string {
+	customID := leaderboardButtonPrefix + string(sort) + ":" + strconv.Itoa(page)
+	if season != currentSeason {
+		customID += ":" + strconv.Itoa(season)
+	}
+	return customID
+}
+
+// parseLeaderboardButtonID undoes leaderboardButtonID
+func parseLeaderboardButtonID(customID string) (LeaderboardSort, int, int, bool) {
+	if !strings.HasPrefix(customID, leaderboardButtonPrefix) {
+		return SortWins, currentSeason, 0, false
+	}
+	parts := strings.Split(strings.TrimPrefix(customID, leaderboardButtonPrefix), ":")
+	if len(parts) != 2 && len(parts) != 3 {
+		return SortWins, currentSeason, 0, false
+	}
+	sort, ok := parseLeaderboardSort(parts[0])
+	if !ok {
+		return SortWins, currentSeason, 0, false
+	}
+	page, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return SortWins, currentSeason, 0, false
+	}
+	season := currentSeason
+	if len(parts) == 3 {
+		season, err = strconv.Atoi(parts[2])
+		if err != nil || season < 0 {
+			return SortWins, currentSeason, 0, false
+		}
+	}
+	return sort, season, page, true
+}
+
+// leaderboardPage draws one page (counting from 0) of a guild's leaderboard as an embed,
+// with previous/next buttons when there is more than one page. season is currentSeason for
+// the scoreboard as it is now, or the number of a season that has ended for its final standings
+func (b *Bot) leaderboardPage(guildID string, sort LeaderboardSort, season int, page int) (*discordgo.MessageEmbed, []discordgo.MessageComponent, error) {
+	seasons := b.guildSeasons(guildID)
+	running, seasonRunning := activeSeason(seasons)
+	if seasonRunning && season == running.Season {
+		season = currentSeason
+	}
+	title := "Leaderboard by " + string(sort)
+	empty := "Nobody has finished a challenge here yet!"
+	if season != currentSeason {
+		title = seasonName(season) + " final standings by " + string(sort)
+		empty = seasonName(season) + " hasn't ended, or there wasn't one."
+		if season == 0 {
+			empty = "Nobody finished a challenge here before seasons started."
+		}
+	} else if seasonRunning {
+		title = seasonName(running.Season) + " leaderboard by " + string(sort)
+		empty = "Nobody has finished a challenge this season yet!"
+	}
+
+	var count int
+	var err error
+	if season == currentSeason {
+		count, err = b.Store.CountLeaderboard(guildID)
+	} else {
+		count, err = b.Store.CountSeasonStandings(guildID, season)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	pages := (count + leaderboardPageSize - 1) / leaderboardPageSize
+	if page >= pages {
+		page = pages - 1
+	}
+	if page < 0 {
+		page = 0
+	}
+	embed := &discordgo.MessageEmbed{
+		Title: title,
+		Color: leaderboardColor,
+	}
+	if count == 0 {
+		embed.Description = empty
+		return embed, nil, nil
+	}
+	var rows []ScoreboardTableEntryStruct
+	if season == currentSeason {
+		rows, err = b.Store.SelectLeaderboard(guildID, sort, leaderboardPageSize, page*leaderboardPageSize)
+	} else {
+		var standings []SeasonStandingEntryStruct
+		standings, err = b.Store.SelectSeasonStandings(guildID, season, sort, leaderboardPageSize, page*leaderboardPageSize)
+		rows = standingsToScoreboard(standings)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	lines := []string{}
+	for i, row := range rows {
+		rank := page*leaderboardPageSize + i + 1
+		lines = append(lines, fmt.Sprintf("**%d.** <@%s>: %s (%dW %dL %dT)", rank, row.UserID, sort.stat(row), row.TotalChallengeWins, row.TotalChallengeLosses, row.TotalChallengeTies))
+	}
+	embed.Description = strings.Join(lines, "\n")
+	embed.Footer = &discordgo.MessageEmbedFooter{Text: fmt.Sprintf("Page %d of %d", page+1, pages)}
+	if pages == 1 {
+		return embed, nil, nil
+	}
+	buttons := pageButtons(leaderboardButtonID(sort, season, page-1), leaderboardButtonID(sort, season, page+1), page, pages)
+	return embed, buttons, nil
+}
+
+// pageButtons are the previous/next buttons under a paged embed, greyed out at either end
+func pageButtons(previousID string, nextID string, page int, pages int) []discordgo.MessageComponent {
+	return []discordgo.MessageComponent{
+		discordgo.ActionsRow{Components: []discordgo.MessageComponent{
+			discordgo.Button{Label: "Previous", Style: discordgo.SecondaryButton, CustomID: previousID, Disabled: page == 0},
+			discordgo.Button{Label: "Next", Style: discordgo.SecondaryButton, CustomID: nextID, Disabled: page == pages-1},
+		}},
+	}
+}
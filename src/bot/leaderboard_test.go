@@ -0,0 +1,175 @@
+package db
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// addTestScores puts users 1, 2 and 3 on the test guild's scoreboard with different records,
+// user 4 has a challenge going but none finished
+func addTestScores(store Store) {
+	rows := []ScoreboardTableEntryStruct{
+		{testGuildID, "1", "Gabe", 3, 3, 0, 6, 1, 3, 2, 0, 990, 0, 0, 0, 0},
+		{testGuildID, "2", "Miia", 4, 0, 0, 4, 4, 0, 0, 0, 1060, 4, 4, 0, 0},
+		{testGuildID, "3", "Sam", 1, 0, 1, 2, 0, 0, 1, 0, 1010, 0, 0, 0, 0},
+		{testGuildID, "4", "Alex", 0, 0, 0, 0, 0, 0, 0, 0, 1000, 0, 0, 0, 0},
+		{"901", "5", "Elsewhere", 9, 0, 0, 9, 9, 0, 0, 0, 1200, 0, 0, 0, 0},
+	}
+	for _, row := range rows {
+		store.InsertScoreboardRow(row)
+	}
+}
+
+func leaderboardUserIDs(rows []ScoreboardTableEntryStruct) string {
+	ids := []string{}
+	for _, row := range rows {
+		ids = append(ids, row.UserID)
+	}
+	return strings.Join(ids, ",")
+}
+
+func TestStoreSelectLeaderboard(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store) {
+		addTestScores(store)
+		tests := []struct {
+			sort     LeaderboardSort
+			expected string
+		}{
+			{SortWins, "2,1,3"},
+			{SortWinRate, "2,1,3"},
+			{SortChallenges, "1,2,3"},
+			{SortDefenses, "1,3,2"},
+			{SortRating, "2,3,1"},
+		}
+		for _, test := range tests {
+			rows, err := store.SelectLeaderboard(testGuildID, test.sort, 10, 0)
+			if err != nil {
+				t.Fatalf("got %s, wanted nil", err)
+			}
+			if leaderboardUserIDs(rows) != test.expected {
+				t.Errorf("sorting by %s got %q, wanted %q", test.sort, leaderboardUserIDs(rows), test.expected)
+			}
+		}
+		rows, _ := store.SelectLeaderboard(testGuildID, SortWins, 2, 1)
+		if leaderboardUserIDs(rows) != "1,3" {
+			t.Errorf("got %q, wanted %q", leaderboardUserIDs(rows), "1,3")
+		}
+		rows, _ = store.SelectLeaderboard(testGuildID, SortWins, 2, 4)
+		if len(rows) != 0 {
+			t.Errorf("got %q, wanted nobody past the end", leaderboardUserIDs(rows))
+		}
+		count, _ := store.CountLeaderboard(testGuildID)
+		if count != 3 {
+			t.Errorf("got %d, wanted %d", count, 3)
+		}
+	})
+}
+
+func TestParseLeaderboardSort(t *testing.T) {
+	sort, ok := parseLeaderboardSort("")
+	if !ok || sort != SortWins {
+		t.Errorf("got %q, wanted %q", sort, SortWins)
+	}
+	sort, ok = parseLeaderboardSort("WinRate")
+	if !ok || sort != SortWinRate {
+		t.Errorf("got %q, wanted %q", sort, SortWinRate)
+	}
+	_, ok = parseLeaderboardSort("losses")
+	if ok {
+		t.Errorf("losses isn't a leaderboard sort")
+	}
+}
+
+func TestLeaderboardButtonID(t *testing.T) {
+	sort, season, page, ok := parseLeaderboardButtonID(leaderboardButtonID(SortDefenses, currentSeason, 3))
+	if !ok || sort != SortDefenses || season != currentSeason || page != 3 {
+		t.Errorf("got %q season %d page %d, wanted %q season %d page %d", sort, season, page, SortDefenses, currentSeason, 3)
+	}
+	sort, season, page, ok = parseLeaderboardButtonID(leaderboardButtonID(SortRating, 2, 1))
+	if !ok || sort != SortRating || season != 2 || page != 1 {
+		t.Errorf("got %q season %d page %d, wanted %q season %d page %d", sort, season, page, SortRating, 2, 1)
+	}
+	for _, customID := range []string{"vote:1", "leaderboard:losses:1", "leaderboard:wins", "leaderboard:wins:x", "leaderboard:wins:1:x", "leaderboard:wins:1:-1"} {
+		_, _, _, ok = parseLeaderboardButtonID(customID)
+		if ok {
+			t.Errorf("%q shouldn't parse", customID)
+		}
+	}
+}
+
+func TestLeaderboardPage(t *testing.T) {
+	b := newTestBot()
+	embed, buttons, err := b.leaderboardPage(testGuildID, SortWins, currentSeason, 0)
+	if err != nil {
+		t.Fatalf("got %s, wanted nil", err)
+	}
+	if !strings.Contains(embed.Description, "Nobody") || buttons != nil {
+		t.Errorf("got %q, wanted an empty leaderboard", embed.Description)
+	}
+	for i := 0; i < 25; i++ {
+		b.Store.InsertScoreboardRow(ScoreboardTableEntryStruct{testGuildID, strconv.Itoa(100 + i), "user", 30 - i, 0, 0, 30 - i, 0, 0, 0, 0, initialRating, 0, 0, 0, 0})
+	}
+	embed, buttons, _ = b.leaderboardPage(testGuildID, SortWins, currentSeason, 0)
+	if !strings.HasPrefix(embed.Description, "**1.** <@100>: 30 wins") || embed.Footer.Text != "Page 1 of 3" {
+		t.Errorf("got %q and %q", embed.Description, embed.Footer.Text)
+	}
+	row := buttons[0].(discordgo.ActionsRow)
+	previous := row.Components[0].(discordgo.Button)
+	next := row.Components[1].(discordgo.Button)
+	if !previous.Disabled || next.Disabled || next.CustomID != "leaderboard:wins:1" {
+		t.Errorf("got %+v and %+v, wanted only next enabled", previous, next)
+	}
+	//pages past the end show the last page
+	embed, buttons, _ = b.leaderboardPage(testGuildID, SortWins, currentSeason, 7)
+	if !strings.HasPrefix(embed.Description, "**21.** <@120>: 10 wins") || embed.Footer.Text != "Page 3 of 3" {
+		t.Errorf("got %q and %q", embed.Description, embed.Footer.Text)
+	}
+	next = buttons[0].(discordgo.ActionsRow).Components[1].(discordgo.Button)
+	if !next.Disabled {
+		t.Errorf("next should be disabled on the last page")
+	}
+}
+
+func TestMessageCreateLeaderboard(t *testing.T) {
+	b := newTestBot()
+	addTestScores(b.Store)
+	s := &fakeSession{}
+	b.messageCreate(s, &discordgo.Message{GuildID: testGuildID, ChannelID: testChannelID, Content: "!leaderboard winrate"})
+	if len(s.complex) != 1 || s.complex[0].Embeds[0].Title != "Leaderboard by winrate" {
+		t.Fatalf("got %+v, wanted the leaderboard embed", s.complex)
+	}
+	if strings.Contains(s.complex[0].Embeds[0].Description, "<@5>") {
+		t.Errorf("users from other guilds shouldn't be on the leaderboard")
+	}
+	b.messageCreate(s, &discordgo.Message{GuildID: testGuildID, ChannelID: testChannelID, Content: "!leaderboard losses"})
+	if len(s.sent) != 1 || !strings.HasPrefix(s.sent[0], "Usage: !leaderboard") {
+		t.Errorf("got %q, wanted the usage message", s.sent)
+	}
+}
+
+func TestInteractionCreateLeaderboardButton(t *testing.T) {
+	b := newTestBot()
+	addTestScores(b.Store)
+	s := &fakeSession{}
+	b.interactionCreate(s, &discordgo.Interaction{
+		Type:    discordgo.InteractionMessageComponent,
+		GuildID: testGuildID,
+		Data:    discordgo.MessageComponentInteractionData{CustomID: leaderboardButtonID(SortChallenges, currentSeason, 0)},
+	})
+	if len(s.responses) != 1 || s.responses[0].Type != discordgo.InteractionResponseUpdateMessage {
+		t.Fatalf("got %+v, wanted the message updated", s.responses)
+	}
+	if s.responses[0].Data.Embeds[0].Title != "Leaderboard by challenges" {
+		t.Errorf("got %q", s.responses[0].Data.Embeds[0].Title)
+	}
+	b.interactionCreate(s, &discordgo.Interaction{
+		Type: discordgo.InteractionMessageComponent,
+		Data: discordgo.MessageComponentInteractionData{CustomID: "something else"},
+	})
+	if len(s.responses) != 1 {
+		t.Errorf("other buttons should be left alone")
+	}
+}
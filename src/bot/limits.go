@@ -0,0 +1,150 @@
+package db
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// ChallengeActivity is what a guild's challenge limits look at for a new challenge, worked out
+// from challengeTable so it survives restarts
+type ChallengeActivity struct {
+	ChallengerAt int64 `db:"ChallengerAt"`
+	//unix time the challenger last started a challenge, 0 if never
+	DefenderAt int64 `db:"DefenderAt"`
+	//unix time the defender was last challenged
+	ChannelAt int64 `db:"ChannelAt"`
+	//unix time a challenge last started in the channel
+	ChallengerOpen int `db:"ChallengerOpen"`
+	//open challenges the challenger is in, on either side, counting ones waiting to be accepted
+	DefenderOpen int `db:"DefenderOpen"`
+}
+
+func selectChallengeActivity(db dbtx, GuildID string, ChallengerID string, DefenderID string, ChannelID string) (ChallengeActivity, error) {
+	activity := ChallengeActivity{}
+	query := "SELECT " +
+		"(SELECT COALESCE(MAX(CreatedAt), 0) FROM challengeTable WHERE GuildID = ? AND ChallengerID = ?) AS ChallengerAt, " +
+		"(SELECT COALESCE(MAX(CreatedAt), 0) FROM challengeTable WHERE GuildID = ? AND DefenderID = ?) AS DefenderAt, " +
+		"(SELECT COALESCE(MAX(CreatedAt), 0) FROM challengeTable WHERE GuildID = ? AND ChannelID = ?) AS ChannelAt, " +
+		"(SELECT COUNT(*) FROM challengeTable WHERE GuildID = ? AND Status != ? AND (ChallengerID = ? OR DefenderID = ?)) AS ChallengerOpen, " +
+		"(SELECT COUNT(*) FROM challengeTable WHERE GuildID = ? AND Status != ? AND (ChallengerID = ? OR DefenderID = ?)) AS DefenderOpen"
+	err := db.Get(&activity, db.Rebind(query),
+		GuildID, ChallengerID,
+		GuildID, DefenderID,
+		GuildID, ChannelID,
+		GuildID, ChallengeClosed, ChallengerID, ChallengerID,
+		GuildID, ChallengeClosed, DefenderID, DefenderID)
+	return activity, err
+}
+
+var errBadCooldown = errors.New("cooldowns look like 30m, 2h or 1d, up to 7 days, or off")
+
+// parseCooldown reads a cooldown given to !settings cooldown as seconds, off is 0
+func parseCooldown(s string) (int, error) {
+	if strings.EqualFold(s, "off") || s == "0" {
+		return 0, nil
+	}
+	d, err := parseChallengeDuration(s)
+	if err != nil {
+		return 0, errBadCooldown
+	}
+	return int(d / time.Second), nil
+}
+
+// cooldownString shows a cooldown in seconds for !settings
+func cooldownString(seconds int) string {
+	if seconds == 0 {
+		return "off"
+	}
+	return (time.Duration(seconds) * time.Second).String()
+}
+
+// challengeLimit explains which of the guild's limits a new challenge at now would break, it's
+// empty when it's allowed
+func (settings GuildSettingsEntryStruct) challengeLimit(activity ChallengeActivity, defenderID string, now int64) string {
+	if settings.MaxOpenChallenges > 0 && activity.ChallengerOpen >= settings.MaxOpenChallenges {
+		return "Sorry, you're already in " + strconv.Itoa(activity.ChallengerOpen) + " challenges that are still open. Wait for one to close before starting another."
+	}
+	if settings.MaxOpenChallenges > 0 && activity.DefenderOpen >= settings.MaxOpenChallenges {
+		return "Sorry, <@" + defenderID + "> is already in " + strconv.Itoa(activity.DefenderOpen) + " challenges that are still open. Wait for one to close before challenging them."
+	}
+	if until := activity.ChallengerAt + int64(settings.ChallengerCooldown); settings.ChallengerCooldown > 0 && until > now {
+		return "Slow down! You can start another challenge <t:" + strconv.FormatInt(until, 10) + ":R>."
+	}
+	if until := activity.DefenderAt + int64(settings.DefenderCooldown); settings.DefenderCooldown > 0 && until > now {
+		return "<@" + defenderID + "> was challenged recently, give them a break. They can be challenged again <t:" + strconv.FormatInt(until, 10) + ":R>."
+	}
+	if until := activity.ChannelAt + int64(settings.ChannelCooldown); settings.ChannelCooldown > 0 && until > now {
+		return "There was a challenge in this channel recently, the next one can start <t:" + strconv.FormatInt(until, 10) + ":R>."
+	}
+	return ""
+}
+
+// hasChallengeLimits is false when all of the guild's challenge limits are off
+func (settings GuildSettingsEntryStruct) hasChallengeLimits() bool {
+	return settings.MaxOpenChallenges > 0 || settings.ChallengerCooldown > 0 || settings.DefenderCooldown > 0 || settings.ChannelCooldown > 0
+}
+
+// insertChallengeRowWithinLimits inserts a new challenge unless it breaks one of the guild's limits
+// at its CreatedAt, then it returns why and inserts nothing. The guild is locked from the check
+// until the insert commits, so challenges started together (or on other replicas) can't all get
+// past a limit
+func insertChallengeRowWithinLimits(db *sqlx.DB, row ChallengeTableEntryStruct, settings GuildSettingsEntryStruct) (string, error) {
+	if !settings.hasChallengeLimits() {
+		return "", insertChallengeRow(db, row)
+	}
+	tx, err := db.Beginx()
+	if err != nil {
+		oops(err, "Beginx")
+		return "", err
+	}
+	defer tx.Rollback()
+	//sqlite only has the one connection, Postgres holds the guild's lock until we commit
+	if tx.DriverName() == "postgres" {
+		_, err = tx.Exec("SELECT pg_advisory_xact_lock($1, hashtext($2))", challengeLimitLockID, row.GuildID)
+		if err != nil {
+			oops(err, "pg_advisory_xact_lock")
+			return "", err
+		}
+	}
+	activity, err := selectChallengeActivity(tx, row.GuildID, row.ChallengerID, row.DefenderID, row.ChannelID)
+	if err != nil {
+		return "", err
+	}
+	refusal := settings.challengeLimit(activity, row.DefenderID, row.CreatedAt)
+	if refusal != "" {
+		return refusal, nil
+	}
+	err = insertChallengeRow(tx, row)
+	if err != nil {
+		return "", err
+	}
+	return "", tx.Commit()
+}
+
+// limitRefusal is the error startChallenge gives for a challenge that broke one of the guild's
+// limits, it's the reply explaining which
+type limitRefusal string
+
+func (r limitRefusal) Error() string {
+	return string(r)
+}
+
+// checkChallengeLimits explains why challengerID can't challenge defenderID in the channel right
+// now, it's empty when they can. If the limits can't be checked the challenge is allowed here,
+// starting it checks them again in the same step as saving it
+func (b *Bot) checkChallengeLimits(guildID string, channelID string, challengerID string, defenderID string) string {
+	settings := b.guildSettings(guildID)
+	if !settings.hasChallengeLimits() {
+		return ""
+	}
+	activity, err := b.Store.SelectChallengeActivity(guildID, challengerID, defenderID, channelID)
+	if err != nil {
+		oops(err, "SelectChallengeActivity")
+		return ""
+	}
+	return settings.challengeLimit(activity, defenderID, time.Now().Unix())
+}
@@ -0,0 +1,184 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestStoreChallengeActivity(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store) {
+		rows := []ChallengeTableEntryStruct{
+			initChallengeTableEntry(testGuildID, testChannelID, "0", "1", "Gabe", "2", "Miia"),
+			initChallengeTableEntry(testGuildID, "9", "1", "1", "Gabe", "3", "Sam"),
+			initChallengeTableEntry(testGuildID, testChannelID, "2", "3", "Sam", "2", "Miia"),
+			initChallengeTableEntry("901", testChannelID, "3", "1", "Gabe", "2", "Miia"),
+		}
+		for i := range rows {
+			rows[i].CreatedAt = int64(100 * (i + 1))
+		}
+		rows[2].Status = ChallengeClosed
+		rows[3].CreatedAt = 1000
+		for _, row := range rows {
+			store.InsertChallengeRow(row)
+		}
+		activity, err := store.SelectChallengeActivity(testGuildID, "1", "2", testChannelID)
+		if err != nil {
+			t.Fatalf("got %s, wanted nil", err)
+		}
+		expected := ChallengeActivity{200, 300, 300, 2, 1}
+		if activity != expected {
+			t.Errorf("got %+v, wanted %+v", activity, expected)
+		}
+		activity, _ = store.SelectChallengeActivity(testGuildID, "4", "5", "6")
+		if activity != (ChallengeActivity{}) {
+			t.Errorf("got %+v, wanted nothing for users and channels without challenges", activity)
+		}
+	})
+}
+
+// TestStoreChallengeLimitsConcurrent starts challenges for the same challenger at once against a
+// cap of one open challenge, only one of them can get in
+func TestStoreChallengeLimitsConcurrent(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store) {
+		const challenges = 8
+		settings := GuildSettingsEntryStruct{testGuildID, CloseAfterStopVotes, 2, CountParticipantVotes, CloseByAnyone, "", 0, 0, 0, 1, AcceptOff, 0}
+		var wg sync.WaitGroup
+		refusals := make(chan string, challenges)
+		for i := 0; i < challenges; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				row := initChallengeTableEntry(testGuildID, testChannelID, strconv.Itoa(i), "1", "Gabe", fmt.Sprintf("d%d", i), "Miia")
+				row.CreatedAt = 1000
+				refusal, err := store.InsertChallengeRowWithinLimits(row, settings)
+				if err != nil {
+					t.Errorf("got %s, wanted nil", err)
+				}
+				refusals <- refusal
+			}(i)
+		}
+		wg.Wait()
+		close(refusals)
+		started := 0
+		for refusal := range refusals {
+			if refusal == "" {
+				started++
+			}
+		}
+		activity, _ := store.SelectChallengeActivity(testGuildID, "1", "d0", testChannelID)
+		if started != 1 || activity.ChallengerOpen != 1 {
+			t.Errorf("got %d started and %d open, wanted only one", started, activity.ChallengerOpen)
+		}
+	})
+}
+
+func TestChallengeLimit(t *testing.T) {
+	settings := GuildSettingsEntryStruct{testGuildID, CloseAfterStopVotes, 2, CountParticipantVotes, CloseByAnyone, "", 60, 600, 30, 2, AcceptOff, 0}
+	tests := []struct {
+		activity ChallengeActivity
+		expected string
+	}{
+		{ChallengeActivity{900, 0, 0, 0, 0}, ""},
+		{ChallengeActivity{950, 0, 0, 0, 0}, "Slow down! You can start another challenge <t:1010:R>."},
+		{ChallengeActivity{0, 500, 0, 0, 0}, "<@2> was challenged recently, give them a break. They can be challenged again <t:1100:R>."},
+		{ChallengeActivity{0, 0, 990, 0, 0}, "There was a challenge in this channel recently, the next one can start <t:1020:R>."},
+		{ChallengeActivity{0, 0, 0, 2, 0}, "Sorry, you're already in 2 challenges that are still open. Wait for one to close before starting another."},
+		{ChallengeActivity{0, 0, 0, 1, 2}, "Sorry, <@2> is already in 2 challenges that are still open. Wait for one to close before challenging them."},
+	}
+	for _, test := range tests {
+		actual := settings.challengeLimit(test.activity, "2", 1000)
+		if actual != test.expected {
+			t.Errorf("got %q for %+v, wanted %q", actual, test.activity, test.expected)
+		}
+	}
+	off := GuildSettingsEntryStruct{}
+	if actual := off.challengeLimit(ChallengeActivity{1000, 1000, 1000, 20, 20}, "2", 1000); actual != "" {
+		t.Errorf("got %q, wanted no limits", actual)
+	}
+}
+
+func TestParseCooldown(t *testing.T) {
+	tests := map[string]int{"off": 0, "0": 0, "10s": 0, "5m": 300, "1d": 86400}
+	for input, expected := range tests {
+		actual, err := parseCooldown(input)
+		if input == "10s" {
+			if err != errBadCooldown {
+				t.Errorf("got %v for %q, wanted %v", err, input, errBadCooldown)
+			}
+			continue
+		}
+		if err != nil || actual != expected {
+			t.Errorf("got %d and %v for %q, wanted %d", actual, err, input, expected)
+		}
+	}
+}
+
+func TestMessageCreateChallengeLimits(t *testing.T) {
+	b := newTestBot()
+	s := &fakeSession{}
+	gabe := &discordgo.User{ID: "1", Username: "Gabe"}
+	challenge := func(id string, channelID string, defenderID string) {
+		statement := &discordgo.Message{ID: "s" + id, GuildID: testGuildID, Content: "Pineapple belongs on pizza", Author: &discordgo.User{ID: defenderID, Username: "User " + defenderID}}
+		b.messageCreate(s, &discordgo.Message{ID: id, GuildID: testGuildID, ChannelID: channelID, Content: "!challenge", Type: discordgo.MessageTypeReply, Author: gabe, ReferencedMessage: statement})
+	}
+	//the limits are off until a manager turns them on
+	challenge("50", testChannelID, "2")
+	challenge("51", testChannelID, "3")
+	if len(s.complex) != 2 || len(s.sent) != 0 {
+		t.Errorf("got %q, wanted both challenges started", s.sent)
+	}
+
+	manager := &fakeSession{permissions: discordgo.PermissionManageServer}
+	settings := func(content string) {
+		b.messageCreate(manager, &discordgo.Message{GuildID: testGuildID, ChannelID: testChannelID, Content: content, Author: gabe})
+	}
+	settings("!settings cooldown challenger 5m")
+	settings("!settings maxopen 3")
+	settings("!settings cooldown everyone 5m")
+	settings("!settings")
+	expected := []string{
+		"The challenger cooldown is now 5m0s.",
+		"Users can now be in 3 open challenges at once.",
+		"Sorry, the cooldowns are challenger, defender and channel.",
+	}
+	for i := range expected {
+		if manager.sent[i] != expected[i] {
+			t.Errorf("got %q, wanted %q", manager.sent[i], expected[i])
+		}
+	}
+	if !strings.Contains(manager.sent[3], "Cooldowns: 5m0s per challenger, off per defender, off per channel. Users can be in 3 open challenges at once.") {
+		t.Errorf("got %q, wanted the limits shown", manager.sent[3])
+	}
+	challenge("52", "9", "4")
+	if len(s.complex) != 2 || len(s.sent) != 1 || !strings.HasPrefix(s.sent[0], "Slow down! You can start another challenge <t:") {
+		t.Errorf("got %q, wanted the challenge refused by the cooldown", s.sent)
+	}
+	settings("!settings cooldown challenger off")
+	expectedRefusal := "Sorry, you're already in 3 challenges that are still open. Wait for one to close before starting another."
+	challenge("53", "9", "4")
+	challenge("54", "9", "5")
+	if len(s.complex) != 3 || len(s.sent) != 2 || s.sent[1] != expectedRefusal {
+		t.Errorf("got %q, wanted the fourth open challenge refused", s.sent)
+	}
+
+	//a challenge that got past the first check while another one started is refused when it's
+	//saved, and its announcement says so
+	gabeChallenge := &discordgo.Message{ID: "s55", Content: "Pineapple belongs on pizza", Author: &discordgo.User{ID: "6", Username: "User 6"}}
+	err := b.openChallenge(s, testGuildID, "9", "55", gabe, gabeChallenge, 0, b.guildSettings(testGuildID))
+	if err != nil {
+		t.Fatalf("got %s, wanted nil", err)
+	}
+	if len(s.edits) != 1 || *s.edits[0].Content != expectedRefusal || len(s.edits[0].Components) != 0 {
+		t.Errorf("got %+v, wanted the announcement changed to the refusal", s.edits)
+	}
+	_, err = b.Store.SelectChallengeRow(testGuildID, "55")
+	if err != sql.ErrNoRows {
+		t.Errorf("got %v, wanted the refused challenge not saved", err)
+	}
+}
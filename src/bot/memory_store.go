@@ -0,0 +1,673 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+var errDuplicateChallenge = errors.New("challenge already exists")
+
+type challengeKey struct {
+	GuildID   string
+	MessageID string
+}
+
+type scoreboardKey struct {
+	GuildID string
+	UserID  string
+}
+
+type votingRecordKey struct {
+	GuildID   string
+	UserID    string
+	MessageID string
+}
+
+// MemoryStore is a Store that keeps everything in maps, it behaves like
+// SQLStore (including sql.ErrNoRows for missing rows) but is lost on exit
+type MemoryStore struct {
+	mu            sync.Mutex
+	challenges    map[challengeKey]ChallengeTableEntryStruct
+	scoreboard    map[scoreboardKey]ScoreboardTableEntryStruct
+	votingRecord  map[votingRecordKey]VotingRecordEntryStruct
+	guildSettings map[string]GuildSettingsEntryStruct
+	ratingHistory []RatingHistoryEntryStruct
+	seasons       map[string][]SeasonEntryStruct
+	standings     []SeasonStandingEntryStruct
+	achievements  []AchievementEntryStruct
+	//checked whenever a score is pushed, see SetAchievements
+	unlockable []Achievement
+}
+
+// NewMemoryStore creates an empty MemoryStore
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		challenges:    map[challengeKey]ChallengeTableEntryStruct{},
+		scoreboard:    map[scoreboardKey]ScoreboardTableEntryStruct{},
+		votingRecord:  map[votingRecordKey]VotingRecordEntryStruct{},
+		guildSettings: map[string]GuildSettingsEntryStruct{},
+		seasons:       map[string][]SeasonEntryStruct{},
+	}
+}
+
+func (s *MemoryStore) InsertChallengeRow(row ChallengeTableEntryStruct) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.insertChallengeRow(row)
+}
+
+func (s *MemoryStore) InsertChallengeRowWithinLimits(row ChallengeTableEntryStruct, settings GuildSettingsEntryStruct) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	activity := s.challengeActivity(row.GuildID, row.ChallengerID, row.DefenderID, row.ChannelID)
+	refusal := settings.challengeLimit(activity, row.DefenderID, row.CreatedAt)
+	if refusal != "" {
+		return refusal, nil
+	}
+	return "", s.insertChallengeRow(row)
+}
+
+// insertChallengeRow is InsertChallengeRow for callers already holding s.mu
+func (s *MemoryStore) insertChallengeRow(row ChallengeTableEntryStruct) error {
+	key := challengeKey{row.GuildID, row.MessageID}
+	if _, ok := s.challenges[key]; ok {
+		return errDuplicateChallenge
+	}
+	s.challenges[key] = row
+	return nil
+}
+
+func (s *MemoryStore) SelectChallengeRow(GuildID string, MessageID string) (ChallengeTableEntryStruct, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	row, ok := s.challenges[challengeKey{GuildID, MessageID}]
+	if !ok {
+		return ChallengeTableEntryStruct{}, sql.ErrNoRows
+	}
+	return row, nil
+}
+
+func (s *MemoryStore) SelectVotes(GuildID string, MessageID string) (VotesStruct, error) {
+	row, err := s.SelectChallengeRow(GuildID, MessageID)
+	if err != nil {
+		return VotesStruct{}, err
+	}
+	return VotesStruct{row.ChallengerVotes, row.DefenderVotes, row.AbstainVotes, row.StopVotes}, nil
+}
+
+func (s *MemoryStore) InsertScoreboardRow(row ScoreboardTableEntryStruct) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := scoreboardKey{row.GuildID, row.UserID}
+	if _, ok := s.scoreboard[key]; !ok {
+		s.scoreboard[key] = row
+	}
+	return nil
+}
+
+func (s *MemoryStore) SelectScoreboardRow(GuildID string, UserID string) (ScoreboardTableEntryStruct, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	row, ok := s.scoreboard[scoreboardKey{GuildID, UserID}]
+	if !ok {
+		return ScoreboardTableEntryStruct{}, sql.ErrNoRows
+	}
+	return row, nil
+}
+
+func (s *MemoryStore) UpdateScoreboard(row ScoreboardTableEntryStruct) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := scoreboardKey{row.GuildID, row.UserID}
+	if _, ok := s.scoreboard[key]; ok {
+		s.scoreboard[key] = row
+	}
+	return nil
+}
+
+func (s *MemoryStore) UserInScoreboard(GuildID string, UserID string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.scoreboard[scoreboardKey{GuildID, UserID}]
+	return ok
+}
+
+func (s *MemoryStore) PushScore(challengeEntry ChallengeTableEntryStruct) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.pushScore(challengeEntry)
+}
+
+// pushScore is PushScore for callers already holding s.mu, it changes nothing if it fails
+func (s *MemoryStore) pushScore(challengeEntry ChallengeTableEntryStruct) error {
+	challengerKey := scoreboardKey{challengeEntry.GuildID, challengeEntry.ChallengerID}
+	defenderKey := scoreboardKey{challengeEntry.GuildID, challengeEntry.DefenderID}
+	challenger, ok := s.scoreboard[challengerKey]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	defender, ok := s.scoreboard[defenderKey]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	challengerBefore, defenderBefore := challenger.Rating, defender.Rating
+	applyOutcome(&challenger, &defender, challengeEntry.Outcome)
+	s.scoreboard[challengerKey] = challenger
+	s.scoreboard[defenderKey] = defender
+	history := []RatingHistoryEntryStruct{
+		{challengeEntry.GuildID, challengeEntry.MessageID, challenger.UserID, challengerBefore, challenger.Rating},
+		{challengeEntry.GuildID, challengeEntry.MessageID, defender.UserID, defenderBefore, defender.Rating},
+	}
+	s.ratingHistory = append(s.ratingHistory, history...)
+	rows := []ScoreboardTableEntryStruct{challenger, defender}
+	for _, row := range reachedAchievements(s.unlockable, challengeEntry, rows, history, time.Now().Unix()) {
+		s.unlockAchievement(row)
+	}
+	return nil
+}
+
+func (s *MemoryStore) SelectRatingHistory(GuildID string, MessageID string) ([]RatingHistoryEntryStruct, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	history := []RatingHistoryEntryStruct{}
+	for _, row := range s.ratingHistory {
+		if row.GuildID == GuildID && row.MessageID == MessageID {
+			history = append(history, row)
+		}
+	}
+	return history, nil
+}
+
+func (s *MemoryStore) SelectLeaderboard(GuildID string, sortBy LeaderboardSort, limit int, offset int) ([]ScoreboardTableEntryStruct, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rows := s.leaderboard(GuildID, sortBy)
+	if offset >= len(rows) {
+		return []ScoreboardTableEntryStruct{}, nil
+	}
+	rows = rows[offset:]
+	if len(rows) > limit {
+		rows = rows[:limit]
+	}
+	return rows, nil
+}
+
+// leaderboard is the whole of a guild's leaderboard, the caller holds s.mu
+func (s *MemoryStore) leaderboard(GuildID string, sortBy LeaderboardSort) []ScoreboardTableEntryStruct {
+	rows := []ScoreboardTableEntryStruct{}
+	for key, row := range s.scoreboard {
+		if key.GuildID == GuildID && row.TotalChallenges > 0 {
+			rows = append(rows, row)
+		}
+	}
+	sort.Slice(rows, func(i, j int) bool { return sortBy.less(rows[i], rows[j]) })
+	return rows
+}
+
+func (s *MemoryStore) CountLeaderboard(GuildID string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	count := 0
+	for key, row := range s.scoreboard {
+		if key.GuildID == GuildID && row.TotalChallenges > 0 {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (s *MemoryStore) SelectChallengeHistory(GuildID string, UserID string, limit int, offset int) ([]ChallengeTableEntryStruct, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rows := []ChallengeTableEntryStruct{}
+	for key, row := range s.challenges {
+		if key.GuildID == GuildID && (row.ChallengerID == UserID || row.DefenderID == UserID) {
+			rows = append(rows, row)
+		}
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		if rows[i].CreatedAt != rows[j].CreatedAt {
+			return rows[i].CreatedAt > rows[j].CreatedAt
+		}
+		return rows[i].MessageID > rows[j].MessageID
+	})
+	if offset >= len(rows) {
+		return []ChallengeTableEntryStruct{}, nil
+	}
+	rows = rows[offset:]
+	if len(rows) > limit {
+		rows = rows[:limit]
+	}
+	return rows, nil
+}
+
+func (s *MemoryStore) CountChallengeHistory(GuildID string, UserID string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	count := 0
+	for key, row := range s.challenges {
+		if key.GuildID == GuildID && (row.ChallengerID == UserID || row.DefenderID == UserID) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (s *MemoryStore) SelectChallengeActivity(GuildID string, ChallengerID string, DefenderID string, ChannelID string) (ChallengeActivity, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.challengeActivity(GuildID, ChallengerID, DefenderID, ChannelID), nil
+}
+
+// challengeActivity is SelectChallengeActivity for callers already holding s.mu
+func (s *MemoryStore) challengeActivity(GuildID string, ChallengerID string, DefenderID string, ChannelID string) ChallengeActivity {
+	activity := ChallengeActivity{}
+	latest := func(at *int64, row ChallengeTableEntryStruct) {
+		if row.CreatedAt > *at {
+			*at = row.CreatedAt
+		}
+	}
+	for key, row := range s.challenges {
+		if key.GuildID != GuildID {
+			continue
+		}
+		if row.ChallengerID == ChallengerID {
+			latest(&activity.ChallengerAt, row)
+		}
+		if row.DefenderID == DefenderID {
+			latest(&activity.DefenderAt, row)
+		}
+		if row.ChannelID == ChannelID {
+			latest(&activity.ChannelAt, row)
+		}
+		if row.Status == ChallengeClosed {
+			continue
+		}
+		if row.ChallengerID == ChallengerID || row.DefenderID == ChallengerID {
+			activity.ChallengerOpen++
+		}
+		if row.ChallengerID == DefenderID || row.DefenderID == DefenderID {
+			activity.DefenderOpen++
+		}
+	}
+	return activity
+}
+
+func (s *MemoryStore) SelectHeadToHead(GuildID string, UserA string, UserB string) ([]ChallengeTableEntryStruct, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rows := []ChallengeTableEntryStruct{}
+	for key, row := range s.challenges {
+		if key.GuildID != GuildID || row.Status != ChallengeClosed || row.Outcome == OutcomeCancelled {
+			continue
+		}
+		if (row.ChallengerID == UserA && row.DefenderID == UserB) || (row.ChallengerID == UserB && row.DefenderID == UserA) {
+			rows = append(rows, row)
+		}
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		if rows[i].CreatedAt != rows[j].CreatedAt {
+			return rows[i].CreatedAt < rows[j].CreatedAt
+		}
+		return rows[i].MessageID < rows[j].MessageID
+	})
+	return rows, nil
+}
+
+func (s *MemoryStore) SelectVotingRecords(GuildID string, MessageID string) ([]VotingRecordEntryStruct, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rows := []VotingRecordEntryStruct{}
+	for key, row := range s.votingRecord {
+		if key.GuildID == GuildID && key.MessageID == MessageID {
+			rows = append(rows, row)
+		}
+	}
+	sort.Slice(rows, func(i, j int) bool { return rows[i].UserID < rows[j].UserID })
+	return rows, nil
+}
+
+func (s *MemoryStore) SelectSeasons(GuildID string) ([]SeasonEntryStruct, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]SeasonEntryStruct{}, s.seasons[GuildID]...), nil
+}
+
+func (s *MemoryStore) StartSeason(GuildID string, now int64) (SeasonEntryStruct, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	next, err := nextSeason(s.seasons[GuildID])
+	if err != nil {
+		return SeasonEntryStruct{}, err
+	}
+	if len(s.seasons[GuildID]) == 0 && len(s.leaderboard(GuildID, SortWins)) > 0 {
+		s.seasons[GuildID] = append(s.seasons[GuildID], SeasonEntryStruct{GuildID, 0, 0, now})
+		s.archiveStandings(GuildID, 0)
+	}
+	s.resetScoreboard(GuildID)
+	season := SeasonEntryStruct{GuildID, next, now, 0}
+	s.seasons[GuildID] = append(s.seasons[GuildID], season)
+	return season, nil
+}
+
+func (s *MemoryStore) EndSeason(GuildID string, now int64) (SeasonEntryStruct, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	season, ok := activeSeason(s.seasons[GuildID])
+	if !ok {
+		return SeasonEntryStruct{}, ErrNoSeason
+	}
+	s.archiveStandings(GuildID, season.Season)
+	s.resetScoreboard(GuildID)
+	season.EndedAt = now
+	for i, row := range s.seasons[GuildID] {
+		if row.Season == season.Season {
+			s.seasons[GuildID][i] = season
+		}
+	}
+	return season, nil
+}
+
+// archiveStandings copies the leaderboard into the season's standings, the caller holds s.mu
+func (s *MemoryStore) archiveStandings(GuildID string, Season int) {
+	for i, row := range s.leaderboard(GuildID, SortWins) {
+		s.standings = append(s.standings, SeasonStandingEntryStruct{Season, i + 1, row})
+	}
+}
+
+// resetScoreboard puts everyone in the guild back to the starting row, the caller holds s.mu
+func (s *MemoryStore) resetScoreboard(GuildID string) {
+	for key, row := range s.scoreboard {
+		if key.GuildID == GuildID {
+			s.scoreboard[key] = initScoreBoardRow(row.GuildID, row.UserID, row.Username)
+		}
+	}
+}
+
+func (s *MemoryStore) SelectSeasonStandings(GuildID string, Season int, sortBy LeaderboardSort, limit int, offset int) ([]SeasonStandingEntryStruct, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rows := []SeasonStandingEntryStruct{}
+	for _, row := range s.standings {
+		if row.GuildID == GuildID && row.Season == Season {
+			rows = append(rows, row)
+		}
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		return sortBy.less(rows[i].ScoreboardTableEntryStruct, rows[j].ScoreboardTableEntryStruct)
+	})
+	if offset >= len(rows) {
+		return []SeasonStandingEntryStruct{}, nil
+	}
+	rows = rows[offset:]
+	if len(rows) > limit {
+		rows = rows[:limit]
+	}
+	return rows, nil
+}
+
+func (s *MemoryStore) CountSeasonStandings(GuildID string, Season int) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	count := 0
+	for _, row := range s.standings {
+		if row.GuildID == GuildID && row.Season == Season {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (s *MemoryStore) UnlockAchievement(row AchievementEntryStruct) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.unlockAchievement(row), nil
+}
+
+// unlockAchievement is UnlockAchievement for callers already holding s.mu
+func (s *MemoryStore) unlockAchievement(row AchievementEntryStruct) bool {
+	for _, unlocked := range s.achievements {
+		if unlocked.GuildID == row.GuildID && unlocked.UserID == row.UserID && unlocked.Achievement == row.Achievement {
+			return false
+		}
+	}
+	s.achievements = append(s.achievements, row)
+	return true
+}
+
+func (s *MemoryStore) SetAchievements(achievements []Achievement) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.unlockable = achievements
+}
+
+func (s *MemoryStore) SelectChallengeAchievements(GuildID string, MessageID string) ([]AchievementEntryStruct, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rows := []AchievementEntryStruct{}
+	for _, row := range s.achievements {
+		if row.GuildID == GuildID && row.MessageID == MessageID {
+			rows = append(rows, row)
+		}
+	}
+	return rows, nil
+}
+
+func (s *MemoryStore) SelectAchievements(GuildID string, UserID string) ([]AchievementEntryStruct, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rows := []AchievementEntryStruct{}
+	for _, row := range s.achievements {
+		if row.GuildID == GuildID && row.UserID == UserID {
+			rows = append(rows, row)
+		}
+	}
+	sort.SliceStable(rows, func(i, j int) bool {
+		if rows[i].UnlockedAt != rows[j].UnlockedAt {
+			return rows[i].UnlockedAt < rows[j].UnlockedAt
+		}
+		return rows[i].Achievement < rows[j].Achievement
+	})
+	return rows, nil
+}
+
+func (s *MemoryStore) SelectVotingRecordRow(GuildID string, UserID string, MessageID string) (VotingRecordEntryStruct, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	row, ok := s.votingRecord[votingRecordKey{GuildID, UserID, MessageID}]
+	if !ok {
+		return VotingRecordEntryStruct{}, sql.ErrNoRows
+	}
+	return row, nil
+}
+
+func (s *MemoryStore) RecordVote(GuildID string, MessageID string, UserID string, vote Vote, rule CloseRule) (ChallengeTableEntryStruct, Vote, error) {
+	return s.castVote(GuildID, MessageID, UserID, vote, true, rule)
+}
+
+func (s *MemoryStore) RemoveVote(GuildID string, MessageID string, UserID string, vote Vote, rule CloseRule) (ChallengeTableEntryStruct, error) {
+	row, _, err := s.castVote(GuildID, MessageID, UserID, vote, false, rule)
+	return row, err
+}
+
+func (s *MemoryStore) castVote(GuildID string, MessageID string, UserID string, vote Vote, add bool, rule CloseRule) (ChallengeTableEntryStruct, Vote, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	row, ok := s.challenges[challengeKey{GuildID, MessageID}]
+	if !ok {
+		return row, NoVote, sql.ErrNoRows
+	}
+	if row.Status != ChallengeOpen {
+		return row, NoVote, ErrVotingClosed
+	}
+	key := votingRecordKey{GuildID, UserID, MessageID}
+	votingRecordEntry, hadRecord := s.votingRecord[key]
+	oldRecord := votingRecordEntry
+	votingRecordEntry.GuildID = GuildID
+	votingRecordEntry.UserID = UserID
+	votingRecordEntry.MessageID = MessageID
+	replaced, err := applyVote(&votingRecordEntry, vote, add)
+	if err != nil {
+		return row, NoVote, err
+	}
+	if votingRecordEmpty(votingRecordEntry) {
+		delete(s.votingRecord, key)
+	} else {
+		s.votingRecord[key] = votingRecordEntry
+	}
+	votes := VotesStruct{}
+	tally := stopTally{}
+	for _, v := range s.votingRecord {
+		if v.GuildID == GuildID && v.MessageID == MessageID {
+			votes.ChallengerVotes += v.ChallengerVotes
+			votes.DefenderVotes += v.DefenderVotes
+			votes.AbstainVotes += v.AbstainVotes
+			votes.StopVotes += v.StopVotes
+			if hasVoted(v) {
+				tally.Voters++
+			}
+			if v.StopVotes > 0 && v.UserID == row.ChallengerID {
+				tally.ChallengerStopped = true
+			}
+			if v.StopVotes > 0 && v.UserID == row.DefenderID {
+				tally.DefenderStopped = true
+			}
+		}
+	}
+	tally.StopVotes = votes.StopVotes
+	row.ChallengerVotes = votes.ChallengerVotes
+	row.DefenderVotes = votes.DefenderVotes
+	row.AbstainVotes = votes.AbstainVotes
+	row.StopVotes = votes.StopVotes
+	row.Outcome = outcomeOf(votes)
+	if rule.closes(tally) {
+		row.Status = ChallengeClosed
+		row.ClosedAt = time.Now().Unix()
+		//score it in the same step, if that fails the vote isn't counted either, like SQLStore's rollback
+		err = s.pushScore(row)
+		if err != nil {
+			if hadRecord {
+				s.votingRecord[key] = oldRecord
+			} else {
+				delete(s.votingRecord, key)
+			}
+			return s.challenges[challengeKey{GuildID, MessageID}], NoVote, err
+		}
+	}
+	s.challenges[challengeKey{GuildID, MessageID}] = row
+	return row, replaced, nil
+}
+
+func (s *MemoryStore) CloseChallenge(GuildID string, MessageID string) (ChallengeTableEntryStruct, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := challengeKey{GuildID, MessageID}
+	row, ok := s.challenges[key]
+	if !ok {
+		return row, sql.ErrNoRows
+	}
+	if row.Status != ChallengeOpen {
+		return row, ErrVotingClosed
+	}
+	row.Status = ChallengeClosed
+	row.ClosedAt = time.Now().Unix()
+	err := s.pushScore(row)
+	if err != nil {
+		return s.challenges[key], err
+	}
+	s.challenges[key] = row
+	return row, nil
+}
+
+func (s *MemoryStore) AnswerChallenge(GuildID string, MessageID string, acceptance int, forfeit bool, now int64) (ChallengeTableEntryStruct, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := challengeKey{GuildID, MessageID}
+	row, ok := s.challenges[key]
+	if !ok {
+		return row, sql.ErrNoRows
+	}
+	if row.Status != ChallengePending {
+		return row, ErrAnswered
+	}
+	row = answered(row, acceptance, forfeit, now)
+	if forfeited(row) {
+		err := s.pushScore(row)
+		if err != nil {
+			return s.challenges[key], err
+		}
+	}
+	s.challenges[key] = row
+	return row, nil
+}
+
+func (s *MemoryStore) SelectUnansweredChallenges(now int64) ([]ChallengeTableEntryStruct, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rows := []ChallengeTableEntryStruct{}
+	for _, row := range s.challenges {
+		if row.Status == ChallengePending && row.AcceptBy <= now {
+			rows = append(rows, row)
+		}
+	}
+	sort.Slice(rows, func(i, j int) bool { return rows[i].AcceptBy < rows[j].AcceptBy })
+	return rows, nil
+}
+
+func (s *MemoryStore) CancelChallenge(GuildID string, MessageID string, evenWithVotes bool) (ChallengeTableEntryStruct, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := challengeKey{GuildID, MessageID}
+	row, ok := s.challenges[key]
+	if !ok {
+		return row, sql.ErrNoRows
+	}
+	if row.Status == ChallengeClosed {
+		return row, ErrVotingClosed
+	}
+	if !evenWithVotes && row.ChallengerVotes+row.DefenderVotes+row.AbstainVotes+row.StopVotes > 0 {
+		return row, ErrHasVotes
+	}
+	row.Status = ChallengeClosed
+	row.Outcome = OutcomeCancelled
+	row.ClosedAt = time.Now().Unix()
+	s.challenges[key] = row
+	return row, nil
+}
+
+func (s *MemoryStore) SelectExpiredChallenges(now int64) ([]ChallengeTableEntryStruct, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rows := []ChallengeTableEntryStruct{}
+	for _, row := range s.challenges {
+		if row.Status == ChallengeOpen && row.Deadline > 0 && row.Deadline <= now {
+			rows = append(rows, row)
+		}
+	}
+	sort.Slice(rows, func(i, j int) bool { return rows[i].Deadline < rows[j].Deadline })
+	return rows, nil
+}
+
+func (s *MemoryStore) SelectGuildSettings(GuildID string) (GuildSettingsEntryStruct, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	row, ok := s.guildSettings[GuildID]
+	if !ok {
+		return GuildSettingsEntryStruct{}, sql.ErrNoRows
+	}
+	return row, nil
+}
+
+func (s *MemoryStore) UpsertGuildSettings(row GuildSettingsEntryStruct) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.guildSettings[row.GuildID] = row
+	return nil
+}
+
+func (s *MemoryStore) Close() error {
+	return nil
+}
@@ -0,0 +1,272 @@
+package db
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"io/fs"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// migrationFiles holds the schema, one NNNN_name.up.sql and NNNN_name.down.sql pair per version
+//
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// Migration is one numbered schema change
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// MigrationStatusEntry says whether a migration has been applied to a database, and when
+type MigrationStatusEntry struct {
+	Version   int    `db:"Version"`
+	Name      string `db:"Name"`
+	Applied   bool
+	AppliedAt int64 `db:"AppliedAt"`
+}
+
+// loadMigrations reads the embedded migrations in version order
+func loadMigrations() ([]Migration, error) {
+	files, err := fs.Glob(migrationFiles, "migrations/*.sql")
+	if err != nil {
+		return nil, err
+	}
+	byVersion := map[int]*Migration{}
+	for _, file := range files {
+		base := strings.TrimPrefix(file, "migrations/")
+		parts := strings.SplitN(base, "_", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("bad migration file name %s", base)
+		}
+		version, err := strconv.Atoi(parts[0])
+		if err != nil {
+			return nil, fmt.Errorf("bad migration file name %s", base)
+		}
+		contents, err := migrationFiles.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version}
+			byVersion[version] = m
+		}
+		if strings.HasSuffix(parts[1], ".up.sql") {
+			m.Name = strings.TrimSuffix(parts[1], ".up.sql")
+			m.Up = string(contents)
+		} else if strings.HasSuffix(parts[1], ".down.sql") {
+			m.Down = string(contents)
+		} else {
+			return nil, fmt.Errorf("bad migration file name %s", base)
+		}
+	}
+	migrations := []Migration{}
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("migration %d needs both an up and a down file", m.Version)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+func createSchemaVersion(db *sqlx.DB) error {
+	_, err := db.Exec("CREATE TABLE IF NOT EXISTS schema_version(Version int primary key, Name text, AppliedAt bigint)")
+	if err != nil {
+		oops(err, "createSchemaVersion")
+	}
+	return err
+}
+
+// SchemaVersion is the newest migration applied to db, 0 for an empty database
+func SchemaVersion(db *sqlx.DB) (int, error) {
+	err := createSchemaVersion(db)
+	if err != nil {
+		return 0, err
+	}
+	version := 0
+	err = db.Get(&version, "SELECT COALESCE(MAX(Version), 0) FROM schema_version")
+	return version, err
+}
+
+// defaultGuildPlaceholder is replaced in up migrations by the guild that rows from
+// before per-guild scoreboards are given to
+const defaultGuildPlaceholder = "{{DefaultGuildID}}"
+
+// Migrate brings db up to the newest schema, it is run every time the bot starts.
+// defaultGuildID is the guild that existing rows are assigned to when the tables become per-guild
+func Migrate(db *sqlx.DB, defaultGuildID string) error {
+	return MigrateUp(db, 0, defaultGuildID)
+}
+
+// lockMigrations stops other copies of the bot sharing a Postgres database from migrating it at
+// the same time, until unlock is called. It waits for whoever holds the lock, so the schema
+// version is only checked once they're done. A sqlite file has no other bots to wait for
+func lockMigrations(db *sqlx.DB) (unlock func(), err error) {
+	if db.DriverName() != "postgres" {
+		return func() {}, nil
+	}
+	ctx := context.Background()
+	//advisory locks belong to a session, so take and release it on the same connection
+	conn, err := db.Connx(ctx)
+	if err != nil {
+		oops(err, "Connx")
+		return nil, err
+	}
+	_, err = conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", migrationLockID)
+	if err != nil {
+		oops(err, "pg_advisory_lock")
+		conn.Close()
+		return nil, err
+	}
+	return func() {
+		_, err := conn.ExecContext(ctx, "SELECT pg_advisory_unlock($1)", migrationLockID)
+		if err != nil {
+			oops(err, "pg_advisory_unlock")
+		}
+		conn.Close()
+	}, nil
+}
+
+// MigrateUp applies up to steps pending migrations, or all of them if steps is 0. Replicas
+// starting together take turns, so each migration is only applied once
+func MigrateUp(db *sqlx.DB, steps int, defaultGuildID string) error {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return err
+	}
+	unlock, err := lockMigrations(db)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	current, err := SchemaVersion(db)
+	if err != nil {
+		return err
+	}
+	applied := 0
+	for _, m := range migrations {
+		if m.Version <= current {
+			continue
+		}
+		if steps > 0 && applied == steps {
+			break
+		}
+		if strings.Contains(m.Up, defaultGuildPlaceholder) && defaultGuildID == "" {
+			log.Printf("No default guild set, rows already in the database won't belong to any guild after %04d_%s", m.Version, m.Name)
+		}
+		up := strings.ReplaceAll(m.Up, defaultGuildPlaceholder, quoteLiteral(defaultGuildID))
+		err = runMigration(db, m.Version, m.Name, up, true)
+		if err != nil {
+			return err
+		}
+		applied++
+	}
+	return nil
+}
+
+// MigrateDown rolls back the newest steps migrations
+func MigrateDown(db *sqlx.DB, steps int) error {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return err
+	}
+	unlock, err := lockMigrations(db)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	current, err := SchemaVersion(db)
+	if err != nil {
+		return err
+	}
+	for i := len(migrations) - 1; i >= 0 && steps > 0; i-- {
+		m := migrations[i]
+		if m.Version > current {
+			continue
+		}
+		err = runMigration(db, m.Version, m.Name, m.Down, false)
+		if err != nil {
+			return err
+		}
+		steps--
+	}
+	return nil
+}
+
+// MigrationStatus lists every migration the bot knows about and whether db has it
+func MigrationStatus(db *sqlx.DB) ([]MigrationStatusEntry, error) {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return nil, err
+	}
+	err = createSchemaVersion(db)
+	if err != nil {
+		return nil, err
+	}
+	applied := []MigrationStatusEntry{}
+	err = db.Select(&applied, "SELECT Version, Name, AppliedAt FROM schema_version")
+	if err != nil {
+		return nil, err
+	}
+	appliedAt := map[int]int64{}
+	for _, a := range applied {
+		appliedAt[a.Version] = a.AppliedAt
+	}
+	status := []MigrationStatusEntry{}
+	for _, m := range migrations {
+		at, ok := appliedAt[m.Version]
+		status = append(status, MigrationStatusEntry{m.Version, m.Name, ok, at})
+	}
+	return status, nil
+}
+
+// quoteLiteral makes s safe to paste into a migration as an SQL string
+func quoteLiteral(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+// runMigration runs one migration and records it in schema_version, both or neither
+func runMigration(db *sqlx.DB, version int, name string, query string, up bool) error {
+	direction := "down"
+	if up {
+		direction = "up"
+	}
+	tx, err := db.Beginx()
+	if err != nil {
+		oops(err, "Beginx")
+		return err
+	}
+	defer tx.Rollback()
+	_, err = tx.Exec(query)
+	if err != nil {
+		oops(err, fmt.Sprintf("migration %04d_%s %s", version, name, direction))
+		return err
+	}
+	if up {
+		_, err = tx.Exec(tx.Rebind("INSERT INTO schema_version (Version, Name, AppliedAt) VALUES (?, ?, ?)"), version, name, time.Now().Unix())
+	} else {
+		_, err = tx.Exec(tx.Rebind("DELETE FROM schema_version WHERE Version = ?"), version)
+	}
+	if err != nil {
+		oops(err, "schema_version")
+		return err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+	log.Printf("Migrated %s: %04d_%s", direction, version, name)
+	return nil
+}
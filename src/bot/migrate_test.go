@@ -0,0 +1,205 @@
+package db
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+)
+
+func TestLoadMigrations(t *testing.T) {
+	migrations, err := loadMigrations()
+	if err != nil {
+		t.Fatalf("got %s, wanted nil", err)
+	}
+	if len(migrations) == 0 || migrations[0].Version != 1 || migrations[0].Name != "initial" {
+		t.Fatalf("got %+v, wanted 0001_initial first", migrations)
+	}
+	for i, m := range migrations {
+		if m.Version != i+1 {
+			t.Errorf("got version %d at position %d, versions should count up from 1", m.Version, i)
+		}
+	}
+}
+
+func TestMigrateUpAndDown(t *testing.T) {
+	forEachDB(t, func(t *testing.T, db *sqlx.DB) {
+		migrations, _ := loadMigrations()
+		latest := migrations[len(migrations)-1].Version
+		err := Migrate(db, "")
+		if err != nil {
+			t.Fatalf("got %s, wanted nil", err)
+		}
+		version, _ := SchemaVersion(db)
+		if version != latest {
+			t.Errorf("got %d, wanted %d", version, latest)
+		}
+		//running it again on every startup shouldn't change anything
+		err = Migrate(db, "")
+		if err != nil {
+			t.Fatalf("got %s, wanted nil", err)
+		}
+		status, err := MigrationStatus(db)
+		if err != nil {
+			t.Fatalf("got %s, wanted nil", err)
+		}
+		for _, m := range status {
+			if !m.Applied || m.AppliedAt == 0 {
+				t.Errorf("got %+v, wanted it applied", m)
+			}
+		}
+
+		err = MigrateDown(db, len(migrations))
+		if err != nil {
+			t.Fatalf("got %s, wanted nil", err)
+		}
+		version, _ = SchemaVersion(db)
+		if version != 0 {
+			t.Errorf("got %d, wanted %d", version, 0)
+		}
+		_, err = db.Exec("SELECT * FROM challengeTable")
+		if err == nil {
+			t.Errorf("challengeTable should be dropped by the last down migration")
+		}
+
+		err = MigrateUp(db, 1, "")
+		if err != nil {
+			t.Fatalf("got %s, wanted nil", err)
+		}
+		version, _ = SchemaVersion(db)
+		if version != 1 {
+			t.Errorf("got %d, wanted %d", version, 1)
+		}
+		status, _ = MigrationStatus(db)
+		if !status[0].Applied {
+			t.Errorf("got %+v, wanted it applied", status[0])
+		}
+		for _, m := range status[1:] {
+			if m.Applied {
+				t.Errorf("got %+v, wanted it pending", m)
+			}
+		}
+	})
+}
+
+// TestMigrateExistingDatabase starts from the tables the bot created before migrations existed,
+// its rows should end up in the default guild
+func TestMigrateExistingDatabase(t *testing.T) {
+	forEachDB(t, func(t *testing.T, db *sqlx.DB) {
+		_, err := db.Exec("CREATE TABLE challengeTable(MessageID text primary key, ChallengerID text, ChallengerName text, DefenderID text, DefenderName text, ChallengerVotes int, DefenderVotes int, AbstainVotes int, StopVotes int, Outcome int)")
+		if err != nil {
+			t.Fatalf("got %s, wanted nil", err)
+		}
+		_, err = db.Exec("CREATE TABLE scoreboardTable(UserID text primary key, Username text, TotalChallengeWins int, TotalChallengeLosses int, TotalChallengeTies int, TotalChallenges int, SuccessfulChallenges int, FailedChallenges int, SuccessfulDefenses int, FailedDefenses int)")
+		if err != nil {
+			t.Fatalf("got %s, wanted nil", err)
+		}
+		db.Exec("INSERT INTO challengeTable VALUES ('0', '1', 'Gabe', '2', 'Miia', 0, 1, 0, 2, 2)")
+		db.Exec("INSERT INTO scoreboardTable VALUES ('1', 'Gabe', 0, 1, 0, 1, 0, 1, 0, 0)")
+		err = Migrate(db, "42")
+		if err != nil {
+			t.Fatalf("got %s, wanted nil", err)
+		}
+		store := NewSQLStore(db)
+		challengeRow, err := store.SelectChallengeRow("42", "0")
+		if err != nil || challengeRow.ChallengerName != "Gabe" {
+			t.Errorf("got %+v and %v, wanted the old challenge in guild 42", challengeRow, err)
+		}
+		scoreboardRow, err := store.SelectScoreboardRow("42", "1")
+		if err != nil || scoreboardRow.TotalChallengeLosses != 1 {
+			t.Errorf("got %+v and %v, wanted the old score in guild 42", scoreboardRow, err)
+		}
+		if challengeRow.Status != ChallengeClosed || challengeRow.Deadline != 0 {
+			t.Errorf("got %+v, wanted the old challenge closed since it had two stop votes", challengeRow)
+		}
+		if scoreboardRow.Rating != initialRating {
+			t.Errorf("got %d, wanted old scores to start at %d", scoreboardRow.Rating, initialRating)
+		}
+		if store.UserInScoreboard(testGuildID, "1") {
+			t.Errorf("old scores should only be in the default guild")
+		}
+		//the same user can now have a record in another guild
+		err = store.InsertScoreboardRow(initScoreBoardRow(testGuildID, "1", "Gabe"))
+		if err != nil || !store.UserInScoreboard(testGuildID, "1") {
+			t.Errorf("got %v, wanted a second scoreboard row for user 1", err)
+		}
+	})
+}
+
+// TestMigrateLimitsOff checks guilds that saved settings before challenge limits existed don't
+// get any until their managers turn them on
+func TestMigrateLimitsOff(t *testing.T) {
+	forEachDB(t, func(t *testing.T, db *sqlx.DB) {
+		err := MigrateUp(db, 11, "")
+		if err != nil {
+			t.Fatalf("got %s, wanted nil", err)
+		}
+		_, err = db.Exec("INSERT INTO guildSettings (GuildID, CloseRule, CloseValue) VALUES ('" + testGuildID + "', 0, 3)")
+		if err != nil {
+			t.Fatalf("got %s, wanted nil", err)
+		}
+		err = Migrate(db, "")
+		if err != nil {
+			t.Fatalf("got %s, wanted nil", err)
+		}
+		settings, err := NewSQLStore(db).SelectGuildSettings(testGuildID)
+		if err != nil || settings.CloseValue != 3 {
+			t.Fatalf("got %+v and %v, wanted the guild's settings kept", settings, err)
+		}
+		if settings.ChallengerCooldown != 0 || settings.DefenderCooldown != 0 || settings.ChannelCooldown != 0 || settings.MaxOpenChallenges != 0 {
+			t.Errorf("got %+v, wanted every limit off", settings)
+		}
+	})
+}
+
+// TestConcurrentMigrations starts several replicas on one empty Postgres database at once, each
+// migration should be applied by exactly one of them and none should fail
+func TestConcurrentMigrations(t *testing.T) {
+	if postgresTestDSN == "" {
+		if requirePostgres {
+			t.Fatalf("REQUIRE_POSTGRES_TESTS is set but POSTGRES_TEST_DSN isn't")
+		}
+		t.Skip("POSTGRES_TEST_DSN isn't set")
+	}
+	dsn := newTestPostgresSchema(t)
+	replicas := 5
+	errs := make([]error, replicas)
+	var wg sync.WaitGroup
+	for i := 0; i < replicas; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			db, err := OpenDB(dsn)
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			defer db.Close()
+			errs[i] = Migrate(db, "")
+		}(i)
+	}
+	wg.Wait()
+	for i, err := range errs {
+		if err != nil {
+			t.Errorf("replica %d got %s, wanted nil", i, err)
+		}
+	}
+	db, err := OpenDB(dsn)
+	if err != nil {
+		t.Fatalf("database not open: %s", err)
+	}
+	defer db.Close()
+	migrations, _ := loadMigrations()
+	applied := 0
+	db.Get(&applied, "SELECT COUNT(*) FROM schema_version")
+	if applied != len(migrations) {
+		t.Errorf("got %d rows in schema_version, wanted %d", applied, len(migrations))
+	}
+}
+
+func TestQuoteLiteral(t *testing.T) {
+	actual := quoteLiteral("it's")
+	if actual != "'it''s'" {
+		t.Errorf("got %q, wanted %q", actual, "'it''s'")
+	}
+}
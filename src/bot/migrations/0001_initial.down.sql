@@ -0,0 +1,3 @@
+DROP TABLE votingRecord;
+DROP TABLE scoreboardTable;
+DROP TABLE challengeTable;
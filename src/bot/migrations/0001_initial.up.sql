@@ -0,0 +1,4 @@
+-- the tables the bot has always created on startup, existing databases already have them
+CREATE TABLE IF NOT EXISTS challengeTable(MessageID text primary key, ChallengerID text, ChallengerName text, DefenderID text, DefenderName text, ChallengerVotes int, DefenderVotes int, AbstainVotes int, StopVotes int, Outcome int);
+CREATE TABLE IF NOT EXISTS scoreboardTable(UserID text primary key, Username text, TotalChallengeWins int, TotalChallengeLosses int, TotalChallengeTies int, TotalChallenges int, SuccessfulChallenges int, FailedChallenges int, SuccessfulDefenses int, FailedDefenses int);
+CREATE TABLE IF NOT EXISTS votingRecord(UserID text, MessageID text, ChallengerVotes int, DefenderVotes int, AbstainVotes int, StopVotes int, PRIMARY KEY (UserID, MessageID));
@@ -0,0 +1,9 @@
+-- a user's records from every guild are added together again
+CREATE TABLE scoreboardTable_old(UserID text primary key, Username text, TotalChallengeWins int, TotalChallengeLosses int, TotalChallengeTies int, TotalChallenges int, SuccessfulChallenges int, FailedChallenges int, SuccessfulDefenses int, FailedDefenses int);
+INSERT INTO scoreboardTable_old (UserID, Username, TotalChallengeWins, TotalChallengeLosses, TotalChallengeTies, TotalChallenges, SuccessfulChallenges, FailedChallenges, SuccessfulDefenses, FailedDefenses) SELECT UserID, MAX(Username), SUM(TotalChallengeWins), SUM(TotalChallengeLosses), SUM(TotalChallengeTies), SUM(TotalChallenges), SUM(SuccessfulChallenges), SUM(FailedChallenges), SUM(SuccessfulDefenses), SUM(FailedDefenses) FROM scoreboardTable GROUP BY UserID;
+DROP TABLE scoreboardTable;
+ALTER TABLE scoreboardTable_old RENAME TO scoreboardTable;
+DROP INDEX challengeTable_guild;
+ALTER TABLE votingRecord DROP COLUMN GuildID;
+ALTER TABLE challengeTable DROP COLUMN ChannelID;
+ALTER TABLE challengeTable DROP COLUMN GuildID;
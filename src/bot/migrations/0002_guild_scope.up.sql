@@ -0,0 +1,12 @@
+-- every row belongs to a guild, rows from before this migration go to the default guild
+ALTER TABLE challengeTable ADD COLUMN GuildID text NOT NULL DEFAULT '';
+ALTER TABLE challengeTable ADD COLUMN ChannelID text NOT NULL DEFAULT '';
+UPDATE challengeTable SET GuildID = {{DefaultGuildID}};
+ALTER TABLE votingRecord ADD COLUMN GuildID text NOT NULL DEFAULT '';
+UPDATE votingRecord SET GuildID = {{DefaultGuildID}};
+-- a user has a separate record in every guild, so the scoreboard's key changes
+CREATE TABLE scoreboardTable_new(GuildID text NOT NULL DEFAULT '', UserID text, Username text, TotalChallengeWins int, TotalChallengeLosses int, TotalChallengeTies int, TotalChallenges int, SuccessfulChallenges int, FailedChallenges int, SuccessfulDefenses int, FailedDefenses int, PRIMARY KEY (GuildID, UserID));
+INSERT INTO scoreboardTable_new (GuildID, UserID, Username, TotalChallengeWins, TotalChallengeLosses, TotalChallengeTies, TotalChallenges, SuccessfulChallenges, FailedChallenges, SuccessfulDefenses, FailedDefenses) SELECT {{DefaultGuildID}}, UserID, Username, TotalChallengeWins, TotalChallengeLosses, TotalChallengeTies, TotalChallenges, SuccessfulChallenges, FailedChallenges, SuccessfulDefenses, FailedDefenses FROM scoreboardTable;
+DROP TABLE scoreboardTable;
+ALTER TABLE scoreboardTable_new RENAME TO scoreboardTable;
+CREATE INDEX challengeTable_guild ON challengeTable (GuildID);
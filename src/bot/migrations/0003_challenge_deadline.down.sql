@@ -0,0 +1,3 @@
+DROP INDEX challengeTable_deadline;
+ALTER TABLE challengeTable DROP COLUMN Status;
+ALTER TABLE challengeTable DROP COLUMN Deadline;
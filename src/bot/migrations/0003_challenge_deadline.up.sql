@@ -0,0 +1,6 @@
+-- Deadline is when voting closes on its own (unix seconds, 0 for never), Status is 0 while open and 1 once closed
+ALTER TABLE challengeTable ADD COLUMN Deadline bigint NOT NULL DEFAULT 0;
+ALTER TABLE challengeTable ADD COLUMN Status int NOT NULL DEFAULT 0;
+-- challenges were only ever closed by two stop votes
+UPDATE challengeTable SET Status = 1 WHERE StopVotes >= 2;
+CREATE INDEX challengeTable_deadline ON challengeTable (Status, Deadline);
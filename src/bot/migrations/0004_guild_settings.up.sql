@@ -0,0 +1,2 @@
+-- per-guild settings, a guild without a row uses the bot's defaults
+CREATE TABLE guildSettings(GuildID text primary key, CloseRule int NOT NULL DEFAULT 0, CloseValue int NOT NULL DEFAULT 2);
@@ -0,0 +1,2 @@
+DROP TABLE ratingHistory;
+ALTER TABLE scoreboardTable DROP COLUMN Rating;
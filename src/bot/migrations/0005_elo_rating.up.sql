@@ -0,0 +1,4 @@
+-- everyone starts at 1000, including users from before ratings existed
+ALTER TABLE scoreboardTable ADD COLUMN Rating int NOT NULL DEFAULT 1000;
+-- each participant's rating before and after every challenge that changed it
+CREATE TABLE ratingHistory(GuildID text, MessageID text, UserID text, RatingBefore int, RatingAfter int, PRIMARY KEY (GuildID, MessageID, UserID));
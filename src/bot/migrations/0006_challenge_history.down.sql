@@ -0,0 +1,4 @@
+DROP INDEX challengeTable_defender;
+DROP INDEX challengeTable_challenger;
+ALTER TABLE challengeTable DROP COLUMN CreatedAt;
+ALTER TABLE challengeTable DROP COLUMN Statement;
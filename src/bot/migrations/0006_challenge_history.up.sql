@@ -0,0 +1,6 @@
+-- the challenged message and when the challenge started, for !history and !challenge info.
+-- challenges from before this have no statement and a CreatedAt of 0
+ALTER TABLE challengeTable ADD COLUMN Statement text NOT NULL DEFAULT '';
+ALTER TABLE challengeTable ADD COLUMN CreatedAt bigint NOT NULL DEFAULT 0;
+CREATE INDEX challengeTable_challenger ON challengeTable (GuildID, ChallengerID, CreatedAt);
+CREATE INDEX challengeTable_defender ON challengeTable (GuildID, DefenderID, CreatedAt);
@@ -0,0 +1,2 @@
+ALTER TABLE challengeTable DROP COLUMN ClosedAt;
+ALTER TABLE challengeTable DROP COLUMN StatementMessageID;
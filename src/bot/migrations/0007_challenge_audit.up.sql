@@ -0,0 +1,4 @@
+-- the challenged message's own ID (MessageID is the announcement's) and when voting closed,
+-- both are empty/0 for challenges from before they were recorded
+ALTER TABLE challengeTable ADD COLUMN StatementMessageID text NOT NULL DEFAULT '';
+ALTER TABLE challengeTable ADD COLUMN ClosedAt bigint NOT NULL DEFAULT 0;
@@ -0,0 +1,2 @@
+DROP TABLE seasonStandings;
+DROP TABLE seasons;
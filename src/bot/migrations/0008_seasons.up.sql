@@ -0,0 +1,5 @@
+-- numbered seasons per guild, EndedAt is 0 for the season that's running.
+-- season 0 holds the standings from before the guild's first season
+CREATE TABLE seasons(GuildID text, Season int, StartedAt bigint NOT NULL DEFAULT 0, EndedAt bigint NOT NULL DEFAULT 0, PRIMARY KEY (GuildID, Season));
+-- everyone's final record and rank in each season that has ended
+CREATE TABLE seasonStandings(GuildID text, Season int, FinalRank int, UserID text, Username text, TotalChallengeWins int, TotalChallengeLosses int, TotalChallengeTies int, TotalChallenges int, SuccessfulChallenges int, FailedChallenges int, SuccessfulDefenses int, FailedDefenses int, Rating int, PRIMARY KEY (GuildID, Season, UserID));
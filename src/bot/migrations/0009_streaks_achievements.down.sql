@@ -0,0 +1,5 @@
+DROP TABLE achievements;
+ALTER TABLE scoreboardTable DROP COLUMN BestDefenseStreak;
+ALTER TABLE scoreboardTable DROP COLUMN CurrentDefenseStreak;
+ALTER TABLE scoreboardTable DROP COLUMN BestWinStreak;
+ALTER TABLE scoreboardTable DROP COLUMN CurrentWinStreak;
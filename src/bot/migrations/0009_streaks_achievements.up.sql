@@ -0,0 +1,7 @@
+-- wins in a row and wins in a row as defender, the current run and the best one this season
+ALTER TABLE scoreboardTable ADD COLUMN CurrentWinStreak int NOT NULL DEFAULT 0;
+ALTER TABLE scoreboardTable ADD COLUMN BestWinStreak int NOT NULL DEFAULT 0;
+ALTER TABLE scoreboardTable ADD COLUMN CurrentDefenseStreak int NOT NULL DEFAULT 0;
+ALTER TABLE scoreboardTable ADD COLUMN BestDefenseStreak int NOT NULL DEFAULT 0;
+-- achievements each user has unlocked, MessageID is the challenge that unlocked it
+CREATE TABLE achievements(GuildID text, UserID text, Achievement text, MessageID text, UnlockedAt bigint NOT NULL DEFAULT 0, PRIMARY KEY (GuildID, UserID, Achievement));
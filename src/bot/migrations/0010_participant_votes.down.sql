@@ -0,0 +1 @@
+ALTER TABLE guildSettings DROP COLUMN ParticipantVotes;
@@ -0,0 +1,2 @@
+-- what the challenger's and defender's own votes for a side count as, 0 counts them like anyone else's
+ALTER TABLE guildSettings ADD COLUMN ParticipantVotes int NOT NULL DEFAULT 0;
@@ -0,0 +1,2 @@
+ALTER TABLE guildSettings DROP COLUMN CloseRoleID;
+ALTER TABLE guildSettings DROP COLUMN Closers;
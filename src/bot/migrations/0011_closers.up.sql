@@ -0,0 +1,3 @@
+-- who may vote ✋: 0 is anyone, otherwise 1 for the participants plus 2 for members of CloseRoleID
+ALTER TABLE guildSettings ADD COLUMN Closers int NOT NULL DEFAULT 0;
+ALTER TABLE guildSettings ADD COLUMN CloseRoleID text NOT NULL DEFAULT '';
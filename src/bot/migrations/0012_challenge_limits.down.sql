@@ -0,0 +1,5 @@
+DROP INDEX challengeTable_channel;
+ALTER TABLE guildSettings DROP COLUMN MaxOpenChallenges;
+ALTER TABLE guildSettings DROP COLUMN ChannelCooldown;
+ALTER TABLE guildSettings DROP COLUMN DefenderCooldown;
+ALTER TABLE guildSettings DROP COLUMN ChallengerCooldown;
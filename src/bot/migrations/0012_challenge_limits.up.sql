@@ -0,0 +1,9 @@
+-- cooldowns in seconds between challenges by the same challenger, against the same defender and in
+-- the same channel (0 for none), and how many open challenges a user can be in (0 for no cap).
+-- they're all off until a guild's managers turn them on. when challenges started is already in
+-- challengeTable, so limits carry on across restarts
+ALTER TABLE guildSettings ADD COLUMN ChallengerCooldown int NOT NULL DEFAULT 0;
+ALTER TABLE guildSettings ADD COLUMN DefenderCooldown int NOT NULL DEFAULT 0;
+ALTER TABLE guildSettings ADD COLUMN ChannelCooldown int NOT NULL DEFAULT 0;
+ALTER TABLE guildSettings ADD COLUMN MaxOpenChallenges int NOT NULL DEFAULT 0;
+CREATE INDEX challengeTable_channel ON challengeTable (GuildID, ChannelID, CreatedAt);
@@ -0,0 +1,5 @@
+ALTER TABLE guildSettings DROP COLUMN AcceptTimeout;
+ALTER TABLE guildSettings DROP COLUMN AcceptRule;
+DROP INDEX challengeTable_acceptby;
+ALTER TABLE challengeTable DROP COLUMN AcceptBy;
+ALTER TABLE challengeTable DROP COLUMN Acceptance;
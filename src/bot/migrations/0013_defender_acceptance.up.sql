@@ -0,0 +1,10 @@
+-- guilds can make the defender accept a challenge before voting opens. Status 2 is waiting for
+-- them until AcceptBy (unix seconds, 0 for challenges that opened right away), Acceptance is 1
+-- once they accepted, 2 if they declined and 3 if they didn't answer in time
+ALTER TABLE challengeTable ADD COLUMN Acceptance int NOT NULL DEFAULT 0;
+ALTER TABLE challengeTable ADD COLUMN AcceptBy bigint NOT NULL DEFAULT 0;
+CREATE INDEX challengeTable_acceptby ON challengeTable (Status, AcceptBy);
+-- 0 opens voting right away, 1 waits for the defender and 2 also counts a decline or no answer
+-- as a forfeit. AcceptTimeout is how long the defender has, in seconds
+ALTER TABLE guildSettings ADD COLUMN AcceptRule int NOT NULL DEFAULT 0;
+ALTER TABLE guildSettings ADD COLUMN AcceptTimeout int NOT NULL DEFAULT 3600;
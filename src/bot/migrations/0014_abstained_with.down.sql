@@ -0,0 +1 @@
+ALTER TABLE votingRecord DROP COLUMN AbstainedWith;
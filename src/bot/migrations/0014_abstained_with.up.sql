@@ -0,0 +1,3 @@
+-- the reaction an abstention was cast with: 2 for the abstain reaction itself, or 0 and 1 for a
+-- participant's vote for the challenger or defender that their guild counts as an abstention
+ALTER TABLE votingRecord ADD COLUMN AbstainedWith int NOT NULL DEFAULT 2;
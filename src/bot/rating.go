@@ -0,0 +1,21 @@
+package db
+
+import (
+	"math"
+)
+
+// eloRatings works out both participants' new ratings from a challenge's outcome. The winner
+// takes more points for beating someone rated above them, and the points change hands so the
+// total stays the same
+func eloRatings(challengerRating int, defenderRating int, outcome int) (int, int) {
+	expected := 1 / (1 + math.Pow(10, float64(defenderRating-challengerRating)/400))
+	score := 0.5
+	if outcome == 1 {
+		score = 1
+	}
+	if outcome == 2 {
+		score = 0
+	}
+	change := int(math.Round(eloK * (score - expected)))
+	return challengerRating + change, defenderRating - change
+}
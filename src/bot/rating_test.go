@@ -0,0 +1,28 @@
+package db
+
+import "testing"
+
+func TestEloRatings(t *testing.T) {
+	tests := []struct {
+		challenger, defender, outcome int
+		wantChallenger, wantDefender  int
+	}{
+		{1000, 1000, 1, 1016, 984},
+		{1000, 1000, 2, 984, 1016},
+		{1000, 1000, 0, 1000, 1000},
+		//beating someone rated higher is worth more than beating an equal
+		{1000, 1200, 1, 1024, 1176},
+		{1200, 1000, 1, 1208, 992},
+		//a tie with a higher rated user still gains a little
+		{1000, 1200, 0, 1008, 1192},
+	}
+	for _, test := range tests {
+		challenger, defender := eloRatings(test.challenger, test.defender, test.outcome)
+		if challenger != test.wantChallenger || defender != test.wantDefender {
+			t.Errorf("eloRatings(%d, %d, %d): got %d and %d, wanted %d and %d", test.challenger, test.defender, test.outcome, challenger, defender, test.wantChallenger, test.wantDefender)
+		}
+		if challenger+defender != test.challenger+test.defender {
+			t.Errorf("eloRatings(%d, %d, %d): ratings should add up to the same total", test.challenger, test.defender, test.outcome)
+		}
+	}
+}
@@ -0,0 +1,214 @@
+package db
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// embedsAllowed is true when the bot can post embeds in the channel. Without Embed Links
+// everything is sent as plain text instead
+func (b *Bot) embedsAllowed(s session, channelID string) bool {
+	permissions, err := s.UserChannelPermissions(b.botID, channelID)
+	if err != nil {
+		oops(err, "UserChannelPermissions")
+		return false
+	}
+	return permissions&(discordgo.PermissionEmbedLinks|discordgo.PermissionAdministrator) != 0
+}
+
+// announcement is the content and embeds of a new challenge's announcement, the content
+// mentions both participants either way so they're notified
+func (b *Bot) announcement(s session, channelID string, challenger *discordgo.User, defender *discordgo.User, statement string, deadline int64, settings GuildSettingsEntryStruct) (string, []*discordgo.MessageEmbed) {
+	if !b.embedsAllowed(s, channelID) {
+		return challengeAnnouncement(challenger.ID, defender.ID, statement, deadline, settings), nil
+	}
+	content := "<@" + challenger.ID + ">" + challengeMessage1 + "<@" + defender.ID + ">!"
+	return content, []*discordgo.MessageEmbed{challengeEmbed(challenger, defender, statement, deadline, settings)}
+}
+
+// refuseAnnouncement changes an announcement whose challenge couldn't be started to the refusal,
+// without its buttons
+func (b *Bot) refuseAnnouncement(s session, channelID string, announcementID string, refusal string) error {
+	edit := &discordgo.MessageEdit{
+		ID:         announcementID,
+		Channel:    channelID,
+		Components: []discordgo.MessageComponent{},
+	}
+	if b.embedsAllowed(s, channelID) {
+		edit.Embeds = []*discordgo.MessageEmbed{{Title: "Challenge not started", Description: refusal, Color: tieColor}}
+	} else {
+		edit.Content = &refusal
+	}
+	_, err := s.ChannelMessageEditComplex(edit)
+	return err
+}
+
+func challengeEmbed(challenger *discordgo.User, defender *discordgo.User, statement string, deadline int64, settings GuildSettingsEntryStruct) *discordgo.MessageEmbed {
+	embed := &discordgo.MessageEmbed{
+		Author:      &discordgo.MessageEmbedAuthor{Name: challenger.Username + challengeMessage1 + defender.Username + "!", IconURL: challenger.AvatarURL("")},
+		Thumbnail:   &discordgo.MessageEmbedThumbnail{URL: defender.AvatarURL("")},
+		Description: "<@" + defender.ID + "> says:\n> " + statement + "\n\n<@" + challenger.ID + "> disagrees!",
+		Color:       challengerColor,
+		Fields: []*discordgo.MessageEmbedField{
+			{Name: challengeMessage2, Value: voteChallenger + " <@" + challenger.ID + ">\n" + voteDefender + " <@" + defender.ID + ">\n" + voteAbstain + " Abstain\n" + voteStop + " Close voting (" + settings.closeText() + ")"},
+		},
+	}
+	if deadline > 0 {
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{Name: "Time limit", Value: "Voting closes <t:" + strconv.FormatInt(deadline, 10) + ":R>"})
+	}
+	return embed
+}
+
+// sendResult posts the winner of a closed challenge to its channel, after prefix, along with the
+// achievements it unlocked when it was scored
+func (b *Bot) sendResult(s session, channelID string, challengeEntry ChallengeTableEntryStruct, prefix string) {
+	unlocked := b.challengeAchievements(challengeEntry)
+	if !b.embedsAllowed(s, channelID) {
+		content := prefix + resultMessage(challengeEntry)
+		if len(unlocked) > 0 {
+			content += "\n\n" + achievementsText(unlocked)
+		}
+		_, err := s.ChannelMessageSend(channelID, content)
+		if err != nil {
+			oops(err, "ChannelMessageSend")
+		}
+		return
+	}
+	embed := resultEmbed(challengeEntry)
+	if len(unlocked) > 0 {
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{Name: "Achievements unlocked", Value: achievementsText(unlocked)})
+	}
+	_, err := s.ChannelMessageSendComplex(channelID, &discordgo.MessageSend{
+		Content: prefix,
+		Embeds:  []*discordgo.MessageEmbed{embed},
+	})
+	if err != nil {
+		oops(err, "ChannelMessageSendComplex")
+	}
+}
+
+// resultEmbed is resultMessage in the winner's color
+func resultEmbed(challengeEntry ChallengeTableEntryStruct) *discordgo.MessageEmbed {
+	embed := &discordgo.MessageEmbed{
+		Title:       "It's a tie!",
+		Description: "The challenge between <@" + challengeEntry.ChallengerID + "> and <@" + challengeEntry.DefenderID + "> was a tie!",
+		Color:       tieColor,
+		Fields: []*discordgo.MessageEmbedField{
+			{Name: voteChallenger + " " + challengeEntry.ChallengerName, Value: strconv.Itoa(challengeEntry.ChallengerVotes), Inline: true},
+			{Name: voteDefender + " " + challengeEntry.DefenderName, Value: strconv.Itoa(challengeEntry.DefenderVotes), Inline: true},
+			{Name: voteAbstain + " Abstain", Value: strconv.Itoa(challengeEntry.AbstainVotes), Inline: true},
+		},
+		Footer: challengeFooter(challengeEntry),
+	}
+	switch winnerID(challengeEntry) {
+	case challengeEntry.ChallengerID:
+		embed.Title = challengeEntry.ChallengerName + " has won the challenge!"
+		embed.Description = "<@" + challengeEntry.ChallengerID + "> was right, <@" + challengeEntry.DefenderID + "> was wrong."
+		embed.Color = challengerColor
+		if forfeited(challengeEntry) {
+			//nobody voted, there's no score to show
+			embed.Description = acceptanceLine(challengeEntry)
+			embed.Fields = nil
+		}
+	case challengeEntry.DefenderID:
+		embed.Title = challengeEntry.DefenderName + " has won the challenge!"
+		embed.Description = "<@" + challengeEntry.DefenderID + "> was right, <@" + challengeEntry.ChallengerID + "> was wrong."
+		embed.Color = defenderColor
+	}
+	return embed
+}
+
+// challengeFooter marks an embed with the challenge it's about
+func challengeFooter(challengeEntry ChallengeTableEntryStruct) *discordgo.MessageEmbedFooter {
+	return &discordgo.MessageEmbedFooter{Text: challengeFooterPrefix + challengeEntry.MessageID}
+}
+
+// scoreReply is the !checkscore and /score reply for user, the embed shows their avatar
+func (b *Bot) scoreReply(s session, channelID string, guildID string, user *discordgo.User) (string, []*discordgo.MessageEmbed, error) {
+	if !b.embedsAllowed(s, channelID) {
+		output, err := b.checkScore(guildID, user.ID)
+		return output, nil, err
+	}
+	row, err := b.Store.SelectScoreboardRow(guildID, user.ID)
+	if err != nil {
+		//checkScore explains that they haven't played yet
+		output, err := b.checkScore(guildID, user.ID)
+		return output, nil, err
+	}
+	achievements, err := b.achievementNames(guildID, user.ID)
+	if err != nil {
+		return "", nil, err
+	}
+	return "", []*discordgo.MessageEmbed{scorecardEmbed(row, user, achievements)}, nil
+}
+
+// scorecardEmbed is scoreboardToString with a field for each stat, and the names of the
+// achievements the user has unlocked
+func scorecardEmbed(row ScoreboardTableEntryStruct, user *discordgo.User, achievements []string) *discordgo.MessageEmbed {
+	stat := func(name string, value int) *discordgo.MessageEmbedField {
+		return &discordgo.MessageEmbedField{Name: name, Value: strconv.Itoa(value), Inline: true}
+	}
+	embed := &discordgo.MessageEmbed{
+		Title:       row.Username + "'s challenge record",
+		Description: "<@" + row.UserID + "> is rated " + strconv.Itoa(row.Rating) + ".",
+		Color:       challengerColor,
+		Fields: []*discordgo.MessageEmbedField{
+			stat("Wins", row.TotalChallengeWins),
+			stat("Losses", row.TotalChallengeLosses),
+			stat("Ties", row.TotalChallengeTies),
+			stat("Wins as challenger", row.SuccessfulChallenges),
+			stat("Losses as challenger", row.FailedChallenges),
+			stat("Total challenges", row.TotalChallenges),
+			stat("Wins as defender", row.SuccessfulDefenses),
+			stat("Losses as defender", row.FailedDefenses),
+			stat("Rating", row.Rating),
+			{Name: "Win streak", Value: strconv.Itoa(row.CurrentWinStreak) + " (best " + strconv.Itoa(row.BestWinStreak) + ")", Inline: true},
+			{Name: "Defense streak", Value: strconv.Itoa(row.CurrentDefenseStreak) + " (best " + strconv.Itoa(row.BestDefenseStreak) + ")", Inline: true},
+		},
+	}
+	if len(achievements) > 0 {
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{Name: "Achievements", Value: strings.Join(achievements, ", ")})
+	}
+	if user.Avatar != "" {
+		embed.Thumbnail = &discordgo.MessageEmbedThumbnail{URL: user.AvatarURL("")}
+	}
+	return embed
+}
+
+// tallyText is tallyEmbed for channels without embeds, it goes at the end of the announcement after tallyMarker
+func tallyText(challengeEntry ChallengeTableEntryStruct, rule CloseRule, tally stopTally) string {
+	if notAccepted(challengeEntry) {
+		return tallyMarker + acceptanceTitle(challengeEntry) + "\n" + leaderLine(challengeEntry)
+	}
+	title := "Current tally"
+	if challengeEntry.Status != ChallengeOpen {
+		title = "Final tally"
+	}
+	if challengeEntry.Outcome == OutcomeCancelled {
+		title = "Cancelled"
+	}
+	text := tallyMarker + title + ": " + voteChallenger + " " + strconv.Itoa(challengeEntry.ChallengerVotes) + " · " + voteDefender + " " + strconv.Itoa(challengeEntry.DefenderVotes) + " · " + voteAbstain + " " + strconv.Itoa(challengeEntry.AbstainVotes)
+	if challengeEntry.Status == ChallengeOpen {
+		text += "\n" + voteStop + " " + rule.progress(tally)
+	}
+	return text + "\n" + leaderLine(challengeEntry)
+}
+
+// withoutTally is an announcement's content before tallyText was added
+func withoutTally(content string) string {
+	return strings.Split(content, tallyMarker)[0]
+}
+
+// withoutTallyEmbed is an announcement's embeds without tallyEmbed, which is recognised by its footer
+func withoutTallyEmbed(embeds []*discordgo.MessageEmbed) []*discordgo.MessageEmbed {
+	kept := []*discordgo.MessageEmbed{}
+	for _, embed := range embeds {
+		if embed.Footer != nil && strings.HasPrefix(embed.Footer.Text, challengeFooterPrefix) {
+			continue
+		}
+		kept = append(kept, embed)
+	}
+	return kept
+}
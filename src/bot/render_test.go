@@ -0,0 +1,92 @@
+package db
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestAnnouncementEmbed(t *testing.T) {
+	b := newTestBot()
+	s := &fakeSession{permissions: discordgo.PermissionEmbedLinks}
+	statement := &discordgo.Message{ID: "50", GuildID: testGuildID, Content: "Pineapple belongs on pizza", Author: &discordgo.User{ID: "2", Username: "Miia"}}
+	b.messageCreate(s, &discordgo.Message{ID: "51", GuildID: testGuildID, ChannelID: testChannelID, Content: "!challenge", Type: discordgo.MessageTypeReply, Author: &discordgo.User{ID: "1", Username: "Gabe"}, ReferencedMessage: statement})
+	if len(s.complex) != 1 || len(s.complex[0].Embeds) != 1 {
+		t.Fatalf("got %+v, wanted the announcement as an embed", s.complex)
+	}
+	if s.complex[0].Content != "<@1> has challenged <@2>!" {
+		t.Errorf("got %q, the participants should still be mentioned", s.complex[0].Content)
+	}
+	embed := s.complex[0].Embeds[0]
+	if !strings.Contains(embed.Description, "Pineapple belongs on pizza") || embed.Author.Name != "Gabe has challenged Miia!" {
+		t.Errorf("got %+v", embed)
+	}
+
+	//the tally is added after the announcement's embed, and replaced rather than added again
+	b.messageReactionCreate(s, &discordgo.MessageReaction{GuildID: testGuildID, UserID: "10", MessageID: "101", ChannelID: testChannelID, Emoji: discordgo.Emoji{Name: voteChallenger}})
+	b.messageReactionCreate(s, &discordgo.MessageReaction{GuildID: testGuildID, UserID: "11", MessageID: "101", ChannelID: testChannelID, Emoji: discordgo.Emoji{Name: voteChallenger}})
+	announcement, _ := s.ChannelMessage(testChannelID, "101")
+	if len(announcement.Embeds) != 2 || announcement.Embeds[0] != embed {
+		t.Fatalf("got %d embeds, wanted the announcement and the tally", len(announcement.Embeds))
+	}
+	if announcement.Embeds[1].Footer.Text != challengeFooterPrefix+"101" {
+		t.Errorf("got %q, wanted %q", announcement.Embeds[1].Footer.Text, challengeFooterPrefix+"101")
+	}
+}
+
+func TestResultEmbed(t *testing.T) {
+	challengeEntry := initChallengeTableEntry(testGuildID, testChannelID, "0", "1", "Gabe", "2", "Miia")
+	challengeEntry.DefenderVotes = 2
+	challengeEntry.Outcome = 2
+	embed := resultEmbed(challengeEntry)
+	if embed.Title != "Miia has won the challenge!" || embed.Color != defenderColor {
+		t.Errorf("got %q in %x, wanted %q in %x", embed.Title, embed.Color, "Miia has won the challenge!", defenderColor)
+	}
+	if embed.Footer.Text != challengeFooterPrefix+"0" {
+		t.Errorf("got %q, wanted %q", embed.Footer.Text, challengeFooterPrefix+"0")
+	}
+	challengeEntry.Outcome = 0
+	embed = resultEmbed(challengeEntry)
+	if embed.Title != "It's a tie!" || embed.Color != tieColor {
+		t.Errorf("got %q in %x, wanted %q in %x", embed.Title, embed.Color, "It's a tie!", tieColor)
+	}
+}
+
+func TestSendResultFallsBackToText(t *testing.T) {
+	b := newTestBot()
+	challengeEntry := initChallengeTableEntry(testGuildID, testChannelID, "0", "1", "Gabe", "2", "Miia")
+	challengeEntry.Outcome = 1
+	s := &fakeSession{}
+	b.sendResult(s, testChannelID, challengeEntry, "⏰ Time's up!")
+	if len(s.sent) != 1 || s.sent[0] != "⏰ Time's up!"+resultMessage(challengeEntry) {
+		t.Errorf("got %q, wanted the plain text result", s.sent)
+	}
+	s = &fakeSession{permissions: discordgo.PermissionEmbedLinks}
+	b.sendResult(s, testChannelID, challengeEntry, "⏰ Time's up!")
+	if len(s.complex) != 1 || s.complex[0].Content != "⏰ Time's up!" || s.complex[0].Embeds[0].Color != challengerColor {
+		t.Errorf("got %+v, wanted the result embed", s.complex)
+	}
+}
+
+func TestCheckScoreEmbed(t *testing.T) {
+	b := newTestChallenge(t)
+	s := &fakeSession{permissions: discordgo.PermissionEmbedLinks}
+	gabe := &discordgo.User{ID: "1", Username: "Gabe", Avatar: "abc"}
+	b.messageCreate(s, &discordgo.Message{GuildID: testGuildID, ChannelID: testChannelID, Content: "!checkscore <@1>", Author: &discordgo.User{ID: "2"}, Mentions: []*discordgo.User{gabe}})
+	if len(s.complex) != 1 || len(s.complex[0].Embeds) != 1 {
+		t.Fatalf("got %+v, wanted a scorecard embed", s.complex)
+	}
+	embed := s.complex[0].Embeds[0]
+	if embed.Title != "Gabe's challenge record" || embed.Thumbnail == nil || embed.Thumbnail.URL != gabe.AvatarURL("") {
+		t.Errorf("got %+v, wanted Gabe's record with their avatar", embed)
+	}
+	if len(embed.Fields) != 11 {
+		t.Errorf("got %d fields, wanted one for each stat", len(embed.Fields))
+	}
+	//someone without a record gets the text reply
+	b.messageCreate(s, &discordgo.Message{GuildID: testGuildID, ChannelID: testChannelID, Content: "!checkscore <@3>", Author: &discordgo.User{ID: "2"}})
+	if len(s.sent) != 1 || s.sent[0] != "<@3> hasn't taken part in any challenges yet!" {
+		t.Errorf("got %q", s.sent)
+	}
+}
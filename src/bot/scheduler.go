@@ -0,0 +1,83 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var errBadDuration = errors.New("challenge durations look like 30m, 2h or 1d, up to 7 days")
+
+// parseChallengeDuration reads the duration given to !challenge, Go durations like 30m or 1h30m
+// plus whole days like 2d
+func parseChallengeDuration(s string) (time.Duration, error) {
+	var d time.Duration
+	if strings.HasSuffix(s, "d") {
+		days, err := strconv.Atoi(strings.TrimSuffix(s, "d"))
+		if err != nil {
+			return 0, errBadDuration
+		}
+		d = time.Duration(days) * 24 * time.Hour
+	} else {
+		var err error
+		d, err = time.ParseDuration(s)
+		if err != nil {
+			return 0, errBadDuration
+		}
+	}
+	if d < minChallengeDuration || d > maxChallengeDuration {
+		return 0, errBadDuration
+	}
+	return d, nil
+}
+
+// deadlineAfter is the Deadline for a challenge that lasts d from now, 0 (no deadline) if d is 0
+func deadlineAfter(now time.Time, d time.Duration) int64 {
+	if d == 0 {
+		return 0
+	}
+	return now.Add(d).Unix()
+}
+
+// RunScheduler closes challenges whose deadline has passed, and gives up on ones whose defender
+// didn't accept in time, checking every Config.SchedulerInterval until stop is closed. Deadlines
+// live in challengeTable, so anything that expired while the bot was down is closed on the first check
+func (b *Bot) RunScheduler(stop <-chan struct{}) {
+	ticker := time.NewTicker(b.Config.SchedulerInterval)
+	defer ticker.Stop()
+	for {
+		b.closeExpiredChallenges(b.Session, time.Now())
+		b.expireUnansweredChallenges(b.Session, time.Now())
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// closeExpiredChallenges closes and scores every challenge past its deadline at now and posts
+// the results. A challenge closed by stop votes (or another copy of the bot) in the
+// meantime is skipped
+func (b *Bot) closeExpiredChallenges(s session, now time.Time) {
+	expired, err := b.Store.SelectExpiredChallenges(now.Unix())
+	if err != nil {
+		oops(err, "SelectExpiredChallenges")
+		return
+	}
+	for _, challengeEntry := range expired {
+		challengeEntry, err = b.Store.CloseChallenge(challengeEntry.GuildID, challengeEntry.MessageID)
+		if err == ErrVotingClosed || err == sql.ErrNoRows {
+			continue
+		}
+		if err != nil {
+			//still open, so the next check tries again
+			oops(err, "CloseChallenge")
+			continue
+		}
+		b.updateTally(s, challengeEntry.GuildID, challengeEntry.MessageID)
+		b.sendResult(s, challengeEntry.ChannelID, challengeEntry, "⏰ Time's up!")
+	}
+}
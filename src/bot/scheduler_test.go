@@ -0,0 +1,147 @@
+package db
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestParseChallengeDuration(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected time.Duration
+	}{
+		{"30m", 30 * time.Minute},
+		{"1h30m", 90 * time.Minute},
+		{"2d", 48 * time.Hour},
+		{"7d", maxChallengeDuration},
+	}
+	for _, test := range tests {
+		actual, err := parseChallengeDuration(test.input)
+		if err != nil || actual != test.expected {
+			t.Errorf("got %s and %v for %q, wanted %s", actual, err, test.input, test.expected)
+		}
+	}
+	for _, input := range []string{"soon", "30s", "8d", "-1h", "d"} {
+		_, err := parseChallengeDuration(input)
+		if err != errBadDuration {
+			t.Errorf("got %v for %q, wanted %v", err, input, errBadDuration)
+		}
+	}
+}
+
+func TestStoreCloseChallenge(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store) {
+		early := initChallengeTableEntry(testGuildID, testChannelID, "0", "1", "Gabe", "2", "Miia")
+		early.Deadline = 100
+		late := initChallengeTableEntry(testGuildID, testChannelID, "1", "1", "Gabe", "2", "Miia")
+		late.Deadline = 200
+		never := initChallengeTableEntry(testGuildID, testChannelID, "2", "1", "Gabe", "2", "Miia")
+		store.InsertScoreboardRow(initScoreBoardRow(testGuildID, "1", "Gabe"))
+		store.InsertScoreboardRow(initScoreBoardRow(testGuildID, "2", "Miia"))
+		store.InsertChallengeRow(late)
+		store.InsertChallengeRow(early)
+		store.InsertChallengeRow(never)
+		expired, err := store.SelectExpiredChallenges(200)
+		if err != nil {
+			t.Fatalf("got %s, wanted nil", err)
+		}
+		if len(expired) != 2 || expired[0].MessageID != "0" || expired[1].MessageID != "1" {
+			t.Errorf("got %+v, wanted challenges 0 and 1 in deadline order", expired)
+		}
+		store.RecordVote(testGuildID, "0", "10", DefenderVote, twoStopVotes)
+		closed, err := store.CloseChallenge(testGuildID, "0")
+		if err != nil || closed.Status != ChallengeClosed || closed.Outcome != 2 {
+			t.Errorf("got %+v and %v, wanted challenge 0 closed with the defender winning", closed, err)
+		}
+		if closed.ClosedAt == 0 {
+			t.Errorf("closing a challenge should record when it closed")
+		}
+		defender, _ := store.SelectScoreboardRow(testGuildID, "2")
+		if defender.SuccessfulDefenses != 1 {
+			t.Errorf("got %+v, wanted closing the challenge to score it", defender)
+		}
+		//a challenge that can't be scored isn't closed either, so the next check tries again
+		unscored := initChallengeTableEntry(testGuildID, testChannelID, "3", "1", "Gabe", "3", "Nobody")
+		store.InsertChallengeRow(unscored)
+		_, err = store.CloseChallenge(testGuildID, "3")
+		unscored, _ = store.SelectChallengeRow(testGuildID, "3")
+		if err == nil || unscored.Status != ChallengeOpen {
+			t.Errorf("got %+v and %v, wanted challenge 3 left open", unscored, err)
+		}
+		_, err = store.CloseChallenge(testGuildID, "0")
+		if err != ErrVotingClosed {
+			t.Errorf("got %v, wanted %v", err, ErrVotingClosed)
+		}
+		_, _, err = store.RecordVote(testGuildID, "0", "11", ChallengerVote, twoStopVotes)
+		if err != ErrVotingClosed {
+			t.Errorf("got %v, wanted %v", err, ErrVotingClosed)
+		}
+		expired, _ = store.SelectExpiredChallenges(200)
+		if len(expired) != 1 || expired[0].MessageID != "1" {
+			t.Errorf("got %+v, wanted only challenge 1", expired)
+		}
+		//two stop votes close a challenge too, so the scheduler leaves it alone
+		store.RecordVote(testGuildID, "1", "10", StopVote, twoStopVotes)
+		stopped, _, _ := store.RecordVote(testGuildID, "1", "11", StopVote, twoStopVotes)
+		if stopped.Status != ChallengeClosed || stopped.ClosedAt == 0 {
+			t.Errorf("got %+v, wanted challenge 1 closed with its close time", stopped)
+		}
+		expired, _ = store.SelectExpiredChallenges(200)
+		if len(expired) != 0 {
+			t.Errorf("got %+v, wanted nothing left to close", expired)
+		}
+	})
+}
+
+func TestCloseExpiredChallenges(t *testing.T) {
+	b := newTestBot()
+	now := time.Unix(1000, 0)
+	b.startChallenge(testGuildID, testChannelID, "0", "1", "Gabe", "2", "Miia", testResponse, "5", 999, 0)
+	b.startChallenge(testGuildID, testChannelID, "1", "1", "Gabe", "2", "Miia", testResponse, "5", 2000, 0)
+	b.addVote(testGuildID, "0", "10", voteChallenger)
+	s := &fakeSession{}
+	b.closeExpiredChallenges(s, now)
+	if len(s.sent) != 1 || !strings.HasPrefix(s.sent[0], "⏰ Time's up!\n<@1> has won the challenge!") {
+		t.Errorf("got %q, wanted the challenger to win", s.sent)
+	}
+	challenger, _ := b.Store.SelectScoreboardRow(testGuildID, "1")
+	if challenger.SuccessfulChallenges != 1 {
+		t.Errorf("got %d, wanted %d", challenger.SuccessfulChallenges, 1)
+	}
+	//running again, e.g. on another copy of the bot, doesn't count it twice
+	b.closeExpiredChallenges(s, now)
+	challenger, _ = b.Store.SelectScoreboardRow(testGuildID, "1")
+	if len(s.sent) != 1 || challenger.SuccessfulChallenges != 1 {
+		t.Errorf("a challenge should only be closed once")
+	}
+	challengeRow, _ := b.Store.SelectChallengeRow(testGuildID, "1")
+	if challengeRow.Status != ChallengeOpen {
+		t.Errorf("challenge 1 isn't due until 2000")
+	}
+}
+
+func TestMessageCreateChallengeDuration(t *testing.T) {
+	b := newTestBot()
+	s := &fakeSession{}
+	statement := &discordgo.Message{ID: "50", GuildID: testGuildID, Content: "Pineapple belongs on pizza", Author: &discordgo.User{ID: "2", Username: "Miia"}}
+	before := time.Now()
+	b.messageCreate(s, &discordgo.Message{ID: "51", GuildID: testGuildID, ChannelID: "9", Content: "!challenge 30m", Type: discordgo.MessageTypeReply, Author: &discordgo.User{ID: "1", Username: "Gabe"}, ReferencedMessage: statement})
+	challengeRow, err := b.Store.SelectChallengeRow(testGuildID, "101")
+	if err != nil {
+		t.Fatalf("got %s, wanted nil", err)
+	}
+	expected := before.Add(30 * time.Minute).Unix()
+	if challengeRow.Deadline < expected || challengeRow.Deadline > expected+5 {
+		t.Errorf("got %d, wanted about %d", challengeRow.Deadline, expected)
+	}
+	if len(s.complex) != 1 || !strings.Contains(s.complex[0].Content, "Voting closes <t:") {
+		t.Errorf("got %+v, wanted the deadline in the announcement", s.complex)
+	}
+	b.messageCreate(s, &discordgo.Message{ID: "52", GuildID: testGuildID, ChannelID: "9", Content: "!challenge soon", Type: discordgo.MessageTypeReply, Author: &discordgo.User{ID: "1", Username: "Gabe"}, ReferencedMessage: statement})
+	if len(s.sent) != 1 || !strings.Contains(s.sent[0], errBadDuration.Error()) {
+		t.Errorf("got %q, wanted the duration help", s.sent)
+	}
+}
@@ -0,0 +1,365 @@
+package db
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/jmoiron/sqlx"
+)
+
+var (
+	// ErrSeasonRunning is returned when starting a season while another one is still running
+	ErrSeasonRunning = errors.New("a season is already running")
+	// ErrNoSeason is returned when ending a season while none is running
+	ErrNoSeason = errors.New("no season is running")
+)
+
+// currentSeason asks leaderboardPage for the live scoreboard rather than an archived season
+const currentSeason = -1
+
+// SeasonEntryStruct fields
+type SeasonEntryStruct struct {
+	GuildID   string `db:"GuildID"`
+	Season    int    `db:"Season"`
+	StartedAt int64  `db:"StartedAt"`
+	EndedAt   int64  `db:"EndedAt"`
+	//0 while the season is running
+}
+
+// SeasonStandingEntryStruct is a user's final record and rank in a season that has ended
+type SeasonStandingEntryStruct struct {
+	Season    int `db:"Season"`
+	FinalRank int `db:"FinalRank"`
+	ScoreboardTableEntryStruct
+}
+
+// seasonName is how a season is shown, season 0 is everything before the first one
+func seasonName(season int) string {
+	if season == 0 {
+		return "Before seasons"
+	}
+	return "Season " + strconv.Itoa(season)
+}
+
+func selectSeasons(db dbtx, GuildID string) ([]SeasonEntryStruct, error) {
+	seasons := []SeasonEntryStruct{}
+	err := db.Select(&seasons, db.Rebind("SELECT GuildID, Season, StartedAt, EndedAt FROM seasons WHERE GuildID = ? ORDER BY Season"), GuildID)
+	return seasons, err
+}
+
+func insertSeasonRow(db dbtx, row SeasonEntryStruct) error {
+	query := "INSERT INTO seasons (GuildID, Season, StartedAt, EndedAt) VALUES (?, ?, ?, ?)"
+	stmt, err := db.Prepare(db.Rebind(query))
+	if err != nil {
+		oops(err, "prepare insertSeasonRow")
+		return err
+	}
+	defer stmt.Close()
+	res, err := stmt.Exec(row.GuildID, row.Season, row.StartedAt, row.EndedAt)
+	if err != nil {
+		oops(err, "execute insertSeasonRow")
+		return err
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		oops(err, "RowsAffected")
+		return err
+	}
+	rowsAffected(rows, "inserting season row")
+	return nil
+}
+
+func endSeasonRow(db dbtx, GuildID string, Season int, now int64) error {
+	query := "UPDATE seasons SET EndedAt = ? WHERE GuildID = ? AND Season = ?"
+	stmt, err := db.Prepare(db.Rebind(query))
+	if err != nil {
+		oops(err, "prepare endSeasonRow")
+		return err
+	}
+	defer stmt.Close()
+	res, err := stmt.Exec(now, GuildID, Season)
+	if err != nil {
+		oops(err, "execute endSeasonRow")
+		return err
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		oops(err, "RowsAffected")
+		return err
+	}
+	rowsAffected(rows, "ending season")
+	return nil
+}
+
+func insertSeasonStandingRow(db dbtx, row SeasonStandingEntryStruct) error {
+	query := "INSERT INTO seasonStandings (GuildID, Season, FinalRank, UserID, Username, TotalChallengeWins, TotalChallengeLosses, TotalChallengeTies, TotalChallenges, SuccessfulChallenges, FailedChallenges, SuccessfulDefenses, FailedDefenses, Rating) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)"
+	stmt, err := db.Prepare(db.Rebind(query))
+	if err != nil {
+		oops(err, "prepare insertSeasonStandingRow")
+		return err
+	}
+	defer stmt.Close()
+	res, err := stmt.Exec(row.GuildID, row.Season, row.FinalRank, row.UserID, row.Username, row.TotalChallengeWins, row.TotalChallengeLosses, row.TotalChallengeTies, row.TotalChallenges, row.SuccessfulChallenges, row.FailedChallenges, row.SuccessfulDefenses, row.FailedDefenses, row.Rating)
+	if err != nil {
+		oops(err, "execute insertSeasonStandingRow")
+		return err
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		oops(err, "RowsAffected")
+		return err
+	}
+	rowsAffected(rows, "inserting season standing")
+	return nil
+}
+
+// archiveStandings copies the guild's leaderboard into seasonStandings as the season's final
+// ranks, ranked by wins like the default leaderboard
+func archiveStandings(db dbtx, GuildID string, Season int) error {
+	count, err := countLeaderboard(db, GuildID)
+	if err != nil {
+		return err
+	}
+	rows, err := selectLeaderboard(db, GuildID, SortWins, count, 0)
+	if err != nil {
+		return err
+	}
+	for i, row := range rows {
+		err = insertSeasonStandingRow(db, SeasonStandingEntryStruct{Season, i + 1, row})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resetScoreboard puts everyone in the guild back to no challenges, no streaks and the starting rating
+func resetScoreboard(db dbtx, GuildID string) error {
+	query := "UPDATE scoreboardTable SET TotalChallengeWins = 0, TotalChallengeLosses = 0, TotalChallengeTies = 0, TotalChallenges = 0, SuccessfulChallenges = 0, FailedChallenges = 0, SuccessfulDefenses = 0, FailedDefenses = 0, Rating = ?, CurrentWinStreak = 0, BestWinStreak = 0, CurrentDefenseStreak = 0, BestDefenseStreak = 0 WHERE GuildID = ?"
+	stmt, err := db.Prepare(db.Rebind(query))
+	if err != nil {
+		oops(err, "prepare resetScoreboard")
+		return err
+	}
+	defer stmt.Close()
+	res, err := stmt.Exec(initialRating, GuildID)
+	if err != nil {
+		oops(err, "execute resetScoreboard")
+		return err
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		oops(err, "RowsAffected")
+		return err
+	}
+	rowsAffected(rows, "resetting scoreboard")
+	return nil
+}
+
+// startSeason begins the guild's next season from a reset scoreboard. Before its first season the
+// scoreboard so far is archived as season 0, challenges that finished between seasons aren't kept
+func startSeason(db *sqlx.DB, GuildID string, now int64) (SeasonEntryStruct, error) {
+	tx, err := db.Beginx()
+	if err != nil {
+		oops(err, "Beginx")
+		return SeasonEntryStruct{}, err
+	}
+	defer tx.Rollback()
+	seasons, err := selectSeasons(tx, GuildID)
+	if err != nil {
+		return SeasonEntryStruct{}, err
+	}
+	next, err := nextSeason(seasons)
+	if err != nil {
+		return SeasonEntryStruct{}, err
+	}
+	if len(seasons) == 0 {
+		count, err := countLeaderboard(tx, GuildID)
+		if err != nil {
+			return SeasonEntryStruct{}, err
+		}
+		if count > 0 {
+			err = insertSeasonRow(tx, SeasonEntryStruct{GuildID, 0, 0, now})
+			if err != nil {
+				return SeasonEntryStruct{}, err
+			}
+			err = archiveStandings(tx, GuildID, 0)
+			if err != nil {
+				return SeasonEntryStruct{}, err
+			}
+		}
+	}
+	err = resetScoreboard(tx, GuildID)
+	if err != nil {
+		return SeasonEntryStruct{}, err
+	}
+	season := SeasonEntryStruct{GuildID, next, now, 0}
+	err = insertSeasonRow(tx, season)
+	if err != nil {
+		return SeasonEntryStruct{}, err
+	}
+	return season, tx.Commit()
+}
+
+// endSeason archives the running season's standings and resets the scoreboard
+func endSeason(db *sqlx.DB, GuildID string, now int64) (SeasonEntryStruct, error) {
+	tx, err := db.Beginx()
+	if err != nil {
+		oops(err, "Beginx")
+		return SeasonEntryStruct{}, err
+	}
+	defer tx.Rollback()
+	seasons, err := selectSeasons(tx, GuildID)
+	if err != nil {
+		return SeasonEntryStruct{}, err
+	}
+	season, ok := activeSeason(seasons)
+	if !ok {
+		return SeasonEntryStruct{}, ErrNoSeason
+	}
+	err = archiveStandings(tx, GuildID, season.Season)
+	if err != nil {
+		return SeasonEntryStruct{}, err
+	}
+	err = resetScoreboard(tx, GuildID)
+	if err != nil {
+		return SeasonEntryStruct{}, err
+	}
+	err = endSeasonRow(tx, GuildID, season.Season, now)
+	if err != nil {
+		return SeasonEntryStruct{}, err
+	}
+	season.EndedAt = now
+	return season, tx.Commit()
+}
+
+// activeSeason is the season that's running, if there is one
+func activeSeason(seasons []SeasonEntryStruct) (SeasonEntryStruct, bool) {
+	for _, season := range seasons {
+		if season.Season > 0 && season.EndedAt == 0 {
+			return season, true
+		}
+	}
+	return SeasonEntryStruct{}, false
+}
+
+// nextSeason is the number the next season gets, it fails with ErrSeasonRunning if one is running
+func nextSeason(seasons []SeasonEntryStruct) (int, error) {
+	if _, ok := activeSeason(seasons); ok {
+		return 0, ErrSeasonRunning
+	}
+	next := 1
+	for _, season := range seasons {
+		if season.Season >= next {
+			next = season.Season + 1
+		}
+	}
+	return next, nil
+}
+
+// selectSeasonStandings returns one page of a season's final standings in the order sort ranks them
+func selectSeasonStandings(db dbtx, GuildID string, Season int, sort LeaderboardSort, limit int, offset int) ([]SeasonStandingEntryStruct, error) {
+	rows := []SeasonStandingEntryStruct{}
+	query := "SELECT Season, FinalRank, GuildID, UserID, Username, TotalChallengeWins, TotalChallengeLosses, TotalChallengeTies, TotalChallenges, SuccessfulChallenges, FailedChallenges, SuccessfulDefenses, FailedDefenses, Rating FROM seasonStandings WHERE GuildID = ? AND Season = ? ORDER BY " + sort.orderBy() + " LIMIT ? OFFSET ?"
+	err := db.Select(&rows, db.Rebind(query), GuildID, Season, limit, offset)
+	return rows, err
+}
+
+func countSeasonStandings(db dbtx, GuildID string, Season int) (int, error) {
+	count := 0
+	err := db.Get(&count, db.Rebind("SELECT COUNT(*) FROM seasonStandings WHERE GuildID = ? AND Season = ?"), GuildID, Season)
+	return count, err
+}
+
+// guildSeasons is the guild's seasons in order, or none if they couldn't be read
+func (b *Bot) guildSeasons(guildID string) []SeasonEntryStruct {
+	seasons, err := b.Store.SelectSeasons(guildID)
+	if err != nil {
+		oops(err, "SelectSeasons")
+		return []SeasonEntryStruct{}
+	}
+	return seasons
+}
+
+// seasonCommand handles "!season", "!season start" and "!season end", returning the reply
+func (b *Bot) seasonCommand(s session, m *discordgo.Message, parameters []string) (string, error) {
+	if len(parameters) == 1 {
+		return seasonSummary(b.guildSeasons(m.GuildID)), nil
+	}
+	if len(parameters) != 2 || (!strings.EqualFold(parameters[1], "start") && !strings.EqualFold(parameters[1], "end")) {
+		return "Usage: " + commandSeason + " [start|end]", nil
+	}
+	if !isManager(s, m.Author.ID, m.ChannelID) {
+		return "Sorry, only server managers can start or end seasons.", nil
+	}
+	now := time.Now().Unix()
+	if strings.EqualFold(parameters[1], "start") {
+		season, err := b.Store.StartSeason(m.GuildID, now)
+		if err == ErrSeasonRunning {
+			running, _ := activeSeason(b.guildSeasons(m.GuildID))
+			return "Sorry, " + seasonName(running.Season) + " is still running, end it first with `" + commandSeason + " end`.", nil
+		}
+		if err != nil {
+			return "", err
+		}
+		return seasonName(season.Season) + " has started, good luck everyone!", nil
+	}
+	season, err := b.Store.EndSeason(m.GuildID, now)
+	if err == ErrNoSeason {
+		return "Sorry, there's no season running. Start one with `" + commandSeason + " start`.", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	reply := seasonName(season.Season) + " is over! The scoreboard and ratings have been reset."
+	standings, err := b.Store.SelectSeasonStandings(m.GuildID, season.Season, SortWins, 1, 0)
+	if err != nil {
+		return "", err
+	}
+	if len(standings) > 0 {
+		reply += " <@" + standings[0].UserID + "> finished first."
+	}
+	return reply + " See the final standings with `" + commandLeaderboard + " " + seasonArgPrefix + strconv.Itoa(season.Season) + "`.", nil
+}
+
+// seasonSummary is the !season reply: the running season, if any, and the ones that have ended
+func seasonSummary(seasons []SeasonEntryStruct) string {
+	reply := "There's no season running."
+	if season, ok := activeSeason(seasons); ok {
+		reply = seasonName(season.Season) + " started <t:" + strconv.FormatInt(season.StartedAt, 10) + ":R>."
+	}
+	ended := []string{}
+	for _, season := range seasons {
+		if season.EndedAt > 0 {
+			ended = append(ended, "`"+seasonArgPrefix+strconv.Itoa(season.Season)+"`")
+		}
+	}
+	if len(ended) > 0 {
+		reply += "\nPast standings: `" + commandLeaderboard + "` with " + strings.Join(ended, ", ")
+	}
+	return reply + "\nServer managers can use `" + commandSeason + " start` and `" + commandSeason + " end`."
+}
+
+// parseSeasonArg reads "season:3" from !leaderboard
+func parseSeasonArg(s string) (int, bool) {
+	if !strings.HasPrefix(strings.ToLower(s), seasonArgPrefix) {
+		return 0, false
+	}
+	season, err := strconv.Atoi(s[len(seasonArgPrefix):])
+	if err != nil || season < 0 {
+		return 0, false
+	}
+	return season, true
+}
+
+// standingsToScoreboard drops the season and rank, so standings can be drawn like a leaderboard
+func standingsToScoreboard(standings []SeasonStandingEntryStruct) []ScoreboardTableEntryStruct {
+	rows := []ScoreboardTableEntryStruct{}
+	for _, standing := range standings {
+		rows = append(rows, standing.ScoreboardTableEntryStruct)
+	}
+	return rows
+}
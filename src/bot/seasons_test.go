@@ -0,0 +1,188 @@
+package db
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func standingUserIDs(rows []SeasonStandingEntryStruct) string {
+	ids := []string{}
+	for _, row := range rows {
+		ids = append(ids, row.UserID)
+	}
+	return strings.Join(ids, ",")
+}
+
+func TestStoreSeasons(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store) {
+		addTestScores(store)
+		season, err := store.StartSeason(testGuildID, 100)
+		if err != nil {
+			t.Fatalf("got %s, wanted nil", err)
+		}
+		if season.Season != 1 || season.StartedAt != 100 || season.EndedAt != 0 {
+			t.Errorf("got %+v, wanted season 1 running since 100", season)
+		}
+		//the scoreboard from before seasons is kept as season 0
+		standings, _ := store.SelectSeasonStandings(testGuildID, 0, SortWins, 10, 0)
+		if standingUserIDs(standings) != "2,1,3" || standings[0].FinalRank != 1 || standings[2].FinalRank != 3 {
+			t.Errorf("got %+v, wanted users 2, 1 and 3 ranked in that order", standings)
+		}
+		count, _ := store.CountLeaderboard(testGuildID)
+		if count != 0 {
+			t.Errorf("got %d users on the new season's leaderboard, wanted none", count)
+		}
+		reset, _ := store.SelectScoreboardRow(testGuildID, "2")
+		if reset.TotalChallengeWins != 0 || reset.Rating != initialRating || reset.Username != "Miia" {
+			t.Errorf("got %+v, wanted a fresh record", reset)
+		}
+		elsewhere, _ := store.SelectScoreboardRow("901", "5")
+		if elsewhere.TotalChallengeWins != 9 {
+			t.Errorf("other guilds' scoreboards should be left alone")
+		}
+		_, err = store.StartSeason(testGuildID, 150)
+		if err != ErrSeasonRunning {
+			t.Errorf("got %v, wanted %v", err, ErrSeasonRunning)
+		}
+
+		store.UpdateScoreboard(ScoreboardTableEntryStruct{testGuildID, "3", "Sam", 2, 0, 0, 2, 2, 0, 0, 0, 1030, 0, 0, 0, 0})
+		season, err = store.EndSeason(testGuildID, 200)
+		if err != nil {
+			t.Fatalf("got %s, wanted nil", err)
+		}
+		if season.Season != 1 || season.EndedAt != 200 {
+			t.Errorf("got %+v, wanted season 1 ended at 200", season)
+		}
+		standings, _ = store.SelectSeasonStandings(testGuildID, 1, SortRating, 10, 0)
+		if standingUserIDs(standings) != "3" || standings[0].Rating != 1030 {
+			t.Errorf("got %+v, wanted Sam's season", standings)
+		}
+		count, _ = store.CountSeasonStandings(testGuildID, 1)
+		if count != 1 {
+			t.Errorf("got %d, wanted %d", count, 1)
+		}
+		count, _ = store.CountLeaderboard(testGuildID)
+		if count != 0 {
+			t.Errorf("ending a season should reset the scoreboard")
+		}
+		_, err = store.EndSeason(testGuildID, 250)
+		if err != ErrNoSeason {
+			t.Errorf("got %v, wanted %v", err, ErrNoSeason)
+		}
+
+		season, _ = store.StartSeason(testGuildID, 300)
+		seasons, _ := store.SelectSeasons(testGuildID)
+		if season.Season != 2 || len(seasons) != 3 || seasons[0].Season != 0 || seasons[1].EndedAt != 200 {
+			t.Errorf("got %+v, wanted seasons 0, 1 and 2", seasons)
+		}
+	})
+}
+
+// TestStoreChallengeBetweenSeasons checks a challenge that closes after a season ends doesn't
+// count towards the next one
+func TestStoreChallengeBetweenSeasons(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store) {
+		store.InsertScoreboardRow(initScoreBoardRow(testGuildID, "1", "Gabe"))
+		store.InsertScoreboardRow(initScoreBoardRow(testGuildID, "2", "Miia"))
+		store.StartSeason(testGuildID, 100)
+		store.EndSeason(testGuildID, 200)
+		store.InsertChallengeRow(initChallengeTableEntry(testGuildID, testChannelID, "0", "1", "Gabe", "2", "Miia"))
+		store.RecordVote(testGuildID, "0", "10", ChallengerVote, twoStopVotes)
+		_, err := store.CloseChallenge(testGuildID, "0")
+		if err != nil {
+			t.Fatalf("got %s, wanted nil", err)
+		}
+		challenger, _ := store.SelectScoreboardRow(testGuildID, "1")
+		if challenger.TotalChallengeWins != 1 {
+			t.Errorf("got %+v, wanted the win on the scoreboard until the next season", challenger)
+		}
+
+		store.StartSeason(testGuildID, 300)
+		challenger, _ = store.SelectScoreboardRow(testGuildID, "1")
+		if challenger.TotalChallenges != 0 || challenger.Rating != initialRating {
+			t.Errorf("got %+v, wanted season 2 to start from a fresh record", challenger)
+		}
+		count, _ := store.CountSeasonStandings(testGuildID, 1)
+		if count != 0 {
+			t.Errorf("got %d, wanted season 1's standings left alone", count)
+		}
+	})
+}
+
+func TestStoreFirstSeasonWithoutResults(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store) {
+		store.StartSeason(testGuildID, 100)
+		seasons, _ := store.SelectSeasons(testGuildID)
+		if len(seasons) != 1 || seasons[0].Season != 1 {
+			t.Errorf("got %+v, wanted only season 1", seasons)
+		}
+	})
+}
+
+func TestParseLeaderboardArgs(t *testing.T) {
+	tests := []struct {
+		args   string
+		sort   LeaderboardSort
+		season int
+		ok     bool
+	}{
+		{"", SortWins, currentSeason, true},
+		{"rating", SortRating, currentSeason, true},
+		{"season:3", SortWins, 3, true},
+		{"Season:0 winrate", SortWinRate, 0, true},
+		{"wins rating", SortWins, currentSeason, false},
+		{"season:-1", SortWins, currentSeason, false},
+		{"season:1 season:2", SortWins, currentSeason, false},
+	}
+	for _, test := range tests {
+		sort, season, ok := parseLeaderboardArgs(strings.Fields(test.args))
+		if sort != test.sort || season != test.season || ok != test.ok {
+			t.Errorf("%q got %q, %d, %t, wanted %q, %d, %t", test.args, sort, season, ok, test.sort, test.season, test.ok)
+		}
+	}
+}
+
+func TestSeasonCommand(t *testing.T) {
+	b := newTestBot()
+	addTestScores(b.Store)
+	s := &fakeSession{}
+	send := func(content string) string {
+		b.messageCreate(s, &discordgo.Message{GuildID: testGuildID, ChannelID: testChannelID, Author: &discordgo.User{ID: "1"}, Content: content})
+		return s.sent[len(s.sent)-1]
+	}
+	if reply := send("!season start"); reply != "Sorry, only server managers can start or end seasons." {
+		t.Errorf("got %q", reply)
+	}
+	s.permissions = discordgo.PermissionManageServer
+	if reply := send("!season start"); reply != "Season 1 has started, good luck everyone!" {
+		t.Errorf("got %q", reply)
+	}
+	if reply := send("!season start"); !strings.HasPrefix(reply, "Sorry, Season 1 is still running") {
+		t.Errorf("got %q", reply)
+	}
+	embed, _, _ := b.leaderboardPage(testGuildID, SortWins, currentSeason, 0)
+	if embed.Title != "Season 1 leaderboard by wins" || embed.Description != "Nobody has finished a challenge this season yet!" {
+		t.Errorf("got %q and %q", embed.Title, embed.Description)
+	}
+	b.Store.UpdateScoreboard(ScoreboardTableEntryStruct{testGuildID, "3", "Sam", 1, 0, 0, 1, 1, 0, 0, 0, 1016, 0, 0, 0, 0})
+	if reply := send("!season end"); reply != "Season 1 is over! The scoreboard and ratings have been reset. <@3> finished first. See the final standings with `!leaderboard season:1`." {
+		t.Errorf("got %q", reply)
+	}
+	if reply := send("!season"); !strings.Contains(reply, "There's no season running.") || !strings.Contains(reply, "`season:0`, `season:1`") {
+		t.Errorf("got %q", reply)
+	}
+
+	b.messageCreate(s, &discordgo.Message{GuildID: testGuildID, ChannelID: testChannelID, Content: "!leaderboard season:0"})
+	if len(s.complex) != 1 || s.complex[0].Embeds[0].Title != "Before seasons final standings by wins" {
+		t.Fatalf("got %+v, wanted the standings from before seasons", s.complex)
+	}
+	if !strings.HasPrefix(s.complex[0].Embeds[0].Description, "**1.** <@2>: 4 wins") {
+		t.Errorf("got %q", s.complex[0].Embeds[0].Description)
+	}
+	embed, _, _ = b.leaderboardPage(testGuildID, SortWins, 7, 0)
+	if embed.Description != "Season 7 hasn't ended, or there wasn't one." {
+		t.Errorf("got %q", embed.Description)
+	}
+}
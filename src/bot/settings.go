@@ -0,0 +1,494 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// CloseRuleKind is how a guild decides that enough ✋ votes have been cast
+type CloseRuleKind int
+
+const (
+	// CloseAfterStopVotes closes voting once Value users have voted ✋
+	CloseAfterStopVotes CloseRuleKind = iota
+	// CloseAtVoterPercent closes voting once ✋ votes reach Value percent of the users who voted on a side or abstained
+	CloseAtVoterPercent
+	// CloseWhenParticipantsAgree closes voting once both the challenger and the defender have voted ✋
+	CloseWhenParticipantsAgree
+)
+
+// CloseRule is a guild's CloseRuleKind with its count or percentage
+type CloseRule struct {
+	Kind  CloseRuleKind
+	Value int
+}
+
+// stopTally is what a CloseRule looks at, counted from a challenge's voting records
+type stopTally struct {
+	StopVotes         int
+	Voters            int
+	ChallengerStopped bool
+	DefenderStopped   bool
+}
+
+// closes is true once the tally meets the rule
+func (rule CloseRule) closes(tally stopTally) bool {
+	switch rule.Kind {
+	case CloseAtVoterPercent:
+		//nothing to decide until someone has voted on a side
+		return tally.Voters > 0 && tally.StopVotes > 0 && tally.StopVotes*100 >= rule.Value*tally.Voters
+	case CloseWhenParticipantsAgree:
+		return tally.ChallengerStopped && tally.DefenderStopped
+	}
+	return tally.StopVotes >= rule.Value
+}
+
+// String describes the rule for the announcement and !settings
+func (rule CloseRule) String() string {
+	switch rule.Kind {
+	case CloseAtVoterPercent:
+		return strconv.Itoa(rule.Value) + "% of voters"
+	case CloseWhenParticipantsAgree:
+		return "both participants"
+	}
+	if rule.Value == 1 {
+		return "1 person"
+	}
+	return strconv.Itoa(rule.Value) + " people"
+}
+
+// progress is how close the tally is to meeting the rule, for the announcement's live tally
+func (rule CloseRule) progress(tally stopTally) string {
+	switch rule.Kind {
+	case CloseAtVoterPercent:
+		percent := 0
+		if tally.Voters > 0 {
+			percent = tally.StopVotes * 100 / tally.Voters
+		}
+		return strconv.Itoa(percent) + "% of voters so far, needs " + strconv.Itoa(rule.Value) + "%"
+	case CloseWhenParticipantsAgree:
+		if tally.ChallengerStopped {
+			return "The challenger has agreed, waiting for the defender"
+		}
+		if tally.DefenderStopped {
+			return "The defender has agreed, waiting for the challenger"
+		}
+		return "Waiting for both participants"
+	}
+	return strconv.Itoa(tally.StopVotes) + " of " + strconv.Itoa(rule.Value)
+}
+
+var errBadCloseRule = errors.New("the close rule is a number of votes like 3, a percentage of voters like 50%, or participants")
+
+// parseCloseRule reads the rule given to !settings close
+func parseCloseRule(s string) (CloseRule, error) {
+	if strings.EqualFold(s, "participants") {
+		return CloseRule{CloseWhenParticipantsAgree, 0}, nil
+	}
+	if strings.HasSuffix(s, "%") {
+		percent, err := strconv.Atoi(strings.TrimSuffix(s, "%"))
+		if err != nil || percent < 1 || percent > 100 {
+			return CloseRule{}, errBadCloseRule
+		}
+		return CloseRule{CloseAtVoterPercent, percent}, nil
+	}
+	votes, err := strconv.Atoi(s)
+	if err != nil || votes < 1 || votes > maxStopVotes {
+		return CloseRule{}, errBadCloseRule
+	}
+	return CloseRule{CloseAfterStopVotes, votes}, nil
+}
+
+// ParticipantVoteRule is what a challenger's or defender's vote for a side counts as in their own challenge
+type ParticipantVoteRule int
+
+const (
+	// CountParticipantVotes counts them like anyone else's
+	CountParticipantVotes ParticipantVoteRule = iota
+	// IgnoreParticipantVotes doesn't count them at all
+	IgnoreParticipantVotes
+	// ParticipantVotesAbstain counts them as abstentions
+	ParticipantVotesAbstain
+)
+
+var participantVoteRuleNames = map[ParticipantVoteRule]string{
+	CountParticipantVotes:   "count",
+	IgnoreParticipantVotes:  "ignore",
+	ParticipantVotesAbstain: "abstain",
+}
+
+// String describes the rule for !settings
+func (rule ParticipantVoteRule) String() string {
+	switch rule {
+	case IgnoreParticipantVotes:
+		return "not counted"
+	case ParticipantVotesAbstain:
+		return "counted as abstentions"
+	}
+	return "counted like anyone else's"
+}
+
+var errBadParticipantVoteRule = errors.New("participants' votes can count, ignore or abstain")
+
+// parseParticipantVoteRule reads the rule given to !settings participantvotes
+func parseParticipantVoteRule(s string) (ParticipantVoteRule, error) {
+	for rule, name := range participantVoteRuleNames {
+		if strings.EqualFold(s, name) {
+			return rule, nil
+		}
+	}
+	return CountParticipantVotes, errBadParticipantVoteRule
+}
+
+// Closers is who may vote ✋ in a guild, CloseByAnyone or a mix of the other flags
+type Closers int
+
+const (
+	// CloseByAnyone lets every user vote to close
+	CloseByAnyone Closers = 0
+	// CloseByParticipants lets the challenger and the defender vote to close
+	CloseByParticipants Closers = 1
+	// CloseByRole lets members of the guild's CloseRoleID vote to close
+	CloseByRole Closers = 2
+)
+
+var errBadClosers = errors.New("who can close voting is anyone, participants, a @role, or participants and a @role")
+
+// parseClosers reads who can close voting from the words given to !settings closers, e.g.
+// "anyone", "participants", "<@&123>" or "participants <@&123>", with the role's ID
+func parseClosers(words []string) (Closers, string, error) {
+	if len(words) == 1 && strings.EqualFold(words[0], "anyone") {
+		return CloseByAnyone, "", nil
+	}
+	closers := CloseByAnyone
+	roleID := ""
+	for _, word := range words {
+		switch {
+		case strings.EqualFold(word, "participants") && closers&CloseByParticipants == 0:
+			closers |= CloseByParticipants
+		case RegexRolePattern.MatchString(word) && closers&CloseByRole == 0:
+			closers |= CloseByRole
+			roleID = strings.TrimSuffix(strings.TrimPrefix(word, "<@&"), ">")
+		default:
+			return CloseByAnyone, "", errBadClosers
+		}
+	}
+	if closers == CloseByAnyone {
+		return CloseByAnyone, "", errBadClosers
+	}
+	return closers, roleID, nil
+}
+
+// AcceptRule is whether a guild's defenders have to accept a challenge before voting opens
+type AcceptRule int
+
+const (
+	// AcceptOff opens voting as soon as the challenge is posted
+	AcceptOff AcceptRule = iota
+	// AcceptRequired waits for the defender to accept, a decline or no answer calls the challenge off
+	AcceptRequired
+	// AcceptForfeit waits for the defender too, but a decline or no answer is a win for the challenger
+	AcceptForfeit
+)
+
+var acceptRuleNames = map[AcceptRule]string{
+	AcceptOff:      "off",
+	AcceptRequired: "on",
+	AcceptForfeit:  "forfeit",
+}
+
+var errBadAcceptRule = errors.New("accepting challenges can be off, on or forfeit")
+
+// parseAcceptRule reads the rule given to !settings accept
+func parseAcceptRule(s string) (AcceptRule, error) {
+	for rule, name := range acceptRuleNames {
+		if strings.EqualFold(s, name) {
+			return rule, nil
+		}
+	}
+	return AcceptOff, errBadAcceptRule
+}
+
+// GuildSettingsEntryStruct fields, a guild without a row uses the bot's Config
+type GuildSettingsEntryStruct struct {
+	GuildID          string              `db:"GuildID"`
+	CloseRule        CloseRuleKind       `db:"CloseRule"`
+	CloseValue       int                 `db:"CloseValue"`
+	ParticipantVotes ParticipantVoteRule `db:"ParticipantVotes"`
+	Closers          Closers             `db:"Closers"`
+	CloseRoleID      string              `db:"CloseRoleID"`
+	//the role CloseByRole lets close voting, empty without it
+	ChallengerCooldown int `db:"ChallengerCooldown"`
+	//seconds between challenges by the same challenger, 0 for none
+	DefenderCooldown int `db:"DefenderCooldown"`
+	//seconds between challenges against the same defender
+	ChannelCooldown int `db:"ChannelCooldown"`
+	//seconds between challenges in the same channel
+	MaxOpenChallenges int `db:"MaxOpenChallenges"`
+	//open challenges a user can be in at once, 0 for no cap
+	AcceptRule    AcceptRule `db:"AcceptRule"`
+	AcceptTimeout int        `db:"AcceptTimeout"`
+	//seconds the defender has to accept, when AcceptRule isn't AcceptOff
+}
+
+// closersString is who can vote ✋ in the guild, for the announcement and !settings
+func (settings GuildSettingsEntryStruct) closersString() string {
+	who := []string{}
+	if settings.Closers&CloseByParticipants != 0 {
+		who = append(who, "the participants")
+	}
+	if settings.Closers&CloseByRole != 0 {
+		who = append(who, "<@&"+settings.CloseRoleID+">")
+	}
+	if len(who) == 0 {
+		return "anyone"
+	}
+	return strings.Join(who, " and ")
+}
+
+// closeText is what it takes to close voting in the guild, for the ✋ line of the announcement
+func (settings GuildSettingsEntryStruct) closeText() string {
+	rule := settings.closeRule()
+	if settings.Closers == CloseByAnyone || rule.Kind == CloseWhenParticipantsAgree {
+		return "needs " + rule.String()
+	}
+	return "needs " + rule.String() + ", only " + settings.closersString() + " can close"
+}
+
+// mayClose is true when the guild lets userID vote ✋ on challengeEntry, roles are the user's roles
+// in the guild
+func (settings GuildSettingsEntryStruct) mayClose(challengeEntry ChallengeTableEntryStruct, userID string, roles []string) bool {
+	if settings.Closers == CloseByAnyone {
+		return true
+	}
+	//a participants close rule always needs the participants' own ✋
+	if settings.Closers&CloseByParticipants != 0 || settings.CloseRule == CloseWhenParticipantsAgree {
+		if userID == challengeEntry.ChallengerID || userID == challengeEntry.DefenderID {
+			return true
+		}
+	}
+	if settings.Closers&CloseByRole != 0 {
+		for _, role := range roles {
+			if role == settings.CloseRoleID {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// closeRule is the guild's CloseRule
+func (settings GuildSettingsEntryStruct) closeRule() CloseRule {
+	return CloseRule{settings.CloseRule, settings.CloseValue}
+}
+
+func selectGuildSettings(db dbtx, GuildID string) (GuildSettingsEntryStruct, error) {
+	settings := GuildSettingsEntryStruct{}
+	err := db.Get(&settings, db.Rebind("SELECT GuildID, CloseRule, CloseValue, ParticipantVotes, Closers, CloseRoleID, ChallengerCooldown, DefenderCooldown, ChannelCooldown, MaxOpenChallenges, AcceptRule, AcceptTimeout FROM guildSettings WHERE GuildID = ?"), GuildID)
+	return settings, err
+}
+
+func upsertGuildSettings(db dbtx, settings GuildSettingsEntryStruct) error {
+	query := "INSERT INTO guildSettings (GuildID, CloseRule, CloseValue, ParticipantVotes, Closers, CloseRoleID, ChallengerCooldown, DefenderCooldown, ChannelCooldown, MaxOpenChallenges, AcceptRule, AcceptTimeout) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?) ON CONFLICT (GuildID) DO UPDATE SET CloseRule = excluded.CloseRule, CloseValue = excluded.CloseValue, ParticipantVotes = excluded.ParticipantVotes, Closers = excluded.Closers, CloseRoleID = excluded.CloseRoleID, ChallengerCooldown = excluded.ChallengerCooldown, DefenderCooldown = excluded.DefenderCooldown, ChannelCooldown = excluded.ChannelCooldown, MaxOpenChallenges = excluded.MaxOpenChallenges, AcceptRule = excluded.AcceptRule, AcceptTimeout = excluded.AcceptTimeout"
+	stmt, err := db.Prepare(db.Rebind(query))
+	if err != nil {
+		oops(err, "prepare upsertGuildSettings")
+		return err
+	}
+	defer stmt.Close()
+	res, err := stmt.Exec(settings.GuildID, settings.CloseRule, settings.CloseValue, settings.ParticipantVotes, settings.Closers, settings.CloseRoleID, settings.ChallengerCooldown, settings.DefenderCooldown, settings.ChannelCooldown, settings.MaxOpenChallenges, settings.AcceptRule, settings.AcceptTimeout)
+	if err != nil {
+		oops(err, "execute upsertGuildSettings")
+		return err
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		oops(err, "RowsAffected")
+		return err
+	}
+	rowsAffected(rows, "saving guild settings")
+	return nil
+}
+
+// guildSettings is the guild's saved settings, or the bot's defaults if it has none
+func (b *Bot) guildSettings(guildID string) GuildSettingsEntryStruct {
+	settings, err := b.Store.SelectGuildSettings(guildID)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			oops(err, "SelectGuildSettings")
+		}
+		return GuildSettingsEntryStruct{
+			GuildID:            guildID,
+			CloseRule:          CloseAfterStopVotes,
+			CloseValue:         b.Config.StopVotesNeeded,
+			ParticipantVotes:   CountParticipantVotes,
+			Closers:            CloseByAnyone,
+			ChallengerCooldown: int(b.Config.ChallengerCooldown / time.Second),
+			DefenderCooldown:   int(b.Config.DefenderCooldown / time.Second),
+			ChannelCooldown:    int(b.Config.ChannelCooldown / time.Second),
+			MaxOpenChallenges:  b.Config.MaxOpenChallenges,
+			AcceptRule:         AcceptOff,
+			AcceptTimeout:      int(b.Config.AcceptTimeout / time.Second),
+		}
+	}
+	return settings
+}
+
+// isManager is true for users allowed to change a guild's settings: anyone with Manage Server or Administrator
+func isManager(s session, userID string, channelID string) bool {
+	permissions, err := s.UserChannelPermissions(userID, channelID)
+	if err != nil {
+		oops(err, "UserChannelPermissions")
+		return false
+	}
+	return permissions&(discordgo.PermissionManageServer|discordgo.PermissionAdministrator) != 0
+}
+
+// settingsCommand handles "!settings" and "!settings <setting> <value>" for the close rule, who
+// can close, participants' votes, the challenge limits and accepting challenges, returning the reply
+func (b *Bot) settingsCommand(s session, m *discordgo.Message, parameters []string) (string, error) {
+	settings := b.guildSettings(m.GuildID)
+	if len(parameters) == 1 {
+		return "Voting closes after ✋ from " + settings.closeRule().String() + ".\nWho can vote ✋: " + settings.closersString() + ".\nThe challenger's and defender's votes for a side are " + settings.ParticipantVotes.String() + ".\n" + settings.limitsString() + "\n" + settings.acceptString() + "\nServer managers can change these with " + settingsUsage(), nil
+	}
+	setting := strings.ToLower(parameters[1])
+	//how many words each setting takes, counting !settings and its name
+	lengths := map[string][]int{"close": {3}, "closers": {3, 4}, "participantvotes": {3}, "cooldown": {4}, "maxopen": {3}, "accept": {3, 4}}
+	ok := false
+	for _, length := range lengths[setting] {
+		ok = ok || len(parameters) == length
+	}
+	if !ok {
+		return "Usage: " + commandSettings + " [close <votes|percent%|participants> | closers <anyone|participants|@role> | participantvotes <count|ignore|abstain> | cooldown <challenger|defender|channel> <duration|off> | maxopen <number|off> | accept <off|on|forfeit> [duration]]", nil
+	}
+	if !isManager(s, m.Author.ID, m.ChannelID) {
+		return "Sorry, only server managers can change the settings.", nil
+	}
+	reply := ""
+	switch setting {
+	case "participantvotes":
+		rule, err := parseParticipantVoteRule(parameters[2])
+		if err != nil {
+			return "Sorry, " + err.Error() + ".", nil
+		}
+		settings.ParticipantVotes = rule
+		reply = "The challenger's and defender's votes for a side are now " + rule.String() + "."
+	case "closers":
+		closers, roleID, err := parseClosers(parameters[2:])
+		if err != nil {
+			return "Sorry, " + err.Error() + ".", nil
+		}
+		settings.Closers = closers
+		settings.CloseRoleID = roleID
+		reply = "Now " + settings.closersString() + " can vote ✋ to close voting."
+	case "cooldown":
+		cooldown, err := parseCooldown(parameters[3])
+		if err != nil {
+			return "Sorry, " + err.Error() + ".", nil
+		}
+		switch strings.ToLower(parameters[2]) {
+		case "challenger":
+			settings.ChallengerCooldown = cooldown
+			reply = "The challenger cooldown is now " + cooldownString(cooldown) + "."
+		case "defender":
+			settings.DefenderCooldown = cooldown
+			reply = "The defender cooldown is now " + cooldownString(cooldown) + "."
+		case "channel":
+			settings.ChannelCooldown = cooldown
+			reply = "The channel cooldown is now " + cooldownString(cooldown) + "."
+		default:
+			return "Sorry, the cooldowns are challenger, defender and channel.", nil
+		}
+	case "maxopen":
+		maxOpen, err := strconv.Atoi(parameters[2])
+		if strings.EqualFold(parameters[2], "off") {
+			maxOpen, err = 0, nil
+		}
+		if err != nil || maxOpen < 0 || maxOpen > maxOpenChallenges {
+			return "Sorry, the most open challenges a user can be in is a number up to " + strconv.Itoa(maxOpenChallenges) + ", or off.", nil
+		}
+		settings.MaxOpenChallenges = maxOpen
+		reply = "Users can now be in " + maxOpenString(maxOpen) + " at once."
+	case "accept":
+		rule, err := parseAcceptRule(parameters[2])
+		if err != nil {
+			return "Sorry, " + err.Error() + ".", nil
+		}
+		if len(parameters) == 4 {
+			timeout, err := parseChallengeDuration(parameters[3])
+			if err != nil {
+				return "Sorry, the time to accept looks like 30m, 2h or 1d, up to 7 days.", nil
+			}
+			settings.AcceptTimeout = int(timeout / time.Second)
+		}
+		settings.AcceptRule = rule
+		reply = settings.acceptString()
+	default:
+		rule, err := parseCloseRule(parameters[2])
+		if err != nil {
+			return "Sorry, " + err.Error() + ".", nil
+		}
+		settings.CloseRule = rule.Kind
+		settings.CloseValue = rule.Value
+		reply = "Voting now closes after ✋ from " + rule.String() + "."
+	}
+	err := b.Store.UpsertGuildSettings(settings)
+	if err != nil {
+		return "", err
+	}
+	return reply, nil
+}
+
+func settingsUsage() string {
+	return "`" + commandSettings + " close <votes|percent%|participants>`, `" + commandSettings + " closers <anyone|participants|@role>` (or participants and a @role), `" + commandSettings + " participantvotes <count|ignore|abstain>`, `" + commandSettings + " cooldown <challenger|defender|channel> <duration|off>`, `" + commandSettings + " maxopen <number|off>` and `" + commandSettings + " accept <off|on|forfeit> [duration]`"
+}
+
+// limitsString describes the guild's cooldowns and open challenge cap for !settings
+func (settings GuildSettingsEntryStruct) limitsString() string {
+	return "Cooldowns: " + cooldownString(settings.ChallengerCooldown) + " per challenger, " + cooldownString(settings.DefenderCooldown) + " per defender, " + cooldownString(settings.ChannelCooldown) + " per channel. Users can be in " + maxOpenString(settings.MaxOpenChallenges) + " at once."
+}
+
+func maxOpenString(maxOpen int) string {
+	if maxOpen == 0 {
+		return "any number of open challenges"
+	}
+	if maxOpen == 1 {
+		return "1 open challenge"
+	}
+	return strconv.Itoa(maxOpen) + " open challenges"
+}
+
+// checkCloser fails with ErrNotCloser when the guild doesn't let userID vote ✋ on a challenge.
+// member is the voter's guild membership if the event came with one, otherwise it's looked up
+// when a role is needed
+func (b *Bot) checkCloser(s session, guildID string, messageID string, userID string, member *discordgo.Member) error {
+	settings := b.guildSettings(guildID)
+	if settings.Closers == CloseByAnyone {
+		return nil
+	}
+	challengeEntry, err := b.Store.SelectChallengeRow(guildID, messageID)
+	if err != nil {
+		return err
+	}
+	roles := []string{}
+	if settings.Closers&CloseByRole != 0 {
+		if member == nil {
+			member, err = s.GuildMember(guildID, userID)
+			if err != nil {
+				oops(err, "GuildMember")
+			}
+		}
+		if member != nil {
+			roles = member.Roles
+		}
+	}
+	if !settings.mayClose(challengeEntry, userID, roles) {
+		return ErrNotCloser
+	}
+	return nil
+}
@@ -0,0 +1,335 @@
+package db
+
+import (
+	"database/sql"
+	"strings"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestCloseRuleCloses(t *testing.T) {
+	tests := []struct {
+		rule     CloseRule
+		tally    stopTally
+		expected bool
+	}{
+		{CloseRule{CloseAfterStopVotes, 2}, stopTally{StopVotes: 1}, false},
+		{CloseRule{CloseAfterStopVotes, 2}, stopTally{StopVotes: 2}, true},
+		{CloseRule{CloseAtVoterPercent, 50}, stopTally{StopVotes: 1, Voters: 3}, false},
+		{CloseRule{CloseAtVoterPercent, 50}, stopTally{StopVotes: 2, Voters: 4}, true},
+		{CloseRule{CloseAtVoterPercent, 50}, stopTally{StopVotes: 3, Voters: 0}, false},
+		{CloseRule{CloseWhenParticipantsAgree, 0}, stopTally{StopVotes: 5, ChallengerStopped: true}, false},
+		{CloseRule{CloseWhenParticipantsAgree, 0}, stopTally{StopVotes: 2, ChallengerStopped: true, DefenderStopped: true}, true},
+	}
+	for _, test := range tests {
+		if test.rule.closes(test.tally) != test.expected {
+			t.Errorf("got %t for %s with %+v, wanted %t", !test.expected, test.rule, test.tally, test.expected)
+		}
+	}
+}
+
+func TestParseCloseRule(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected CloseRule
+	}{
+		{"3", CloseRule{CloseAfterStopVotes, 3}},
+		{"60%", CloseRule{CloseAtVoterPercent, 60}},
+		{"Participants", CloseRule{CloseWhenParticipantsAgree, 0}},
+	}
+	for _, test := range tests {
+		actual, err := parseCloseRule(test.input)
+		if err != nil || actual != test.expected {
+			t.Errorf("got %+v and %v for %q, wanted %+v", actual, err, test.input, test.expected)
+		}
+	}
+	for _, input := range []string{"0", "26", "0%", "101%", "everyone", "%"} {
+		_, err := parseCloseRule(input)
+		if err != errBadCloseRule {
+			t.Errorf("got %v for %q, wanted %v", err, input, errBadCloseRule)
+		}
+	}
+}
+
+func TestStoreGuildSettings(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store) {
+		_, err := store.SelectGuildSettings(testGuildID)
+		if err != sql.ErrNoRows {
+			t.Errorf("got %v, wanted %v", err, sql.ErrNoRows)
+		}
+		store.UpsertGuildSettings(GuildSettingsEntryStruct{testGuildID, CloseAtVoterPercent, 50, CountParticipantVotes, CloseByAnyone, "", 0, 0, 0, 0, AcceptOff, 0})
+		store.UpsertGuildSettings(GuildSettingsEntryStruct{testGuildID, CloseAfterStopVotes, 4, ParticipantVotesAbstain, CloseByAnyone, "", 300, 0, 60, 2, AcceptForfeit, 1800})
+		actual, err := store.SelectGuildSettings(testGuildID)
+		if err != nil {
+			t.Fatalf("got %s, wanted nil", err)
+		}
+		expected := GuildSettingsEntryStruct{testGuildID, CloseAfterStopVotes, 4, ParticipantVotesAbstain, CloseByAnyone, "", 300, 0, 60, 2, AcceptForfeit, 1800}
+		if actual != expected {
+			t.Errorf("got %+v, wanted %+v", actual, expected)
+		}
+	})
+}
+
+func TestStoreRecordVoteCloseRules(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store) {
+		half := CloseRule{CloseAtVoterPercent, 50}
+		store.InsertScoreboardRow(initScoreBoardRow(testGuildID, "1", "Gabe"))
+		store.InsertScoreboardRow(initScoreBoardRow(testGuildID, "2", "Miia"))
+		store.InsertChallengeRow(initChallengeTableEntry(testGuildID, testChannelID, "0", "1", "Gabe", "2", "Miia"))
+		store.RecordVote(testGuildID, "0", "10", ChallengerVote, half)
+		store.RecordVote(testGuildID, "0", "11", DefenderVote, half)
+		store.RecordVote(testGuildID, "0", "12", DefenderVote, half)
+		challengeRow, _, _ := store.RecordVote(testGuildID, "0", "10", StopVote, half)
+		if challengeRow.Status != ChallengeOpen {
+			t.Errorf("1 of 3 voters shouldn't close the challenge")
+		}
+		//with one voter fewer, 1 of 2 is enough
+		challengeRow, err := store.RemoveVote(testGuildID, "0", "12", DefenderVote, half)
+		if err != nil || challengeRow.Status != ChallengeClosed {
+			t.Errorf("got %+v and %v, wanted the challenge closed", challengeRow, err)
+		}
+
+		participants := CloseRule{CloseWhenParticipantsAgree, 0}
+		store.InsertChallengeRow(initChallengeTableEntry(testGuildID, testChannelID, "1", "1", "Gabe", "2", "Miia"))
+		store.RecordVote(testGuildID, "1", "10", StopVote, participants)
+		store.RecordVote(testGuildID, "1", "11", StopVote, participants)
+		challengeRow, _, _ = store.RecordVote(testGuildID, "1", "1", StopVote, participants)
+		if challengeRow.Status != ChallengeOpen {
+			t.Errorf("only the challenger has agreed to close")
+		}
+		challengeRow, _, _ = store.RecordVote(testGuildID, "1", "2", StopVote, participants)
+		if challengeRow.Status != ChallengeClosed {
+			t.Errorf("both participants agreed, the challenge should be closed")
+		}
+	})
+}
+
+func TestSettingsCommand(t *testing.T) {
+	b := newTestChallenge(t)
+	s := &fakeSession{}
+	author := &discordgo.User{ID: "1", Username: "Gabe"}
+	b.messageCreate(s, &discordgo.Message{GuildID: testGuildID, ChannelID: testChannelID, Content: "!settings", Author: author})
+	b.messageCreate(s, &discordgo.Message{GuildID: testGuildID, ChannelID: testChannelID, Content: "!settings close 1", Author: author})
+	s.permissions = discordgo.PermissionManageServer
+	b.messageCreate(s, &discordgo.Message{GuildID: testGuildID, ChannelID: testChannelID, Content: "!settings close 1", Author: author})
+	b.messageCreate(s, &discordgo.Message{GuildID: testGuildID, ChannelID: testChannelID, Content: "!settings close lots", Author: author})
+	expected := []string{
+		"Voting closes after ✋ from 2 people.",
+		"Sorry, only server managers",
+		"Voting now closes after ✋ from 1 person.",
+		"Sorry, the close rule is",
+	}
+	if len(s.sent) != len(expected) {
+		t.Fatalf("got %q, wanted %d replies", s.sent, len(expected))
+	}
+	for i := range expected {
+		if !strings.HasPrefix(s.sent[i], expected[i]) {
+			t.Errorf("got %q, wanted %q", s.sent[i], expected[i])
+		}
+	}
+	_, _, closed, _ := b.addVote(testGuildID, "0", "10", voteStop)
+	if !closed {
+		t.Errorf("one ✋ should close challenges now")
+	}
+	settings := b.guildSettings("901")
+	if settings.closeRule() != twoStopVotes {
+		t.Errorf("got %+v, other guilds should keep the default", settings)
+	}
+}
+
+func TestParticipantVotes(t *testing.T) {
+	b := newTestChallenge(t)
+	s := &fakeSession{}
+	b.Store.UpsertGuildSettings(GuildSettingsEntryStruct{testGuildID, CloseAfterStopVotes, 2, ParticipantVotesAbstain, CloseByAnyone, "", 0, 0, 0, 0, AcceptOff, 0})
+	b.messageReactionCreate(s, &discordgo.MessageReaction{GuildID: testGuildID, UserID: "1", MessageID: "0", ChannelID: testChannelID, Emoji: discordgo.Emoji{Name: voteChallenger}})
+	b.addVote(testGuildID, "0", "10", voteChallenger)
+	challengeRow, _ := b.Store.SelectChallengeRow(testGuildID, "0")
+	if challengeRow.ChallengerVotes != 1 || challengeRow.AbstainVotes != 1 {
+		t.Errorf("got %+v, wanted the challenger's own vote to count as an abstention", challengeRow)
+	}
+	b.messageReactionDelete(s, &discordgo.MessageReaction{GuildID: testGuildID, UserID: "1", MessageID: "0", ChannelID: testChannelID, Emoji: discordgo.Emoji{Name: voteChallenger}})
+	challengeRow, _ = b.Store.SelectChallengeRow(testGuildID, "0")
+	if challengeRow.AbstainVotes != 0 {
+		t.Errorf("got %+v, wanted the abstention taken back", challengeRow)
+	}
+	//taking back a side only takes back the abstention it cast, not one from the abstain reaction
+	react := func(emoji string, add bool) {
+		r := &discordgo.MessageReaction{GuildID: testGuildID, UserID: "2", MessageID: "0", ChannelID: testChannelID, Emoji: discordgo.Emoji{Name: emoji}}
+		if add {
+			b.messageReactionCreate(s, r)
+		} else {
+			b.messageReactionDelete(s, r)
+		}
+	}
+	react(voteAbstain, true)
+	react(voteDefender, true)
+	//a second reaction for the same abstention doesn't count, so it's taken off
+	if len(s.removed) != 1 || s.removed[0] != "2:"+voteDefender {
+		t.Errorf("got %q, wanted the defender's uncounted reaction taken off", s.removed)
+	}
+	react(voteDefender, false)
+	challengeRow, _ = b.Store.SelectChallengeRow(testGuildID, "0")
+	if challengeRow.AbstainVotes != 1 {
+		t.Errorf("got %+v, wanted the defender's abstain reaction still counted", challengeRow)
+	}
+	react(voteAbstain, false)
+	react(voteDefender, true)
+	react(voteAbstain, false)
+	challengeRow, _ = b.Store.SelectChallengeRow(testGuildID, "0")
+	if challengeRow.AbstainVotes != 1 {
+		t.Errorf("got %+v, wanted the defender's side reaction still counted as an abstention", challengeRow)
+	}
+	react(voteDefender, false)
+	challengeRow, _ = b.Store.SelectChallengeRow(testGuildID, "0")
+	if challengeRow.AbstainVotes != 0 {
+		t.Errorf("got %+v, wanted the abstention taken back", challengeRow)
+	}
+
+	b.Store.UpsertGuildSettings(GuildSettingsEntryStruct{testGuildID, CloseAfterStopVotes, 2, IgnoreParticipantVotes, CloseByAnyone, "", 0, 0, 0, 0, AcceptOff, 0})
+	b.messageReactionCreate(s, &discordgo.MessageReaction{GuildID: testGuildID, UserID: "2", MessageID: "0", ChannelID: testChannelID, Emoji: discordgo.Emoji{Name: voteDefender}})
+	if len(s.removed) != 2 || s.removed[1] != "2:"+voteDefender {
+		t.Errorf("got %q, wanted the defender's reaction taken off", s.removed)
+	}
+	b.interactionCreate(s, buttonClick("1", ChallengerVote))
+	if len(s.responses) != 1 || !strings.HasPrefix(s.responses[0].Data.Content, "Sorry, on this server the challenger and defender can't vote") {
+		t.Errorf("got %+v, wanted the vote refused", s.responses)
+	}
+	//participants can still vote to close
+	_, _, _, err := b.addVote(testGuildID, "0", "1", voteStop)
+	challengeRow, _ = b.Store.SelectChallengeRow(testGuildID, "0")
+	if err != nil || challengeRow.DefenderVotes != 0 || challengeRow.StopVotes != 1 {
+		t.Errorf("got %+v and %v, wanted only the stop vote counted", challengeRow, err)
+	}
+}
+
+// TestParticipantVoteRuleChanged checks a participant's vote is taken back the way it was
+// counted when the guild changes its participant vote rule while the challenge is open
+func TestParticipantVoteRuleChanged(t *testing.T) {
+	b := newTestChallenge(t)
+	s := &fakeSession{}
+	settings := func(rule ParticipantVoteRule) {
+		b.Store.UpsertGuildSettings(GuildSettingsEntryStruct{testGuildID, CloseAfterStopVotes, 2, rule, CloseByAnyone, "", 0, 0, 0, 0, AcceptOff, 0})
+	}
+	react := func(userID string, emoji string, add bool) {
+		r := &discordgo.MessageReaction{GuildID: testGuildID, UserID: userID, MessageID: "0", ChannelID: testChannelID, Emoji: discordgo.Emoji{Name: emoji}}
+		if add {
+			b.messageReactionCreate(s, r)
+		} else {
+			b.messageReactionDelete(s, r)
+		}
+	}
+	react("1", voteChallenger, true)
+	settings(ParticipantVotesAbstain)
+	react("2", voteDefender, true)
+	settings(CountParticipantVotes)
+	challengeRow, _ := b.Store.SelectChallengeRow(testGuildID, "0")
+	if challengeRow.ChallengerVotes != 1 || challengeRow.DefenderVotes != 0 || challengeRow.AbstainVotes != 1 {
+		t.Fatalf("got %+v, wanted each vote counted under the rule it was cast with", challengeRow)
+	}
+	react("1", voteChallenger, false)
+	react("2", voteDefender, false)
+	challengeRow, _ = b.Store.SelectChallengeRow(testGuildID, "0")
+	if challengeRow.ChallengerVotes != 0 || challengeRow.AbstainVotes != 0 {
+		t.Errorf("got %+v, wanted both votes taken back", challengeRow)
+	}
+
+	//switching away from an abstention takes off the reaction that cast it
+	settings(ParticipantVotesAbstain)
+	react("2", voteDefender, true)
+	settings(CountParticipantVotes)
+	react("2", voteChallenger, true)
+	if len(s.removed) != 1 || s.removed[0] != "2:"+voteDefender {
+		t.Errorf("got %q, wanted the defender's old reaction taken off", s.removed)
+	}
+}
+
+func TestParseClosers(t *testing.T) {
+	tests := []struct {
+		input   string
+		closers Closers
+		roleID  string
+	}{
+		{"anyone", CloseByAnyone, ""},
+		{"Participants", CloseByParticipants, ""},
+		{"<@&77>", CloseByRole, "77"},
+		{"participants <@&77>", CloseByParticipants | CloseByRole, "77"},
+	}
+	for _, test := range tests {
+		closers, roleID, err := parseClosers(strings.Fields(test.input))
+		if err != nil || closers != test.closers || roleID != test.roleID {
+			t.Errorf("got %d, %q and %v for %q, wanted %d and %q", closers, roleID, err, test.input, test.closers, test.roleID)
+		}
+	}
+	for _, input := range []string{"everyone", "<@77>", "participants participants", "anyone participants", "<@&1> <@&2>"} {
+		_, _, err := parseClosers(strings.Fields(input))
+		if err != errBadClosers {
+			t.Errorf("got %v for %q, wanted %v", err, input, errBadClosers)
+		}
+	}
+}
+
+func TestMayClose(t *testing.T) {
+	challengeEntry := initChallengeTableEntry(testGuildID, testChannelID, "0", "1", "Gabe", "2", "Miia")
+	participants := GuildSettingsEntryStruct{testGuildID, CloseAfterStopVotes, 2, CountParticipantVotes, CloseByParticipants, "", 0, 0, 0, 0, AcceptOff, 0}
+	moderators := GuildSettingsEntryStruct{testGuildID, CloseAfterStopVotes, 2, CountParticipantVotes, CloseByRole, "77", 0, 0, 0, 0, AcceptOff, 0}
+	both := GuildSettingsEntryStruct{testGuildID, CloseAfterStopVotes, 2, CountParticipantVotes, CloseByParticipants | CloseByRole, "77", 0, 0, 0, 0, AcceptOff, 0}
+	tests := []struct {
+		settings GuildSettingsEntryStruct
+		userID   string
+		roles    []string
+		expected bool
+	}{
+		{participants, "2", nil, true},
+		{participants, "10", []string{"77"}, false},
+		{moderators, "10", []string{"5", "77"}, true},
+		{moderators, "1", nil, false},
+		{both, "1", nil, true},
+		{both, "10", []string{"77"}, true},
+		{both, "10", []string{"5"}, false},
+	}
+	for _, test := range tests {
+		if test.settings.mayClose(challengeEntry, test.userID, test.roles) != test.expected {
+			t.Errorf("got %t for %q with roles %q under %s, wanted %t", !test.expected, test.userID, test.roles, test.settings.closersString(), test.expected)
+		}
+	}
+	//the participants close rule still needs the participants, whoever else can close
+	moderators.CloseRule = CloseWhenParticipantsAgree
+	if !moderators.mayClose(challengeEntry, "1", nil) {
+		t.Errorf("the challenger should be able to agree to close")
+	}
+}
+
+func TestCloseVotesFromModerators(t *testing.T) {
+	b := newTestChallenge(t)
+	s := &fakeSession{roles: map[string][]string{"11": {"77"}}}
+	manager := &fakeSession{permissions: discordgo.PermissionManageServer}
+	b.messageCreate(manager, &discordgo.Message{GuildID: testGuildID, ChannelID: testChannelID, Content: "!settings closers participants <@&77>", Author: &discordgo.User{ID: "1"}})
+	if len(manager.sent) != 1 || manager.sent[0] != "Now the participants and <@&77> can vote ✋ to close voting." {
+		t.Errorf("got %q", manager.sent)
+	}
+	b.messageReactionCreate(s, &discordgo.MessageReaction{GuildID: testGuildID, UserID: "10", MessageID: "0", ChannelID: testChannelID, Emoji: discordgo.Emoji{Name: voteStop}})
+	if len(s.removed) != 1 || s.removed[0] != "10:"+voteStop {
+		t.Errorf("got %q, wanted the bystander's ✋ taken off", s.removed)
+	}
+	b.interactionCreate(s, buttonClick("10", StopVote))
+	if len(s.responses) != 1 || s.responses[0].Data.Content != "Sorry, only the participants and <@&77> can close voting on this server." {
+		t.Errorf("got %+v, wanted the bystander's close vote refused", s.responses)
+	}
+	challengeRow, _ := b.Store.SelectChallengeRow(testGuildID, "0")
+	if challengeRow.StopVotes != 0 {
+		t.Errorf("got %d, wanted no stop votes from bystanders", challengeRow.StopVotes)
+	}
+	b.messageReactionCreate(s, &discordgo.MessageReaction{GuildID: testGuildID, UserID: "11", MessageID: "0", ChannelID: testChannelID, Emoji: discordgo.Emoji{Name: voteStop}})
+	b.interactionCreate(s, buttonClick("2", StopVote))
+	challengeRow, _ = b.Store.SelectChallengeRow(testGuildID, "0")
+	if challengeRow.Status != ChallengeClosed {
+		t.Errorf("got %+v, wanted the moderator and the defender to close voting", challengeRow)
+	}
+
+	settings := b.guildSettings(testGuildID)
+	content, _ := b.announcement(s, testChannelID, &discordgo.User{ID: "1"}, &discordgo.User{ID: "2"}, testResponse, 0, settings)
+	if !strings.Contains(content, "(needs 2 people, only the participants and <@&77> can close)") {
+		t.Errorf("got %q, wanted who can close in the announcement", content)
+	}
+}
@@ -0,0 +1,264 @@
+package db
+
+import (
+	"github.com/jmoiron/sqlx"
+)
+
+// Store is everything the event handlers need from the database:
+// challenges, their vote counts, the scoreboard and the voting record.
+// Every row belongs to a guild, so each server has its own scoreboard.
+// SQLStore is the real backend (sqlite or Postgres), MemoryStore is used for tests.
+type Store interface {
+	InsertChallengeRow(row ChallengeTableEntryStruct) error
+	// InsertChallengeRowWithinLimits is InsertChallengeRow unless the challenge breaks one of the
+	// guild's limits at its CreatedAt, then nothing is inserted and it returns why. Checking and
+	// inserting are one step, so challenges started together can't all get past a limit
+	InsertChallengeRowWithinLimits(row ChallengeTableEntryStruct, settings GuildSettingsEntryStruct) (string, error)
+	SelectChallengeRow(GuildID string, MessageID string) (ChallengeTableEntryStruct, error)
+	SelectVotes(GuildID string, MessageID string) (VotesStruct, error)
+
+	InsertScoreboardRow(row ScoreboardTableEntryStruct) error
+	SelectScoreboardRow(GuildID string, UserID string) (ScoreboardTableEntryStruct, error)
+	UpdateScoreboard(row ScoreboardTableEntryStruct) error
+	UserInScoreboard(GuildID string, UserID string) bool
+	// PushScore adds a closed challenge to both participants' records and ratings, and keeps
+	// the rating changes in the rating history
+	PushScore(challengeEntry ChallengeTableEntryStruct) error
+	SelectRatingHistory(GuildID string, MessageID string) ([]RatingHistoryEntryStruct, error)
+	// SelectLeaderboard and CountLeaderboard only include users with at least one finished challenge
+	SelectLeaderboard(GuildID string, sort LeaderboardSort, limit int, offset int) ([]ScoreboardTableEntryStruct, error)
+	CountLeaderboard(GuildID string) (int, error)
+
+	// SelectChallengeHistory and CountChallengeHistory cover the challenges a user was the
+	// challenger or defender in, newest first
+	SelectChallengeHistory(GuildID string, UserID string, limit int, offset int) ([]ChallengeTableEntryStruct, error)
+	CountChallengeHistory(GuildID string, UserID string) (int, error)
+	// SelectChallengeActivity is when the challenger, the defender and the channel last had a
+	// challenge start and how many open challenges each user is in
+	SelectChallengeActivity(GuildID string, ChallengerID string, DefenderID string, ChannelID string) (ChallengeActivity, error)
+	// SelectHeadToHead lists the finished challenges between two users either way round, oldest first
+	SelectHeadToHead(GuildID string, UserA string, UserB string) ([]ChallengeTableEntryStruct, error)
+
+	// SelectSeasons lists the guild's seasons in order, StartSeason and EndSeason fail with
+	// ErrSeasonRunning and ErrNoSeason. Ending a season archives the leaderboard as its final
+	// standings and resets the scoreboard in the same step
+	SelectSeasons(GuildID string) ([]SeasonEntryStruct, error)
+	StartSeason(GuildID string, now int64) (SeasonEntryStruct, error)
+	EndSeason(GuildID string, now int64) (SeasonEntryStruct, error)
+	SelectSeasonStandings(GuildID string, Season int, sort LeaderboardSort, limit int, offset int) ([]SeasonStandingEntryStruct, error)
+	CountSeasonStandings(GuildID string, Season int) (int, error)
+
+	// UnlockAchievement saves an achievement a user unlocked, it's false if they already had it.
+	// SelectAchievements lists a user's achievements, oldest first
+	UnlockAchievement(row AchievementEntryStruct) (bool, error)
+	SelectAchievements(GuildID string, UserID string) ([]AchievementEntryStruct, error)
+	// SetAchievements is what pushing a score checks the participants against, unlocking them in
+	// the same step. None are checked until it's called
+	SetAchievements(achievements []Achievement)
+	// SelectChallengeAchievements lists the achievements a challenge unlocked when it was scored
+	SelectChallengeAchievements(GuildID string, MessageID string) ([]AchievementEntryStruct, error)
+
+	SelectVotingRecordRow(GuildID string, UserID string, MessageID string) (VotingRecordEntryStruct, error)
+	// SelectVotingRecords lists the voting records for one challenge, ordered by user ID
+	SelectVotingRecords(GuildID string, MessageID string) ([]VotingRecordEntryStruct, error)
+	// RecordVote and RemoveVote update the user's voting record, the challenge's vote
+	// counts and its outcome atomically, closing the challenge and pushing its score in the
+	// same step when rule is met. Once it's closed they fail with ErrVotingClosed. RecordVote
+	// also returns the side a new side vote replaced, or NoVote. An abstention is only removed
+	// by the vote it was recorded with, see applyVote
+	RecordVote(GuildID string, MessageID string, UserID string, vote Vote, rule CloseRule) (ChallengeTableEntryStruct, Vote, error)
+	RemoveVote(GuildID string, MessageID string, UserID string, vote Vote, rule CloseRule) (ChallengeTableEntryStruct, error)
+	// CloseChallenge ends voting when the deadline passes and pushes the score in the same
+	// step, it fails with ErrVotingClosed if the challenge was closed already so the score is
+	// only pushed once. If scoring fails the challenge stays open for the next try
+	CloseChallenge(GuildID string, MessageID string) (ChallengeTableEntryStruct, error)
+	// AnswerChallenge saves the defender's answer to a pending challenge at now (Accepted, Declined
+	// or Unanswered), see answered, and pushes the score in the same step if it's a forfeit. It
+	// fails with ErrAnswered if the challenge isn't pending, and leaves it pending if scoring fails
+	AnswerChallenge(GuildID string, MessageID string, acceptance int, forfeit bool, now int64) (ChallengeTableEntryStruct, error)
+	// SelectUnansweredChallenges lists the pending challenges in every guild whose AcceptBy is at or before now
+	SelectUnansweredChallenges(now int64) ([]ChallengeTableEntryStruct, error)
+	// CancelChallenge withdraws an open or pending challenge, it fails with ErrVotingClosed if it has closed
+	// and ErrHasVotes if anyone has voted on it, unless evenWithVotes
+	CancelChallenge(GuildID string, MessageID string, evenWithVotes bool) (ChallengeTableEntryStruct, error)
+	// SelectExpiredChallenges lists the open challenges in every guild whose deadline is at or before now
+	SelectExpiredChallenges(now int64) ([]ChallengeTableEntryStruct, error)
+
+	// SelectGuildSettings fails with sql.ErrNoRows for a guild that has never changed its settings
+	SelectGuildSettings(GuildID string) (GuildSettingsEntryStruct, error)
+	UpsertGuildSettings(row GuildSettingsEntryStruct) error
+
+	Close() error
+}
+
+// SQLStore is the Store backed by the sqlx helpers in db.go, the same queries
+// run on sqlite and Postgres
+type SQLStore struct {
+	db *sqlx.DB
+	//checked whenever a score is pushed, see SetAchievements
+	achievements []Achievement
+}
+
+// NewSQLStore wraps an open database handle, see OpenDB
+func NewSQLStore(db *sqlx.DB) *SQLStore {
+	return &SQLStore{db: db}
+}
+
+func (s *SQLStore) InsertChallengeRow(row ChallengeTableEntryStruct) error {
+	return insertChallengeRow(s.db, row)
+}
+
+func (s *SQLStore) InsertChallengeRowWithinLimits(row ChallengeTableEntryStruct, settings GuildSettingsEntryStruct) (string, error) {
+	return insertChallengeRowWithinLimits(s.db, row, settings)
+}
+
+func (s *SQLStore) SelectChallengeRow(GuildID string, MessageID string) (ChallengeTableEntryStruct, error) {
+	return selectChallengeRow(s.db, GuildID, MessageID)
+}
+
+func (s *SQLStore) SelectVotes(GuildID string, MessageID string) (VotesStruct, error) {
+	return selectVotes(s.db, GuildID, MessageID)
+}
+
+func (s *SQLStore) InsertScoreboardRow(row ScoreboardTableEntryStruct) error {
+	return insertScoreboardRow(s.db, row)
+}
+
+func (s *SQLStore) SelectScoreboardRow(GuildID string, UserID string) (ScoreboardTableEntryStruct, error) {
+	return selectScoreboardRow(s.db, GuildID, UserID)
+}
+
+func (s *SQLStore) UpdateScoreboard(row ScoreboardTableEntryStruct) error {
+	return updateScoreboard(s.db, row)
+}
+
+func (s *SQLStore) UserInScoreboard(GuildID string, UserID string) bool {
+	return userInScoreboard(s.db, GuildID, UserID)
+}
+
+func (s *SQLStore) PushScore(challengeEntry ChallengeTableEntryStruct) error {
+	tx, err := s.db.Beginx()
+	if err != nil {
+		oops(err, "Beginx")
+		return err
+	}
+	defer tx.Rollback()
+	err = pushScore(tx, challengeEntry, s.achievements)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *SQLStore) SelectRatingHistory(GuildID string, MessageID string) ([]RatingHistoryEntryStruct, error) {
+	return selectRatingHistory(s.db, GuildID, MessageID)
+}
+
+func (s *SQLStore) SelectLeaderboard(GuildID string, sort LeaderboardSort, limit int, offset int) ([]ScoreboardTableEntryStruct, error) {
+	return selectLeaderboard(s.db, GuildID, sort, limit, offset)
+}
+
+func (s *SQLStore) CountLeaderboard(GuildID string) (int, error) {
+	return countLeaderboard(s.db, GuildID)
+}
+
+func (s *SQLStore) SelectChallengeHistory(GuildID string, UserID string, limit int, offset int) ([]ChallengeTableEntryStruct, error) {
+	return selectChallengeHistory(s.db, GuildID, UserID, limit, offset)
+}
+
+func (s *SQLStore) CountChallengeHistory(GuildID string, UserID string) (int, error) {
+	return countChallengeHistory(s.db, GuildID, UserID)
+}
+
+func (s *SQLStore) SelectChallengeActivity(GuildID string, ChallengerID string, DefenderID string, ChannelID string) (ChallengeActivity, error) {
+	return selectChallengeActivity(s.db, GuildID, ChallengerID, DefenderID, ChannelID)
+}
+
+func (s *SQLStore) SelectHeadToHead(GuildID string, UserA string, UserB string) ([]ChallengeTableEntryStruct, error) {
+	return selectHeadToHead(s.db, GuildID, UserA, UserB)
+}
+
+func (s *SQLStore) SelectVotingRecords(GuildID string, MessageID string) ([]VotingRecordEntryStruct, error) {
+	return selectVotingRecords(s.db, GuildID, MessageID)
+}
+
+func (s *SQLStore) SelectSeasons(GuildID string) ([]SeasonEntryStruct, error) {
+	return selectSeasons(s.db, GuildID)
+}
+
+func (s *SQLStore) StartSeason(GuildID string, now int64) (SeasonEntryStruct, error) {
+	return startSeason(s.db, GuildID, now)
+}
+
+func (s *SQLStore) EndSeason(GuildID string, now int64) (SeasonEntryStruct, error) {
+	return endSeason(s.db, GuildID, now)
+}
+
+func (s *SQLStore) SelectSeasonStandings(GuildID string, Season int, sort LeaderboardSort, limit int, offset int) ([]SeasonStandingEntryStruct, error) {
+	return selectSeasonStandings(s.db, GuildID, Season, sort, limit, offset)
+}
+
+func (s *SQLStore) CountSeasonStandings(GuildID string, Season int) (int, error) {
+	return countSeasonStandings(s.db, GuildID, Season)
+}
+
+func (s *SQLStore) UnlockAchievement(row AchievementEntryStruct) (bool, error) {
+	return insertAchievementRow(s.db, row)
+}
+
+func (s *SQLStore) SetAchievements(achievements []Achievement) {
+	s.achievements = achievements
+}
+
+func (s *SQLStore) SelectChallengeAchievements(GuildID string, MessageID string) ([]AchievementEntryStruct, error) {
+	return selectChallengeAchievements(s.db, GuildID, MessageID)
+}
+
+func (s *SQLStore) SelectAchievements(GuildID string, UserID string) ([]AchievementEntryStruct, error) {
+	return selectAchievements(s.db, GuildID, UserID)
+}
+
+func (s *SQLStore) SelectVotingRecordRow(GuildID string, UserID string, MessageID string) (VotingRecordEntryStruct, error) {
+	return selectVotingRecordRow(s.db, GuildID, UserID, MessageID)
+}
+
+func (s *SQLStore) RecordVote(GuildID string, MessageID string, UserID string, vote Vote, rule CloseRule) (ChallengeTableEntryStruct, Vote, error) {
+	return castVote(s.db, GuildID, MessageID, UserID, vote, true, rule, s.achievements)
+}
+
+func (s *SQLStore) RemoveVote(GuildID string, MessageID string, UserID string, vote Vote, rule CloseRule) (ChallengeTableEntryStruct, error) {
+	challengeRow, _, err := castVote(s.db, GuildID, MessageID, UserID, vote, false, rule, s.achievements)
+	return challengeRow, err
+}
+
+func (s *SQLStore) CloseChallenge(GuildID string, MessageID string) (ChallengeTableEntryStruct, error) {
+	return closeChallenge(s.db, GuildID, MessageID, s.achievements)
+}
+
+func (s *SQLStore) AnswerChallenge(GuildID string, MessageID string, acceptance int, forfeit bool, now int64) (ChallengeTableEntryStruct, error) {
+	return answerChallenge(s.db, GuildID, MessageID, acceptance, forfeit, now, s.achievements)
+}
+
+func (s *SQLStore) SelectUnansweredChallenges(now int64) ([]ChallengeTableEntryStruct, error) {
+	return selectUnansweredChallenges(s.db, now)
+}
+
+func (s *SQLStore) CancelChallenge(GuildID string, MessageID string, evenWithVotes bool) (ChallengeTableEntryStruct, error) {
+	return cancelChallenge(s.db, GuildID, MessageID, evenWithVotes)
+}
+
+func (s *SQLStore) SelectExpiredChallenges(now int64) ([]ChallengeTableEntryStruct, error) {
+	return selectExpiredChallenges(s.db, now)
+}
+
+func (s *SQLStore) SelectGuildSettings(GuildID string) (GuildSettingsEntryStruct, error) {
+	return selectGuildSettings(s.db, GuildID)
+}
+
+func (s *SQLStore) UpsertGuildSettings(row GuildSettingsEntryStruct) error {
+	return upsertGuildSettings(s.db, row)
+}
+
+func (s *SQLStore) Close() error {
+	return s.db.Close()
+}
@@ -0,0 +1,165 @@
+package db
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// updateTally shows a challenge's current votes on its announcement. Edits are throttled to one
+// per Config.TallyInterval for each challenge, votes that come in while one is waiting are
+// picked up by it, since it reads the challenge when it runs
+func (b *Bot) updateTally(s session, GuildID string, MessageID string) {
+	if b.Config.TallyInterval <= 0 {
+		b.editTally(s, GuildID, MessageID)
+		return
+	}
+	key := challengeKey{GuildID, MessageID}
+	b.tallyMu.Lock()
+	defer b.tallyMu.Unlock()
+	if b.pendingTallies[key] {
+		return
+	}
+	b.pendingTallies[key] = true
+	time.AfterFunc(b.Config.TallyInterval, func() {
+		b.tallyMu.Lock()
+		delete(b.pendingTallies, key)
+		b.tallyMu.Unlock()
+		b.editTally(s, GuildID, MessageID)
+	})
+}
+
+// editTally edits the announcement right away, once voting has closed its buttons are disabled.
+// The tally replaces the last one, as an embed or at the end of the text if embeds aren't allowed.
+// Until the defender accepts it says who the challenge is waiting for, with their buttons
+func (b *Bot) editTally(s session, GuildID string, MessageID string) {
+	challengeEntry, err := b.Store.SelectChallengeRow(GuildID, MessageID)
+	if err != nil {
+		oops(err, "SelectChallengeRow")
+		return
+	}
+	announcement, err := s.ChannelMessage(challengeEntry.ChannelID, MessageID)
+	if err != nil {
+		oops(err, "ChannelMessage")
+		return
+	}
+	rule := b.guildSettings(GuildID).closeRule()
+	tally := b.stopTally(challengeEntry)
+	components := voteButtons(challengeEntry.ChallengerName, challengeEntry.DefenderName)
+	if notAccepted(challengeEntry) {
+		components = acceptButtons()
+	}
+	if challengeEntry.Status == ChallengeClosed {
+		components = disableButtons(components)
+	}
+	edit := &discordgo.MessageEdit{
+		ID:         MessageID,
+		Channel:    challengeEntry.ChannelID,
+		Components: components,
+	}
+	if b.embedsAllowed(s, challengeEntry.ChannelID) {
+		edit.Embeds = append(withoutTallyEmbed(announcement.Embeds), tallyEmbed(challengeEntry, rule, tally))
+	} else {
+		content := withoutTally(announcement.Content) + tallyText(challengeEntry, rule, tally)
+		edit.Content = &content
+	}
+	_, err = s.ChannelMessageEditComplex(edit)
+	if err != nil {
+		oops(err, "ChannelMessageEditComplex")
+	}
+}
+
+// stopTally is what the close rule looks at, from the challenge's counts and the participants' voting records
+func (b *Bot) stopTally(challengeEntry ChallengeTableEntryStruct) stopTally {
+	//everyone with a voting record picked exactly one side or abstained
+	tally := stopTally{
+		StopVotes: challengeEntry.StopVotes,
+		Voters:    challengeEntry.ChallengerVotes + challengeEntry.DefenderVotes + challengeEntry.AbstainVotes,
+	}
+	challenger, err := b.Store.SelectVotingRecordRow(challengeEntry.GuildID, challengeEntry.ChallengerID, challengeEntry.MessageID)
+	tally.ChallengerStopped = err == nil && challenger.StopVotes > 0
+	defender, err := b.Store.SelectVotingRecordRow(challengeEntry.GuildID, challengeEntry.DefenderID, challengeEntry.MessageID)
+	tally.DefenderStopped = err == nil && defender.StopVotes > 0
+	return tally
+}
+
+// tallyEmbed is the vote counts, close vote progress, time left and who's ahead
+func tallyEmbed(challengeEntry ChallengeTableEntryStruct, rule CloseRule, tally stopTally) *discordgo.MessageEmbed {
+	if notAccepted(challengeEntry) {
+		return &discordgo.MessageEmbed{
+			Title:       acceptanceTitle(challengeEntry),
+			Description: leaderLine(challengeEntry),
+			Color:       defenderColor,
+			Footer:      challengeFooter(challengeEntry),
+		}
+	}
+	embed := &discordgo.MessageEmbed{
+		Title:       "Current tally",
+		Description: leaderLine(challengeEntry),
+		Color:       challengerColor,
+		Footer:      challengeFooter(challengeEntry),
+		Fields: []*discordgo.MessageEmbedField{
+			{Name: voteChallenger + " " + challengeEntry.ChallengerName, Value: strconv.Itoa(challengeEntry.ChallengerVotes), Inline: true},
+			{Name: voteDefender + " " + challengeEntry.DefenderName, Value: strconv.Itoa(challengeEntry.DefenderVotes), Inline: true},
+			{Name: voteAbstain + " Abstain", Value: strconv.Itoa(challengeEntry.AbstainVotes), Inline: true},
+		},
+	}
+	if challengeEntry.Outcome == OutcomeCancelled {
+		embed.Title = "Cancelled"
+		embed.Color = tieColor
+		return embed
+	}
+	if challengeEntry.Status != ChallengeOpen {
+		embed.Title = "Final tally"
+		return embed
+	}
+	embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{Name: voteStop + " Close voting", Value: rule.progress(tally)})
+	if challengeEntry.Deadline > 0 {
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{Name: "Time left", Value: "Voting closes <t:" + strconv.FormatInt(challengeEntry.Deadline, 10) + ":R>"})
+	}
+	return embed
+}
+
+// leaderLine says who is ahead, or who won once voting has closed
+func leaderLine(challengeEntry ChallengeTableEntryStruct) string {
+	if notAccepted(challengeEntry) {
+		return acceptanceLine(challengeEntry)
+	}
+	if challengeEntry.Outcome == OutcomeCancelled {
+		return "This challenge was cancelled, it doesn't count for anyone."
+	}
+	leader := winnerID(challengeEntry)
+	if challengeEntry.Status != ChallengeOpen {
+		if leader == "tie" {
+			return "It was a tie!"
+		}
+		return "<@" + leader + "> won!"
+	}
+	if leader == "tie" {
+		return "It's a tie so far."
+	}
+	return "<@" + leader + "> is ahead."
+}
+
+// disableButtons greys out every button, so a closed challenge's announcement can't be voted on
+func disableButtons(components []discordgo.MessageComponent) []discordgo.MessageComponent {
+	disabled := []discordgo.MessageComponent{}
+	for _, component := range components {
+		row, ok := component.(discordgo.ActionsRow)
+		if !ok {
+			disabled = append(disabled, component)
+			continue
+		}
+		buttons := []discordgo.MessageComponent{}
+		for _, rowComponent := range row.Components {
+			if button, ok := rowComponent.(discordgo.Button); ok {
+				button.Disabled = true
+				rowComponent = button
+			}
+			buttons = append(buttons, rowComponent)
+		}
+		disabled = append(disabled, discordgo.ActionsRow{Components: buttons})
+	}
+	return disabled
+}
@@ -0,0 +1,116 @@
+package db
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestCloseRuleProgress(t *testing.T) {
+	tests := []struct {
+		rule     CloseRule
+		tally    stopTally
+		expected string
+	}{
+		{CloseRule{CloseAfterStopVotes, 3}, stopTally{StopVotes: 1}, "1 of 3"},
+		{CloseRule{CloseAtVoterPercent, 50}, stopTally{StopVotes: 1, Voters: 4}, "25% of voters so far, needs 50%"},
+		{CloseRule{CloseAtVoterPercent, 50}, stopTally{}, "0% of voters so far, needs 50%"},
+		{CloseRule{CloseWhenParticipantsAgree, 0}, stopTally{DefenderStopped: true}, "The defender has agreed, waiting for the challenger"},
+		{CloseRule{CloseWhenParticipantsAgree, 0}, stopTally{}, "Waiting for both participants"},
+	}
+	for _, test := range tests {
+		actual := test.rule.progress(test.tally)
+		if actual != test.expected {
+			t.Errorf("got %q, wanted %q", actual, test.expected)
+		}
+	}
+}
+
+func TestTallyEmbed(t *testing.T) {
+	challengeEntry := initChallengeTableEntry(testGuildID, testChannelID, "0", "1", "Gabe", "2", "Miia")
+	challengeEntry.ChallengerVotes = 1
+	challengeEntry.DefenderVotes = 3
+	challengeEntry.StopVotes = 1
+	challengeEntry.Outcome = 2
+	challengeEntry.Deadline = 2000
+	embed := tallyEmbed(challengeEntry, twoStopVotes, stopTally{StopVotes: 1, Voters: 4})
+	if embed.Title != "Current tally" || embed.Description != "<@2> is ahead." {
+		t.Errorf("got %q and %q", embed.Title, embed.Description)
+	}
+	values := []string{}
+	for _, field := range embed.Fields {
+		values = append(values, field.Value)
+	}
+	expected := "1,3,0,1 of 2,Voting closes <t:2000:R>"
+	if strings.Join(values, ",") != expected {
+		t.Errorf("got %q, wanted %q", strings.Join(values, ","), expected)
+	}
+
+	challengeEntry.Status = ChallengeClosed
+	embed = tallyEmbed(challengeEntry, twoStopVotes, stopTally{})
+	if embed.Title != "Final tally" || embed.Description != "<@2> won!" || len(embed.Fields) != 3 {
+		t.Errorf("got %+v, wanted the final counts", embed)
+	}
+}
+
+func TestVotesUpdateTally(t *testing.T) {
+	b := newTestChallenge(t)
+	s := &fakeSession{permissions: discordgo.PermissionEmbedLinks}
+	b.messageReactionCreate(s, &discordgo.MessageReaction{GuildID: testGuildID, UserID: "10", MessageID: "0", ChannelID: "9", Emoji: discordgo.Emoji{Name: voteChallenger}})
+	if len(s.edits) != 1 || s.edits[0].ID != "0" || s.edits[0].Channel != testChannelID {
+		t.Fatalf("got %+v, wanted the announcement edited", s.edits)
+	}
+	if s.edits[0].Embeds[0].Description != "<@1> is ahead." {
+		t.Errorf("got %q, wanted %q", s.edits[0].Embeds[0].Description, "<@1> is ahead.")
+	}
+	b.interactionCreate(s, buttonClick("10", StopVote))
+	b.interactionCreate(s, buttonClick("11", StopVote))
+	last := s.edits[len(s.edits)-1]
+	if last.Embeds[0].Title != "Final tally" {
+		t.Errorf("got %q, wanted the final tally once voting closed", last.Embeds[0].Title)
+	}
+	button := last.Components[0].(discordgo.ActionsRow).Components[0].(discordgo.Button)
+	if !button.Disabled {
+		t.Errorf("the buttons should be disabled once voting closed")
+	}
+}
+
+func TestUpdateTallyThrottled(t *testing.T) {
+	b := newTestChallenge(t)
+	b.Config.TallyInterval = 20 * time.Millisecond
+	s := &fakeSession{permissions: discordgo.PermissionEmbedLinks}
+	for _, userID := range []string{"10", "11", "12"} {
+		b.messageReactionCreate(s, &discordgo.MessageReaction{GuildID: testGuildID, UserID: userID, MessageID: "0", ChannelID: "9", Emoji: discordgo.Emoji{Name: voteDefender}})
+	}
+	time.Sleep(100 * time.Millisecond)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.edits) != 1 {
+		t.Fatalf("got %d edits, wanted the three votes in one", len(s.edits))
+	}
+	if s.edits[0].Embeds[0].Fields[1].Value != "3" {
+		t.Errorf("got %q, wanted %q", s.edits[0].Embeds[0].Fields[1].Value, "3")
+	}
+}
+
+func TestTallyWithoutEmbeds(t *testing.T) {
+	b := newTestBot()
+	s := &fakeSession{}
+	statement := &discordgo.Message{ID: "50", GuildID: testGuildID, Content: "Pineapple belongs on pizza", Author: &discordgo.User{ID: "2", Username: "Miia"}}
+	b.messageCreate(s, &discordgo.Message{ID: "51", GuildID: testGuildID, ChannelID: testChannelID, Content: "!challenge", Type: discordgo.MessageTypeReply, Author: &discordgo.User{ID: "1", Username: "Gabe"}, ReferencedMessage: statement})
+	for _, userID := range []string{"10", "11"} {
+		b.messageReactionCreate(s, &discordgo.MessageReaction{GuildID: testGuildID, UserID: userID, MessageID: "101", ChannelID: testChannelID, Emoji: discordgo.Emoji{Name: voteDefender}})
+	}
+	announcement, _ := s.ChannelMessage(testChannelID, "101")
+	if !strings.HasPrefix(announcement.Content, s.complex[0].Content+tallyMarker) {
+		t.Errorf("got %q, wanted the tally after the original announcement", announcement.Content)
+	}
+	if strings.Count(announcement.Content, tallyMarker) != 1 || !strings.Contains(announcement.Content, voteDefender+" 2") {
+		t.Errorf("got %q, wanted only the newest tally", announcement.Content)
+	}
+	if len(announcement.Embeds) != 0 {
+		t.Errorf("got %d embeds, wanted none when embeds aren't allowed", len(announcement.Embeds))
+	}
+}
@@ -0,0 +1,324 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Vote is one of the choices a user can make on a challenge
+type Vote int
+
+const (
+	ChallengerVote Vote = iota
+	DefenderVote
+	AbstainVote
+	StopVote
+	// ChallengerAbstain and DefenderAbstain are a participant's vote for a side that their guild
+	// counts as an abstention, see ParticipantVotesAbstain. They're recorded as an AbstainVote
+	// that only taking back the same side removes
+	ChallengerAbstain
+	DefenderAbstain
+
+	// NoVote is the side RecordVote reports replacing when the user hadn't picked one yet
+	NoVote Vote = -1
+)
+
+var (
+	// ErrAlreadyVoted is returned when a user picks the side they already voted for, or votes stop twice
+	ErrAlreadyVoted = errors.New("user has voted already")
+	// ErrNotVoted is returned when a user takes back a vote they never made
+	ErrNotVoted = errors.New("user has not made this vote")
+	// ErrVotingClosed is returned for any vote on a challenge that has already been decided,
+	// and when closing a challenge that someone else closed first
+	ErrVotingClosed = errors.New("voting on this challenge is closed")
+	// ErrAlreadyAbstained is returned when a participant abstains again with a different reaction
+	// than the one their abstention was cast with
+	ErrAlreadyAbstained = errors.New("user has abstained already")
+	// ErrParticipantVote is returned when the challenger or defender votes for a side in a guild
+	// that doesn't count participants' votes
+	ErrParticipantVote = errors.New("participants' votes for a side aren't counted")
+	// ErrNotCloser is returned when a user votes ✋ in a guild that doesn't let them close voting
+	ErrNotCloser = errors.New("user can't vote to close this challenge")
+	// ErrHasVotes is returned when the challenger tries to cancel a challenge someone has voted on
+	ErrHasVotes = errors.New("challenge has votes already")
+	// ErrAnswered is returned when accepting or declining a challenge that isn't waiting for its defender
+	ErrAnswered = errors.New("challenge isn't waiting for an answer")
+)
+
+// countedAs is the vote a recorded vote counts as, AbstainVote for ChallengerAbstain and DefenderAbstain
+func countedAs(vote Vote) Vote {
+	if vote == ChallengerAbstain || vote == DefenderAbstain {
+		return AbstainVote
+	}
+	return vote
+}
+
+// abstainedWith is the reaction an abstention is cast with: the abstain reaction itself, or the
+// side a participant's vote counted as an abstention was for
+func abstainedWith(vote Vote) Vote {
+	switch vote {
+	case ChallengerAbstain:
+		return ChallengerVote
+	case DefenderAbstain:
+		return DefenderVote
+	}
+	return AbstainVote
+}
+
+// takenBack is what taking back a side's reaction takes back on a voting record: the abstention
+// it cast if it was counted as one, whatever the guild's participant vote rule is now
+func takenBack(votingRecordEntry VotingRecordEntryStruct, vote Vote) Vote {
+	if votingRecordEntry.AbstainVotes == 0 || votingRecordEntry.AbstainedWith != vote {
+		return vote
+	}
+	switch vote {
+	case ChallengerVote:
+		return ChallengerAbstain
+	case DefenderVote:
+		return DefenderAbstain
+	}
+	return vote
+}
+
+// applyVote adds (or takes back) a vote on a user's voting record. Picking a different side
+// replaces the user's old one, which is returned, and NoVote otherwise. An abstention is only
+// taken back by the reaction it was cast with
+func applyVote(votingRecordEntry *VotingRecordEntryStruct, vote Vote, add bool) (Vote, error) {
+	if !add {
+		vote = takenBack(*votingRecordEntry, vote)
+	}
+	var flag *int
+	switch countedAs(vote) {
+	case ChallengerVote:
+		flag = &votingRecordEntry.ChallengerVotes
+	case DefenderVote:
+		flag = &votingRecordEntry.DefenderVotes
+	case AbstainVote:
+		flag = &votingRecordEntry.AbstainVotes
+	case StopVote:
+		flag = &votingRecordEntry.StopVotes
+	}
+	if add && *flag > 0 && countedAs(vote) == AbstainVote && votingRecordEntry.AbstainedWith != abstainedWith(vote) {
+		return NoVote, ErrAlreadyAbstained
+	}
+	if add && *flag > 0 {
+		return NoVote, ErrAlreadyVoted
+	}
+	if !add && *flag == 0 {
+		return NoVote, ErrNotVoted
+	}
+	if !add && countedAs(vote) == AbstainVote && votingRecordEntry.AbstainedWith != abstainedWith(vote) {
+		return NoVote, ErrNotVoted
+	}
+	replaced := NoVote
+	if add && vote != StopVote {
+		replaced = votedSide(*votingRecordEntry)
+		votingRecordEntry.ChallengerVotes = 0
+		votingRecordEntry.DefenderVotes = 0
+		votingRecordEntry.AbstainVotes = 0
+	}
+	if add {
+		*flag = 1
+	} else {
+		*flag = 0
+	}
+	if votingRecordEntry.AbstainVotes == 0 {
+		votingRecordEntry.AbstainedWith = AbstainVote
+	} else if add && countedAs(vote) == AbstainVote {
+		votingRecordEntry.AbstainedWith = abstainedWith(vote)
+	}
+	return replaced, nil
+}
+
+// votedSide is the side a user has picked on a challenge, or NoVote. For an abstention it's the
+// reaction it was cast with
+func votedSide(votingRecordEntry VotingRecordEntryStruct) Vote {
+	switch {
+	case votingRecordEntry.ChallengerVotes > 0:
+		return ChallengerVote
+	case votingRecordEntry.DefenderVotes > 0:
+		return DefenderVote
+	case votingRecordEntry.AbstainVotes > 0:
+		return votingRecordEntry.AbstainedWith
+	}
+	return NoVote
+}
+
+// hasVoted is true once a user has picked a side (or abstained) on a challenge
+func hasVoted(votingRecordEntry VotingRecordEntryStruct) bool {
+	return votingRecordEntry.ChallengerVotes > 0 || votingRecordEntry.DefenderVotes > 0 || votingRecordEntry.AbstainVotes > 0
+}
+
+func votingRecordEmpty(votingRecordEntry VotingRecordEntryStruct) bool {
+	return !hasVoted(votingRecordEntry) && votingRecordEntry.StopVotes == 0
+}
+
+// castVote changes a user's vote and recounts the challenge's totals and outcome from votingRecord,
+// all in one transaction so concurrent reactions can't overwrite each other's counts. A vote that
+// meets the close rule closes the challenge and pushes its score in the same transaction. A new side
+// replaces the user's old one in the same transaction, the old side is returned (or NoVote)
+func castVote(db *sqlx.DB, GuildID string, MessageID string, UserID string, vote Vote, add bool, rule CloseRule, achievements []Achievement) (ChallengeTableEntryStruct, Vote, error) {
+	tx, err := db.Beginx()
+	if err != nil {
+		oops(err, "Beginx")
+		return ChallengeTableEntryStruct{}, NoVote, err
+	}
+	defer tx.Rollback()
+
+	//touch the challenge row first so other votes on it wait until we commit
+	res, err := tx.Exec(tx.Rebind("UPDATE challengeTable SET StopVotes = StopVotes WHERE GuildID = ? AND MessageID = ?"), GuildID, MessageID)
+	if err != nil {
+		oops(err, "lock challenge row")
+		return ChallengeTableEntryStruct{}, NoVote, err
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return ChallengeTableEntryStruct{}, NoVote, err
+	}
+	if rows == 0 {
+		return ChallengeTableEntryStruct{}, NoVote, sql.ErrNoRows
+	}
+	challengeRow, err := selectChallengeRow(tx, GuildID, MessageID)
+	if err != nil {
+		return challengeRow, NoVote, err
+	}
+	if challengeRow.Status != ChallengeOpen {
+		return challengeRow, NoVote, ErrVotingClosed
+	}
+
+	votingRecordEntry, err := selectVotingRecordRow(tx, GuildID, UserID, MessageID)
+	isNew := err == sql.ErrNoRows
+	if err != nil && !isNew {
+		return challengeRow, NoVote, err
+	}
+	votingRecordEntry.GuildID = GuildID
+	votingRecordEntry.UserID = UserID
+	votingRecordEntry.MessageID = MessageID
+	replaced, err := applyVote(&votingRecordEntry, vote, add)
+	if err != nil {
+		return challengeRow, NoVote, err
+	}
+	if isNew {
+		err = insertVotingRecordRow(tx, votingRecordEntry)
+	} else if votingRecordEmpty(votingRecordEntry) {
+		err = removeVotingRecordRow(tx, votingRecordEntry)
+	} else {
+		err = updateVotingRecord(tx, votingRecordEntry)
+	}
+	if err != nil {
+		return challengeRow, NoVote, err
+	}
+
+	votes := VotesStruct{}
+	err = tx.Get(&votes, tx.Rebind("SELECT COALESCE(SUM(ChallengerVotes), 0) AS ChallengerVotes, COALESCE(SUM(DefenderVotes), 0) AS DefenderVotes, COALESCE(SUM(AbstainVotes), 0) AS AbstainVotes, COALESCE(SUM(StopVotes), 0) AS StopVotes FROM votingRecord WHERE GuildID = ? AND MessageID = ?"), GuildID, MessageID)
+	if err != nil {
+		oops(err, "counting votes")
+		return challengeRow, NoVote, err
+	}
+	err = updateVotes(tx, GuildID, MessageID, votes)
+	if err != nil {
+		return challengeRow, NoVote, err
+	}
+	err = updateOutcome(tx, GuildID, MessageID, votes)
+	if err != nil {
+		return challengeRow, NoVote, err
+	}
+	tally, err := selectStopTally(tx, challengeRow, votes)
+	if err != nil {
+		return challengeRow, NoVote, err
+	}
+	if rule.closes(tally) {
+		_, err = closeAndScore(tx, GuildID, MessageID, achievements)
+		if err != nil {
+			return challengeRow, NoVote, err
+		}
+	}
+	challengeRow, err = selectChallengeRow(tx, GuildID, MessageID)
+	if err != nil {
+		return challengeRow, NoVote, err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return challengeRow, NoVote, err
+	}
+	return challengeRow, replaced, nil
+}
+
+// selectStopTally counts what the guild's CloseRule needs to know about a challenge
+func selectStopTally(db dbtx, challengeRow ChallengeTableEntryStruct, votes VotesStruct) (stopTally, error) {
+	tally := stopTally{StopVotes: votes.StopVotes}
+	err := db.Get(&tally.Voters, db.Rebind("SELECT COUNT(*) FROM votingRecord WHERE GuildID = ? AND MessageID = ? AND (ChallengerVotes > 0 OR DefenderVotes > 0 OR AbstainVotes > 0)"), challengeRow.GuildID, challengeRow.MessageID)
+	if err != nil {
+		oops(err, "counting voters")
+		return tally, err
+	}
+	tally.ChallengerStopped = hasVotedStop(db, VotingRecordEntryStruct{GuildID: challengeRow.GuildID, UserID: challengeRow.ChallengerID, MessageID: challengeRow.MessageID})
+	tally.DefenderStopped = hasVotedStop(db, VotingRecordEntryStruct{GuildID: challengeRow.GuildID, UserID: challengeRow.DefenderID, MessageID: challengeRow.MessageID})
+	return tally, nil
+}
+
+// closeAndScore closes an open challenge and pushes its score in the caller's transaction, so a
+// challenge is never left closed without being scored. It affects no rows if it was closed already
+func closeAndScore(db dbtx, GuildID string, MessageID string, achievements []Achievement) (int64, error) {
+	rows, err := closeChallengeRow(db, GuildID, MessageID)
+	if err != nil || rows == 0 {
+		return rows, err
+	}
+	challengeRow, err := selectChallengeRow(db, GuildID, MessageID)
+	if err != nil {
+		return 0, err
+	}
+	return rows, pushScore(db, challengeRow, achievements)
+}
+
+// closeChallenge ends voting on a challenge and pushes its score, only one caller gets the closed
+// row back, everyone else (or anyone closing an already decided challenge) gets ErrVotingClosed
+func closeChallenge(db *sqlx.DB, GuildID string, MessageID string, achievements []Achievement) (ChallengeTableEntryStruct, error) {
+	tx, err := db.Beginx()
+	if err != nil {
+		oops(err, "Beginx")
+		return ChallengeTableEntryStruct{}, err
+	}
+	defer tx.Rollback()
+	rows, err := closeAndScore(tx, GuildID, MessageID, achievements)
+	if err != nil {
+		return ChallengeTableEntryStruct{}, err
+	}
+	challengeRow, err := selectChallengeRow(tx, GuildID, MessageID)
+	if err != nil {
+		return challengeRow, err
+	}
+	if rows == 0 {
+		return challengeRow, ErrVotingClosed
+	}
+	return challengeRow, tx.Commit()
+}
+
+// cancelChallenge withdraws an open or pending challenge, with OutcomeCancelled and no score pushed. It fails
+// with ErrVotingClosed once the challenge has closed, and with ErrHasVotes if someone has voted
+// on it unless evenWithVotes
+func cancelChallenge(db *sqlx.DB, GuildID string, MessageID string, evenWithVotes bool) (ChallengeTableEntryStruct, error) {
+	tx, err := db.Beginx()
+	if err != nil {
+		oops(err, "Beginx")
+		return ChallengeTableEntryStruct{}, err
+	}
+	defer tx.Rollback()
+	rows, err := cancelChallengeRow(tx, GuildID, MessageID, evenWithVotes)
+	if err != nil {
+		return ChallengeTableEntryStruct{}, err
+	}
+	challengeRow, err := selectChallengeRow(tx, GuildID, MessageID)
+	if err != nil {
+		return challengeRow, err
+	}
+	if rows == 0 && challengeRow.Status == ChallengeClosed {
+		return challengeRow, ErrVotingClosed
+	}
+	if rows == 0 {
+		return challengeRow, ErrHasVotes
+	}
+	return challengeRow, tx.Commit()
+}
@@ -2,7 +2,10 @@ module github.com/IUS-CS/s22-project-velociraptors/src
 
 go 1.17
 
-require github.com/bwmarrin/discordgo v0.24.0
+require (
+	github.com/bwmarrin/discordgo v0.24.0
+	github.com/lib/pq v1.10.9
+)
 
 require (
 	github.com/davecgh/go-spew v1.1.0 // indirect
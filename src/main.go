@@ -1,7 +1,9 @@
 package main
 
 import (
+	"errors"
 	"flag"
+	"fmt"
 	bot "github.com/IUS-CS/s22-project-velociraptors/src/bot"
 	"github.com/bwmarrin/discordgo"
 	"github.com/jmoiron/sqlx"
@@ -9,7 +11,9 @@ import (
 	"log"
 	"os"
 	"os/signal"
+	"strconv"
 	"syscall"
+	"time"
 )
 
 func oops(e error, n string) {
@@ -19,29 +23,54 @@ func oops(e error, n string) {
 // Token variable used for command line parameters
 var Token string
 
+// DSN picks the database, a sqlite file name or a postgres:// URL
+var DSN string
+
+// DefaultGuild is the guild that scores from before per-guild scoreboards are moved to
+var DefaultGuild string
+
+// ChallengeDuration is how long voting stays open on a !challenge that doesn't give a duration
+var ChallengeDuration time.Duration
+
+// RemoveReactions takes a voter's old reaction off the announcement when they switch sides
+var RemoveReactions bool
+
+// AchievementsFile is a JSON file of achievements to use instead of the default ones
+var AchievementsFile string
+
 func init() {
 	flag.StringVar(&Token, "t", "", "Bot Token")
+	flag.StringVar(&DSN, "dsn", os.Getenv("DATABASE_URL"), "Database to use, a sqlite file name or a postgres:// URL (defaults to $DATABASE_URL, then the scoreboardDB sqlite file)")
+	flag.StringVar(&DefaultGuild, "guild", os.Getenv("DEFAULT_GUILD_ID"), "Guild ID that challenges and scores from before per-guild scoreboards belong to (defaults to $DEFAULT_GUILD_ID)")
+	flag.DurationVar(&ChallengeDuration, "duration", 0, "How long voting stays open when !challenge isn't given a duration, e.g. 24h (0 waits for stop votes)")
+	flag.BoolVar(&RemoveReactions, "remove-reactions", true, "Remove a voter's old reaction when they switch sides (needs the Manage Messages permission)")
+	flag.StringVar(&AchievementsFile, "achievements", "", "JSON file listing the achievements users can unlock, instead of the default ones")
 	flag.Parse()
 }
 
-func main() {
-	//create a new Discord session using the provided bot token
-	dg, err := discordgo.New("Bot " + Token)
-	if err != nil {
-		oops(err, "New(Bot + Token")
-		return
+// connect opens the database picked with -dsn, or scoreboardDB if there isn't one
+func connect() (*sqlx.DB, error) {
+	if DSN == "" {
+		return bot.ConnectToDB()
 	}
-	dg.Identify.Intents = discordgo.IntentsGuildMessages | discordgo.IntentGuildMessageReactions
-	//open a websocket connection to Discord and begin listening
-	err = dg.Open()
-	if err != nil {
-		oops(err, "Open()")
+	return bot.OpenDB(DSN)
+}
+
+func main() {
+	//migrate status/up/down only touches the database, the bot isn't started
+	if flag.Arg(0) == "migrate" {
+		err := migrateCommand(flag.Args()[1:])
+		if err != nil {
+			oops(err, "migrate")
+			os.Exit(1)
+		}
 		return
 	}
-	//connect to scoreboardDB
-	db, err := bot.ConnectToDB()
+
+	//connect to the database, this one handle is shared by every event handler
+	db, err := connect()
 	if err != nil {
-		oops(err, "ConnectToDB")
+		oops(err, "connect")
 		return
 	}
 	defer func(db *sqlx.DB) {
@@ -51,33 +80,58 @@ func main() {
 		}
 	}(db)
 	log.Printf("Successfully connected to database")
-	//create tables
-	err = bot.CreateChallengeTable(db)
+	//create or update tables
+	err = bot.Migrate(db, DefaultGuild)
 	if err != nil {
-		oops(err, "CreateChallengeTable")
+		oops(err, "Migrate")
 		return
 	}
-	err = bot.CreateScoreboardTable(db)
+
+	//create a new Discord session using the provided bot token
+	dg, err := discordgo.New("Bot " + Token)
 	if err != nil {
-		oops(err, "CreateScoreboardTable")
+		oops(err, "New(Bot + Token")
 		return
 	}
-	err = bot.CreateVotingRecord(db)
+	dg.Identify.Intents = discordgo.IntentsGuilds | discordgo.IntentsGuildMessages | discordgo.IntentGuildMessageReactions
+
+	//register the bot's handlers as callbacks for MessageCreate and reaction events
+	config := bot.DefaultConfig()
+	config.DefaultChallengeDuration = ChallengeDuration
+	config.RemoveSwitchedReactions = RemoveReactions
+	if AchievementsFile != "" {
+		config.Achievements, err = bot.LoadAchievements(AchievementsFile)
+		if err != nil {
+			oops(err, "LoadAchievements")
+			return
+		}
+	}
+	b := bot.NewBot(dg, bot.NewSQLStore(db), config)
+	b.AddHandlers()
+
+	//open a websocket connection to Discord and begin listening
+	err = dg.Open()
 	if err != nil {
-		oops(err, "CreateVotingRecord")
+		oops(err, "Open()")
 		return
 	}
 
-	//register messageCreate function as a callback for MessageCreate events
-	dg.AddHandler(bot.MessageCreate)
-	dg.AddHandler(bot.MessageReactionCreate)
-	dg.AddHandler(bot.MessageReactionDelete)
+	//register the slash commands now that the session knows the bot's application ID
+	err = b.RegisterCommands()
+	if err != nil {
+		oops(err, "RegisterCommands")
+	}
+
+	//close challenges as their deadlines pass
+	stopScheduler := make(chan struct{})
+	go b.RunScheduler(stopScheduler)
 
 	//everything runs here until one of the term signals is received
 	log.Println("Bot is now running. Press CTRL-C to exit.")
 	sc := make(chan os.Signal, 1)
 	signal.Notify(sc, syscall.SIGINT, syscall.SIGTERM, os.Interrupt)
 	<-sc
+	close(stopScheduler)
 
 	//close the Discord session
 	err = dg.Close()
@@ -85,4 +139,48 @@ func main() {
 		oops(err, "Close()")
 		return
 	}
-}
\ No newline at end of file
+}
+
+// migrateCommand handles "migrate status", "migrate up [steps]" and "migrate down [steps]",
+// up applies every pending migration and down rolls back one unless told otherwise
+func migrateCommand(args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: migrate status|up|down [steps]")
+	}
+	steps := 0
+	if args[0] == "down" {
+		steps = 1
+	}
+	if len(args) > 1 {
+		n, err := strconv.Atoi(args[1])
+		if err != nil || n < 1 {
+			return fmt.Errorf("steps must be a positive number, got %q", args[1])
+		}
+		steps = n
+	}
+	db, err := connect()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	switch args[0] {
+	case "status":
+		status, err := bot.MigrationStatus(db)
+		if err != nil {
+			return err
+		}
+		for _, m := range status {
+			applied := "pending"
+			if m.Applied {
+				applied = "applied " + time.Unix(m.AppliedAt, 0).Format(time.RFC3339)
+			}
+			fmt.Printf("%04d_%s\t%s\n", m.Version, m.Name, applied)
+		}
+		return nil
+	case "up":
+		return bot.MigrateUp(db, steps, DefaultGuild)
+	case "down":
+		return bot.MigrateDown(db, steps)
+	}
+	return fmt.Errorf("unknown migrate command %q, use status, up or down", args[0])
+}